@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,6 +12,12 @@ import (
 	"marcel-cli/config"
 )
 
+var ErrOffline = errors.New("server unreachable")
+
+func IsOffline(err error) bool {
+	return errors.Is(err, ErrOffline)
+}
+
 type Client struct {
 	baseURL    string
 	authToken  string
@@ -19,7 +26,7 @@ type Client struct {
 
 func NewClient(cfg *config.Config) *Client {
 	return &Client{
-		baseURL:   config.APIEndpoint,
+		baseURL:   cfg.APIURL,
 		authToken: cfg.AuthToken,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
@@ -28,6 +35,10 @@ func NewClient(cfg *config.Config) *Client {
 }
 
 func (c *Client) doRequest(method, path string, body interface{}) (*http.Response, error) {
+	return c.doRequestWithHeaders(method, path, body, nil)
+}
+
+func (c *Client) doRequestWithHeaders(method, path string, body interface{}, headers map[string]string) (*http.Response, error) {
 	var bodyReader io.Reader
 	if body != nil {
 		jsonData, err := json.Marshal(body)
@@ -50,9 +61,13 @@ func (c *Client) doRequest(method, path string, body interface{}) (*http.Respons
 		req.Header.Set("Content-Type", "application/json")
 	}
 
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, fmt.Errorf("request failed: %w: %w", ErrOffline, err)
 	}
 
 	return resp, nil
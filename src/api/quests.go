@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 
 	"marcel-cli/models"
 )
@@ -23,11 +24,14 @@ type CreateQuestRequest struct {
 	JourneyID  *int   `json:"journeyId,omitempty"`
 }
 
+// UpdateQuestRequest changes the fields that are set. JourneyID moves the
+// quest to another journey; there is no way to take it out of one.
 type UpdateQuestRequest struct {
 	Title      *string `json:"title,omitempty"`
 	Note       *string `json:"note,omitempty"`
 	Done       *bool   `json:"done,omitempty"`
 	Difficulty *string `json:"difficulty,omitempty"`
+	JourneyID  *int    `json:"journeyId,omitempty"`
 }
 
 func (c *Client) GetQuests() ([]models.Quest, error) {
@@ -98,6 +102,71 @@ func (c *Client) UpdateQuest(questID int, updates UpdateQuestRequest) (*models.Q
 	return &result.Quest, nil
 }
 
+// QuestConflictError is returned by UpdateQuestIfUnchanged when the quest was
+// modified on the server after the local copy was read.
+type QuestConflictError struct {
+	Base   models.Quest
+	Remote models.Quest
+}
+
+func (e *QuestConflictError) Error() string {
+	return fmt.Sprintf("quest %q was changed elsewhere at %s", e.Remote.Title, e.Remote.UpdatedAt.Local().Format("15:04:05"))
+}
+
+// GetQuest looks a quest up in the full list, as the API has no way to read
+// a single one. Only conflicts need it.
+func (c *Client) GetQuest(questID int) (*models.Quest, error) {
+	quests, err := c.GetQuests()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, q := range quests {
+		if q.ID == questID {
+			return &q, nil
+		}
+	}
+
+	return nil, fmt.Errorf("quest %d no longer exists", questID)
+}
+
+// UpdateQuestIfUnchanged only writes if the quest has not changed on the
+// server since base.UpdatedAt, which it sends as If-Unmodified-Since. HTTP
+// dates have whole seconds, so the server compares at that resolution and
+// a change within the same second as base goes unnoticed.
+func (c *Client) UpdateQuestIfUnchanged(base models.Quest, updates UpdateQuestRequest) (*models.Quest, error) {
+	headers := map[string]string{
+		"If-Unmodified-Since": base.UpdatedAt.UTC().Format(http.TimeFormat),
+	}
+
+	path := fmt.Sprintf("/quest/%d", base.ID)
+	resp, err := c.doRequestWithHeaders("PUT", path, updates, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		remote, err := c.GetQuest(base.ID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &QuestConflictError{Base: base, Remote: *remote}
+	}
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to update quest: status %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var result QuestResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result.Quest, nil
+}
+
 func (c *Client) ToggleQuest(questID int, done bool) (*models.Quest, error) {
 	return c.UpdateQuest(questID, UpdateQuestRequest{
 		Done: &done,
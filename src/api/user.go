@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"marcel-cli/models"
+)
+
+type UserResponse struct {
+	User models.User `json:"user"`
+}
+
+func (c *Client) GetMe() (*models.User, error) {
+	resp, err := c.doRequest("GET", "/user/me", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == 401 {
+		return nil, fmt.Errorf("authentication failed: invalid token")
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to get user: status %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var result UserResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if result.User.ID == 0 {
+		if err := json.Unmarshal(body, &result.User); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+
+	return &result.User, nil
+}
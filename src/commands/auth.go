@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"marcel-cli/config"
+	"marcel-cli/storage"
+
+	"golang.org/x/term"
+)
+
+func runLogin(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	token, err := readToken()
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return fmt.Errorf("no token given")
+	}
+
+	s, err := storage.New()
+	if err != nil {
+		return err
+	}
+	if s.GetConfig().Backend == config.BackendLocal {
+		fmt.Println("Note: backend is local in the config file; set it to api to use this account.")
+	}
+
+	user, where, err := s.Login(token)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Logged in as %s (token stored in %s)\n", user.DisplayName(), where)
+	switch s.GetConfig().TokenSource {
+	case config.TokenSourceFD, config.TokenSourceEnv, config.TokenSourceCommand:
+		fmt.Printf("Note: %s is set and takes precedence over the stored token.\n", s.GetConfig().TokenSource)
+	}
+	return nil
+}
+
+// readToken prompts for the token on a terminal, or reads it from stdin so
+// it can be piped in from a password manager.
+func readToken() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		data, err := io.ReadAll(bufio.NewReader(os.Stdin))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	fmt.Println("Generate a Marcel CLI token in the Marcel web app settings, then paste it here.")
+	fmt.Print("Token: ")
+	token, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+func runLogout(args []string) error {
+	fs := flag.NewFlagSet("logout", flag.ContinueOnError)
+	force := fs.Bool("force", false, "Log out even if offline changes have not been synced yet")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := storage.New()
+	if err != nil {
+		return err
+	}
+
+	if n := s.PendingCount(); n > 0 && !*force {
+		return fmt.Errorf("%d offline change(s) have not been synced yet and would be lost; sync first or use --force", n)
+	}
+
+	if err := s.Logout(); err != nil {
+		return err
+	}
+
+	fmt.Println("✓ Logged out and cleared the local cache")
+	if s.GetConfig().TokenCommand != "" {
+		fmt.Println("Note: token_command is still set in the config file.")
+	}
+	if os.Getenv("MARCEL_TOKEN") != "" {
+		fmt.Println("Note: MARCEL_TOKEN is still set in your environment.")
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"marcel-cli/config"
+	"marcel-cli/storage"
+)
+
+func runCache(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: marcel cache inspect|clear|rebuild")
+	}
+
+	s, err := storage.New()
+	if err != nil {
+		return err
+	}
+	if s.GetConfig().Backend == config.BackendLocal {
+		return fmt.Errorf("there is no server cache with backend: local; your data lives in %s", filepath.Join(s.GetConfig().Paths.StateDir, "local"))
+	}
+
+	switch args[0] {
+	case "inspect":
+		return cacheInspect(s)
+	case "clear":
+		return cacheClear(s, args[1:])
+	case "rebuild":
+		return cacheRebuild(s)
+	default:
+		return fmt.Errorf("unknown cache subcommand %q: expected inspect, clear or rebuild", args[0])
+	}
+}
+
+func cacheInspect(s *storage.Storage) error {
+	info, err := s.InspectCache()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Path:           %s\n", info.Path)
+	if info.SizeBytes == 0 {
+		fmt.Println("Status:         empty (nothing cached yet)")
+		return nil
+	}
+
+	fmt.Printf("Size:           %.1f KiB\n", float64(info.SizeBytes)/1024)
+	fmt.Printf("Schema version: %d (this build: %d)\n", info.SchemaVersion, storage.SchemaVersion)
+	fmt.Printf("Encryption:     %s\n", info.Encryption)
+	if info.LastSynced.IsZero() {
+		fmt.Println("Last synced:    never")
+	} else {
+		fmt.Printf("Last synced:    %s (%s ago)\n", info.LastSynced.Local().Format("2006-01-02 15:04:05"),
+			time.Since(info.LastSynced).Round(time.Second))
+	}
+	fmt.Printf("Journeys:       %d\n", info.Counts["journeys"])
+	fmt.Printf("Quests:         %d (%d open, %d outside journeys, %d due today)\n",
+		info.Counts["quests"], info.OpenQuests, info.LooseQuests, info.QuestsToday)
+	fmt.Printf("Habits:         %d\n", info.Counts["habits"])
+	fmt.Printf("Events:         %d (%d today)\n", info.Counts["events"], info.EventsToday)
+	fmt.Printf("Pending ops:    %d\n", len(info.PendingOps))
+	for _, op := range info.PendingOps {
+		fmt.Printf("  %-16s id=%-6d queued %s\n", op.Kind, op.ID, op.QueuedAt.Local().Format("2006-01-02 15:04"))
+	}
+	if len(info.FailedOps) > 0 {
+		fmt.Printf("Rejected ops:   %d\n", len(info.FailedOps))
+		for _, op := range info.FailedOps {
+			fmt.Printf("  %-16s id=%-6d failed %s: %s\n", op.Kind, op.ID, op.FailedAt.Local().Format("2006-01-02 15:04"), op.Error)
+		}
+	}
+
+	return nil
+}
+
+func cacheClear(s *storage.Storage, args []string) error {
+	fs := flag.NewFlagSet("cache clear", flag.ContinueOnError)
+	all := fs.Bool("all", false, "Also discard unsynced offline changes and daily snapshots")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !*all {
+		if n := s.PendingCount(); n > 0 {
+			fmt.Printf("Keeping %d unsynced offline change(s); use --all to discard them too.\n", n)
+		}
+	}
+
+	if err := s.ClearCache(*all); err != nil {
+		return err
+	}
+
+	fmt.Println("✓ Cache cleared")
+	return nil
+}
+
+func cacheRebuild(s *storage.Storage) error {
+	data, err := s.RebuildCache()
+	if err != nil {
+		return fmt.Errorf("failed to rebuild cache: %w", err)
+	}
+
+	quests := 0
+	for _, j := range data.Journeys {
+		quests += len(j.Quests)
+	}
+	fmt.Printf("✓ Cache rebuilt: %d quests, %d habits, %d events\n", quests, len(data.Habits), len(data.Events))
+	return nil
+}
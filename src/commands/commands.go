@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var registry = map[string]command{
+	"cache":  {summary: "Inspect, clear or rebuild the local cache", run: runCache},
+	"config": {summary: "Get, set, list, edit or validate settings", run: runConfig},
+	"diff":   {summary: "Show what changed since a day (--since yesterday)", run: runDiff},
+	"login":  {summary: "Store and verify your Marcel CLI token", run: runLogin},
+	"logout": {summary: "Forget the stored token and clear the cache", run: runLogout},
+	"paths":  {summary: "Print where config, token, cache and data live", run: runPaths},
+}
+
+func Exists(name string) bool {
+	_, ok := registry[name]
+	return ok
+}
+
+func Run(name string, args []string) error {
+	cmd, ok := registry[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return cmd.run(args)
+}
+
+func Usage() string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("    %-12s %s\n", name, registry[name].summary))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
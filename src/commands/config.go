@@ -0,0 +1,403 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"marcel-cli/config"
+	"marcel-cli/ui"
+	"marcel-cli/ui/colors"
+
+	"golang.org/x/term"
+)
+
+const configUsage = "usage: marcel config get KEY | set KEY VALUE | unset KEY | list | explain KEY | edit | validate [FILE]"
+
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(configUsage)
+	}
+
+	path, err := config.FilePath()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "get":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: marcel config get KEY")
+		}
+		return configGet(path, args[1])
+	case "set":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: marcel config set KEY VALUE")
+		}
+		return configSet(path, args[1], args[2])
+	case "unset":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: marcel config unset KEY")
+		}
+		return configUnset(path, args[1])
+	case "list":
+		return configList(path)
+	case "explain":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: marcel config explain KEY")
+		}
+		return configExplain(args[1])
+	case "edit":
+		return configEdit(path)
+	case "validate":
+		if len(args) > 2 {
+			return fmt.Errorf("usage: marcel config validate [FILE]")
+		}
+		if len(args) == 2 {
+			path = args[1]
+		}
+		return configValidate(path)
+	default:
+		return fmt.Errorf("unknown config command %q\n%s", args[0], configUsage)
+	}
+}
+
+func configGet(path, name string) error {
+	key, ok := config.LookupKey(name)
+	if !ok {
+		return config.UnknownKey(name)
+	}
+
+	file, err := config.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if value, ok := file.Get(name); ok {
+		fmt.Println(value)
+	} else if value := key.Default(); value != "" && !strings.HasPrefix(name, "profiles.") {
+		fmt.Println(value)
+	}
+	return nil
+}
+
+func configSet(path, name, value string) error {
+	file, err := config.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := file.Set(name, value); err != nil {
+		return err
+	}
+	if err := validateFile(file); err != nil {
+		return fmt.Errorf("not saved, the config would be invalid:\n%w", err)
+	}
+	if err := file.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ %s = %s\n", name, value)
+	return nil
+}
+
+func configUnset(path, name string) error {
+	file, err := config.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	removed, err := file.Unset(name)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		fmt.Printf("%s is not set\n", name)
+		return nil
+	}
+	if err := file.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ %s unset\n", name)
+	return nil
+}
+
+func configList(path string) error {
+	file, err := config.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("# %s\n", path)
+	for _, key := range config.Schema {
+		if value, ok := file.Get(key.Name); ok {
+			fmt.Printf("%-18s %s\n", key.Name, value)
+		} else {
+			fmt.Printf("%-18s %s\n", key.Name, describeDefault(key.Default()))
+		}
+	}
+
+	if overrides := file.Colors(); len(overrides) > 0 {
+		fmt.Printf("\n# colors\n")
+		for _, name := range slices.Sorted(maps.Keys(overrides)) {
+			fmt.Printf("%-18s %s\n", "colors."+name, overrides[name])
+		}
+	}
+
+	if keys := file.Keys(); len(keys) > 0 {
+		fmt.Printf("\n# keys\n")
+		for _, action := range slices.Sorted(maps.Keys(keys)) {
+			fmt.Printf("%-18s [%s]\n", "keys."+action, strings.Join(keys[action], ", "))
+		}
+	}
+
+	if rewards := file.Rewards(); len(rewards) > 0 {
+		fmt.Printf("\n# rewards\n")
+		for _, name := range slices.Sorted(maps.Keys(rewards)) {
+			fmt.Printf("%-18s %d xp, %d gold\n", "rewards."+name, rewards[name].XP, rewards[name].Gold)
+		}
+	}
+
+	for _, profile := range file.Profiles() {
+		fmt.Printf("\n# profile %s\n", profile)
+		for _, key := range config.Schema {
+			name := "profiles." + profile + "." + key.Name
+			if value, ok := file.Get(name); ok {
+				fmt.Printf("%-18s %s\n", name, value)
+			}
+		}
+	}
+	return nil
+}
+
+// configExplain shows every layer that can set a key, highest precedence
+// first, and which one is in use.
+func configExplain(name string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if name == "token" {
+		return explainToken(cfg)
+	}
+
+	key, ok := config.LookupKey(name)
+	if !ok || strings.HasPrefix(name, "profiles.") {
+		return config.UnknownKey(name)
+	}
+
+	settings := cfg.Explain(name)
+	winner := settings[len(settings)-1]
+	byLayer := map[string]config.Setting{}
+	for _, setting := range settings {
+		byLayer[setting.Layer] = setting
+	}
+
+	fmt.Printf("%s = %s (from %s)\n\n", name, displayValue(winner.Value), winner.Layer)
+
+	profileOrigin := "no profile selected"
+	if !key.Profile {
+		profileOrigin = "not a profile setting"
+	} else if cfg.Profile != "" {
+		profileOrigin = "profiles." + cfg.Profile + "." + name
+	}
+
+	layers := []struct{ layer, origin string }{
+		{config.LayerFlag, "--" + key.Flag()},
+		{config.LayerEnv, key.EnvVar()},
+		{config.LayerProfile, profileOrigin},
+		{config.LayerFile, cfg.Paths.ConfigFile},
+		{config.LayerDefault, ""},
+	}
+	for _, l := range layers {
+		setting, set := byLayer[l.layer]
+		origin, value := l.origin, "(not set)"
+		if set {
+			if setting.Origin != "" {
+				origin = setting.Origin
+			}
+			value = displayValue(setting.Value)
+		}
+
+		marker := "  "
+		if set && setting == winner {
+			marker = "✓ "
+		}
+		fmt.Printf("%s%-8s %-40s %s\n", marker, l.layer, origin, value)
+	}
+	return nil
+}
+
+func explainToken(cfg *config.Config) error {
+	if cfg.TokenSource == "" {
+		fmt.Println("token is not set (run marcel login)")
+	} else {
+		fmt.Printf("token from %s\n", tokenLocation(cfg))
+	}
+	fmt.Printf("\nChecked in order: MARCEL_TOKEN_FD, MARCEL_TOKEN, token_command, %s, OS keyring\n", cfg.Paths.TokenFile)
+	return nil
+}
+
+func displayValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	return value
+}
+
+func describeDefault(value string) string {
+	if value == "" {
+		return "(not set)"
+	}
+	return value + " (default)"
+}
+
+// validateFile checks the file against the schema, its keys section against
+// the TUI's keymap and its colors section against the themes.
+func validateFile(file *config.File) error {
+	errs := []error{file.Validate()}
+	_, keyErr := ui.NewKeyMap(file.Keys())
+	for _, err := range []error{keyErr, colors.CheckOverrides(file.Colors())} {
+		if err == nil {
+			continue
+		}
+		for _, line := range strings.Split(err.Error(), "\n") {
+			errs = append(errs, fmt.Errorf("%s: %s", file.Path, line))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func configValidate(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		fmt.Printf("%s does not exist; marcel uses the defaults\n", path)
+		return nil
+	}
+
+	file, err := config.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := validateFile(file); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ %s is valid\n", path)
+	return nil
+}
+
+// configEdit opens a copy of the config file in $VISUAL or $EDITOR and only
+// replaces the real file once the copy validates.
+func configEdit(path string) error {
+	original, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		original = []byte(configTemplate())
+	} else if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.yml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(original)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := openEditor(tmp.Name()); err != nil {
+			return err
+		}
+
+		file, err := config.ReadFile(tmp.Name())
+		if err == nil {
+			file.Path = path
+			err = validateFile(file)
+		}
+		if err == nil {
+			if err := os.Chmod(tmp.Name(), 0644); err != nil {
+				return err
+			}
+			if err := os.Rename(tmp.Name(), path); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Saved %s\n", path)
+			return nil
+		}
+
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		if !confirm("Edit again?") {
+			return fmt.Errorf("changes discarded; %s was not modified", path)
+		}
+	}
+}
+
+func openEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+	return nil
+}
+
+func confirm(question string) bool {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false
+	}
+	fmt.Printf("%s [Y/n] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// configTemplate seeds a new config file with every key commented out at
+// its default.
+func configTemplate() string {
+	var sb strings.Builder
+	sb.WriteString("# marcel configuration. Uncomment a line to change it.\n")
+	for _, key := range config.Schema {
+		fmt.Fprintf(&sb, "\n# %s", key.Description)
+		if len(key.Values) > 0 {
+			fmt.Fprintf(&sb, " (%s)", strings.Join(key.Values, ", "))
+		}
+		fmt.Fprintf(&sb, "\n# %s\n", strings.TrimSpace(key.Name+": "+key.Default()))
+	}
+	sb.WriteString("\n# Colour overrides on top of the theme; quote hex colours.\n")
+	sb.WriteString("# colors:\n#   brand: \"#ff9600\"\n#   difficulty_epic: \"#ef4444\"\n")
+	sb.WriteString("\n# Key bindings by action; marcel --help lists the actions.\n")
+	sb.WriteString("# keys:\n#   toggle: [x, space]\n")
+	sb.WriteString("\n# XP and gold the local backend gives, by difficulty or for a habit.\n")
+	sb.WriteString("# rewards:\n#   epic: {xp: 100, gold: 40}\n#   habit: {xp: 15, gold: 5}\n")
+	sb.WriteString("\n# Named accounts, selected with --profile or MARCEL_PROFILE.\n")
+	sb.WriteString("# profiles:\n#   work:\n#     api_url: https://api.marcel.my\n#     token_command: pass show marcel-work\n")
+	return sb.String()
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"marcel-cli/history"
+	"marcel-cli/storage"
+)
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	since := fs.String("since", "yesterday", "First day to include: today, yesterday, 3d, 2w or YYYY-MM-DD")
+	until := fs.String("until", "today", "Last day to include")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	sinceDay, err := history.ParseDay(*since, now)
+	if err != nil {
+		return err
+	}
+	untilDay, err := history.ParseDay(*until, now)
+	if err != nil {
+		return err
+	}
+	if untilDay.Before(sinceDay) {
+		return fmt.Errorf("--until %s is before --since %s", *until, *since)
+	}
+
+	s, err := storage.Open()
+	if err != nil {
+		return err
+	}
+
+	report, err := history.Since(s, sinceDay, untilDay)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(report.Markdown())
+	return nil
+}
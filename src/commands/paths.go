@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"marcel-cli/config"
+)
+
+func runPaths(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: marcel paths")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	paths := cfg.Paths
+
+	if cfg.Profile != "" {
+		fmt.Printf("Profile:        %s\n", cfg.Profile)
+	}
+	fmt.Printf("Config file:    %s%s\n", paths.ConfigFile, missing(paths.ConfigFile))
+	fmt.Printf("Token:          %s\n", tokenLocation(cfg))
+	fmt.Printf("Cache:          %s\n", paths.CacheDir)
+	fmt.Printf("Database:       %s%s\n", filepath.Join(paths.CacheDir, "marcel.db"), missing(filepath.Join(paths.CacheDir, "marcel.db")))
+	fmt.Printf("Snapshots:      %s\n", filepath.Join(paths.StateDir, "history"))
+	fmt.Printf("Local data:     %s\n", filepath.Join(paths.StateDir, "local"))
+	if cfg.CacheKeyFile != "" {
+		fmt.Printf("Cache key file: %s\n", cfg.CacheKeyFile)
+	}
+	return nil
+}
+
+func tokenLocation(cfg *config.Config) string {
+	switch cfg.TokenSource {
+	case "":
+		return "not set (run marcel login)"
+	case config.TokenSourceFile:
+		return cfg.Paths.TokenFile
+	case config.TokenSourceKeyring:
+		return "OS keyring"
+	case config.TokenSourceCommand:
+		return "token_command: " + cfg.TokenCommand
+	default:
+		return cfg.TokenSource
+	}
+}
+
+func missing(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return " (not created yet)"
+	}
+	return ""
+}
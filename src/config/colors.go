@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Colors returns the colour overrides set in the file, by name.
+func (f *File) Colors() map[string]string {
+	_, node := mappingValue(f.root(), "colors")
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	var colors map[string]string
+	if err := node.Decode(&colors); err != nil {
+		return nil
+	}
+	return colors
+}
+
+// validateColors checks the shape of the colors section; which colours
+// exist and what counts as a colour is up to the TUI's theme.
+func (f *File) validateColors(colors *yaml.Node) []error {
+	if colors.Tag == "!!null" {
+		return nil
+	}
+	if colors.Kind != yaml.MappingNode {
+		return []error{f.lineError(colors, "colors: expected a mapping of colour names to colours")}
+	}
+
+	var errs []error
+	for i := 0; i+1 < len(colors.Content); i += 2 {
+		name, value := colors.Content[i].Value, colors.Content[i+1]
+		if value.Kind != yaml.ScalarNode || value.Value == "" {
+			errs = append(errs, f.lineError(value, fmt.Sprintf("colors.%s: expected a colour; quote hex colours, as in \"#ff9600\"", name)))
+		}
+	}
+	return errs
+}
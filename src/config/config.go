@@ -4,78 +4,232 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
-
-	"gopkg.in/yaml.v3"
+	"time"
 )
 
 const APIEndpoint = "https://api.marcel.my"
 
+const (
+	BackendAPI   = "api"
+	BackendLocal = "local"
+)
+
+const (
+	EncryptionNone       = "none"
+	EncryptionKeyring    = "keyring"
+	EncryptionPassphrase = "passphrase"
+	EncryptionKeyFile    = "keyfile"
+)
+
 type Config struct {
-	AuthToken    string `yaml:"-"`
-	WeekStartDay string `yaml:"week_start_day"`
+	AuthToken    string   `yaml:"-"`
+	TokenSource  string   `yaml:"-"`
+	TokenCommand string   `yaml:"token_command,omitempty"`
+	Profile      string   `yaml:"-"`
+	APIURL       string   `yaml:"api_url,omitempty"`
+	CacheDir     string   `yaml:"cache_dir,omitempty"`
+	Backend      string   `yaml:"backend"`
+	WeekStartDay string   `yaml:"week_start_day"`
+	MaxCacheAge  Duration `yaml:"max_cache_age"`
+	SyncInterval Duration `yaml:"sync_interval"`
+
+	Theme     string `yaml:"theme"`
+	ColorMode string `yaml:"color_mode"`
+
+	CacheEncryption string `yaml:"cache_encryption"`
+	CacheKeyFile    string `yaml:"cache_key_file,omitempty"`
+
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+
+	// Keys overrides the TUI's key bindings, by action.
+	Keys map[string]KeyList `yaml:"keys,omitempty"`
+	// Colors overrides single colours of the theme, by name.
+	Colors map[string]string `yaml:"colors,omitempty"`
+	// Rewards overrides what the local backend gives per difficulty.
+	Rewards map[string]Reward `yaml:"rewards,omitempty"`
+
+	Paths Paths `yaml:"-"`
+
+	settings map[string][]Setting
+
+	// Warnings are problems that should not stop marcel from starting.
+	Warnings []string `yaml:"-"`
+}
+
+// Profile is a named account under profiles in the config file. Empty fields
+// fall back to the top-level settings, except the token: a profile never
+// borrows the default account's token_command.
+type Profile struct {
+	APIURL       string `yaml:"api_url,omitempty"`
+	TokenCommand string `yaml:"token_command,omitempty"`
+	WeekStartDay string `yaml:"week_start_day,omitempty"`
+	CacheDir     string `yaml:"cache_dir,omitempty"`
 }
 
+func defaultConfig() *Config {
+	return &Config{
+		Backend:      BackendAPI,
+		APIURL:       APIEndpoint,
+		WeekStartDay: "sunday",
+		MaxCacheAge:  Duration{24 * time.Hour},
+		SyncInterval: Duration{5 * time.Minute},
+		Theme:        "default",
+		ColorMode:    "auto",
+
+		CacheEncryption: EncryptionNone,
+	}
+}
+
+// Load builds the config from defaults, the config file (if there is one;
+// marcel config set or edit creates it), the selected profile, MARCEL_*
+// environment variables and flags, each layer overriding the one before.
 func Load() (*Config, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get home directory: %w", err)
 	}
 
-	configPath := filepath.Join(homeDir, ".marcel.yml")
+	paths := defaultPaths(homeDir)
+	configPath, migrateErr := migrateConfigFile(homeDir, paths)
+	paths.ConfigFile = configPath
 
-	config := &Config{
-		AuthToken:    "",
-		WeekStartDay: "sunday",
+	config, err := build(paths)
+	if err != nil {
+		return nil, err
+	}
+	if migrateErr != nil {
+		config.Warnings = append(config.Warnings, migrateErr.Error())
 	}
+	config.resolvePaths(homeDir)
 
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		if err := config.Save(); err != nil {
-			return nil, fmt.Errorf("failed to create config file at %s: %w", configPath, err)
-		}
-	} else {
-		data, err := os.ReadFile(configPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read config file at %s: %w", configPath, err)
+	if err := config.loadToken(); err != nil {
+		return nil, err
+	}
+	for _, warning := range config.Warnings {
+		fmt.Fprintf(os.Stderr, "marcel: warning: %s\n", warning)
+	}
+
+	return config, nil
+}
+
+// build reads and validates the config file and layers it with the profile,
+// the environment and flags: the part of Load that can run again while
+// marcel is running.
+func build(paths Paths) (*Config, error) {
+	config := defaultConfig()
+	config.Paths = paths
+
+	file, err := ReadFile(paths.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+	if root := file.root(); root != nil {
+		if err := root.Decode(config); err != nil {
+			return nil, fmt.Errorf("%s: %w", paths.ConfigFile, err)
 		}
+	}
 
-		if err := yaml.Unmarshal(data, config); err != nil {
-			return nil, fmt.Errorf("invalid YAML format in %s: %w", configPath, err)
+	if err := config.applyLayers(file); err != nil {
+		return nil, err
+	}
+	config.normalize()
+	if config.CacheEncryption == EncryptionKeyFile && config.CacheKeyFile == "" {
+		return nil, fmt.Errorf("cache_encryption is keyfile but cache_key_file is not set")
+	}
+	return config, nil
+}
+
+// Reload reads the config file again. The result keeps the paths and token
+// the running marcel started with; Update decides what of it applies.
+func (c *Config) Reload() (*Config, error) {
+	next, err := build(c.Paths)
+	if err != nil {
+		return nil, err
+	}
+	next.Paths = c.Paths
+	next.AuthToken, next.TokenSource = c.AuthToken, c.TokenSource
+	return next, nil
+}
+
+// Update takes over the settings a running marcel can change on the fly:
+// live keys, key bindings and colour overrides. It returns the other keys
+// whose value changed, which only apply after a restart. None of what it
+// changes is read by storage, so saves and syncs can run during a reload.
+func (c *Config) Update(next *Config) (restart []string) {
+	for _, key := range Schema {
+		value := key.Value(next)
+		if key.Value(c) == value {
+			continue
+		}
+		if key.Live {
+			key.set(c, value)
+		} else {
+			restart = append(restart, key.Name)
 		}
 	}
+	c.Keys, c.Colors = next.Keys, next.Colors
+	return restart
+}
+
+// normalize fills in values left empty in the file and lowercases the ones
+// the schema compares case-insensitively.
+func (c *Config) normalize() {
+	defaults := defaultConfig()
 
-	tokenPath := filepath.Join(homeDir, ".marcel.token")
-	tokenBytes, err := os.ReadFile(tokenPath)
-	if err == nil && len(tokenBytes) > 0 {
-		config.AuthToken = strings.TrimSpace(string(tokenBytes))
-	} else {
-		config.AuthToken = os.Getenv("MARCEL_TOKEN")
+	c.Backend = strings.ToLower(c.Backend)
+	if c.Backend == "" {
+		c.Backend = defaults.Backend
 	}
 
-	if config.AuthToken == "" {
-		return nil, fmt.Errorf("authentication token not found: neither ~/.marcel.token file nor MARCEL_TOKEN environment variable is set")
+	c.APIURL = strings.TrimRight(c.APIURL, "/")
+	if c.APIURL == "" {
+		c.APIURL = defaults.APIURL
 	}
 
-	if config.WeekStartDay == "" {
-		config.WeekStartDay = "sunday"
+	c.WeekStartDay = strings.ToLower(c.WeekStartDay)
+	if c.WeekStartDay == "" {
+		c.WeekStartDay = defaults.WeekStartDay
 	}
-	config.WeekStartDay = strings.ToLower(config.WeekStartDay)
 
-	return config, nil
-}
+	c.Theme = strings.ToLower(c.Theme)
+	if c.Theme == "" {
+		c.Theme = defaults.Theme
+	}
 
-func (c *Config) Save() error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return err
+	c.ColorMode = strings.ToLower(c.ColorMode)
+	if c.ColorMode == "" {
+		c.ColorMode = defaults.ColorMode
 	}
 
-	configPath := filepath.Join(homeDir, ".marcel.yml")
+	c.CacheEncryption = strings.ToLower(c.CacheEncryption)
+	if c.CacheEncryption == "" {
+		c.CacheEncryption = defaults.CacheEncryption
+	}
+}
 
-	data, err := yaml.Marshal(c)
-	if err != nil {
-		return err
+func (c *Config) profileNames() string {
+	if len(c.Profiles) == 0 {
+		return "no profiles are defined in " + c.Paths.ConfigFile
+	}
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return "expected one of " + strings.Join(names, ", ")
+}
 
-	return os.WriteFile(configPath, data, 0644)
+func expandHome(path, homeDir string) string {
+	if path == "~" {
+		return homeDir
+	}
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(homeDir, path[2:])
+	}
+	return path
 }
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration that reads and writes as a string such as
+// "30m" or "24h" in the config file.
+type Duration struct {
+	time.Duration
+}
+
+// String drops zero units, so 24 hours reads as "24h" rather than "24h0m0s".
+func (d Duration) String() string {
+	s := d.Duration.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var raw string
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q (use values like 30m or 24h)", value.Line, raw)
+	}
+	if parsed < 0 {
+		return fmt.Errorf("line %d: duration %q must not be negative", value.Line, raw)
+	}
+
+	d.Duration = parsed
+	return nil
+}
@@ -0,0 +1,322 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"marcel-cli/fsutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the config file as written, comments and key order included, so
+// marcel config set and unset only touch the lines they change.
+type File struct {
+	Path string
+	doc  yaml.Node
+}
+
+// ReadFile parses the config file at path. A missing file reads as empty.
+func ReadFile(path string) (*File, error) {
+	f := &File{Path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file at %s: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, &f.doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (f *File) root() *yaml.Node {
+	if len(f.doc.Content) == 0 {
+		return nil
+	}
+	return f.doc.Content[0]
+}
+
+func (f *File) ensureRoot() *yaml.Node {
+	if f.root() == nil {
+		f.doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	return f.root()
+}
+
+// keyPath splits a key into the mapping keys that lead to it.
+func keyPath(name string) []string {
+	if profile, field, ok := splitProfileKey(name); ok {
+		return []string{"profiles", profile, field}
+	}
+	return []string{name}
+}
+
+func mappingValue(mapping *yaml.Node, key string) (int, *yaml.Node) {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return -1, nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i, mapping.Content[i+1]
+		}
+	}
+	return -1, nil
+}
+
+func (f *File) node(name string) *yaml.Node {
+	node := f.root()
+	for _, part := range keyPath(name) {
+		_, node = mappingValue(node, part)
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// Get returns the value set in the file, if any.
+func (f *File) Get(name string) (string, bool) {
+	node := f.node(name)
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return "", false
+	}
+	return node.Value, true
+}
+
+// Origin names the file and line a key is set on, as in "config.yml:3".
+func (f *File) Origin(name string) string {
+	if node := f.node(name); node != nil {
+		return fmt.Sprintf("%s:%d", f.Path, node.Line)
+	}
+	return f.Path
+}
+
+// Set validates value against the schema and writes it into the file.
+func (f *File) Set(name, value string) error {
+	key, ok := LookupKey(name)
+	if !ok {
+		return UnknownKey(name)
+	}
+	if err := key.Check(value); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	node := f.ensureRoot()
+	parts := keyPath(name)
+	for _, part := range parts[:len(parts)-1] {
+		_, child := mappingValue(node, part)
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: part}, child)
+		}
+		if child.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s is not a mapping in %s", part, f.Path)
+		}
+		node = child
+	}
+
+	last := parts[len(parts)-1]
+	if _, existing := mappingValue(node, last); existing != nil {
+		existing.Kind, existing.Tag, existing.Style, existing.Value, existing.Content = yaml.ScalarNode, "", 0, value, nil
+		return nil
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: last},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: value},
+	)
+	return nil
+}
+
+// Unset removes the key from the file and reports whether it was there.
+func (f *File) Unset(name string) (bool, error) {
+	if _, ok := LookupKey(name); !ok {
+		return false, UnknownKey(name)
+	}
+
+	parts := keyPath(name)
+	node := f.root()
+	for _, part := range parts[:len(parts)-1] {
+		_, node = mappingValue(node, part)
+	}
+
+	i, _ := mappingValue(node, parts[len(parts)-1])
+	if i < 0 {
+		return false, nil
+	}
+	node.Content = append(node.Content[:i], node.Content[i+2:]...)
+	return true, nil
+}
+
+// Save writes the file atomically, creating its directory if needed.
+func (f *File) Save() error {
+	data, err := f.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(f.Path, data, 0644)
+}
+
+func (f *File) Bytes() ([]byte, error) {
+	if f.root() == nil {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&f.doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// Profiles lists the profile names defined in the file.
+func (f *File) Profiles() []string {
+	_, profiles := mappingValue(f.root(), "profiles")
+	if profiles == nil || profiles.Kind != yaml.MappingNode {
+		return nil
+	}
+	var names []string
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		names = append(names, profiles.Content[i].Value)
+	}
+	return names
+}
+
+// Validate checks every key in the file against the schema. Each problem
+// names the line it is on.
+func (f *File) Validate() error {
+	root := f.root()
+	if root == nil {
+		return nil
+	}
+	if root.Kind != yaml.MappingNode {
+		return f.lineError(root, "expected key: value pairs at the top level")
+	}
+
+	var errs []error
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		keyNode, value := root.Content[i], root.Content[i+1]
+
+		if keyNode.Value == "profiles" {
+			errs = append(errs, f.validateProfiles(value)...)
+			continue
+		}
+		if keyNode.Value == "keys" {
+			errs = append(errs, f.validateKeys(value)...)
+			continue
+		}
+		if keyNode.Value == "colors" {
+			errs = append(errs, f.validateColors(value)...)
+			continue
+		}
+		if keyNode.Value == "rewards" {
+			errs = append(errs, f.validateRewards(value)...)
+			continue
+		}
+
+		key, ok := lookup(keyNode.Value)
+		if !ok {
+			errs = append(errs, f.lineError(keyNode, UnknownKey(keyNode.Value).Error()))
+			continue
+		}
+		errs = append(errs, f.validateValue(key, keyNode.Value, value))
+	}
+
+	if encryption, ok := f.Get("cache_encryption"); ok && strings.EqualFold(encryption, EncryptionKeyFile) {
+		if _, ok := f.Get("cache_key_file"); !ok {
+			_, node := mappingValue(root, "cache_encryption")
+			errs = append(errs, f.lineError(node, "cache_encryption is keyfile but cache_key_file is not set"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (f *File) validateProfiles(profiles *yaml.Node) []error {
+	if profiles.Kind != yaml.MappingNode {
+		return []error{f.lineError(profiles, "profiles: expected a mapping of profile names")}
+	}
+
+	var errs []error
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		name, profile := profiles.Content[i].Value, profiles.Content[i+1]
+		if profile.Kind != yaml.MappingNode {
+			if profile.Tag != "!!null" {
+				errs = append(errs, f.lineError(profile, fmt.Sprintf("profiles.%s: expected a mapping of settings", name)))
+			}
+			continue
+		}
+
+		for j := 0; j+1 < len(profile.Content); j += 2 {
+			keyNode, value := profile.Content[j], profile.Content[j+1]
+			fullName := "profiles." + name + "." + keyNode.Value
+
+			key, ok := lookup(keyNode.Value)
+			if !ok || !key.Profile {
+				errs = append(errs, f.lineError(keyNode, fmt.Sprintf("%s: not a profile setting (profiles can set %s)", fullName, profileKeyNames())))
+				continue
+			}
+			errs = append(errs, f.validateValue(key, fullName, value))
+		}
+	}
+	return errs
+}
+
+func (f *File) validateValue(key Key, name string, value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return f.lineError(value, name+": expected a single value")
+	}
+	if value.Tag == "!!null" {
+		return nil
+	}
+	if err := key.Check(value.Value); err != nil {
+		return f.lineError(value, fmt.Sprintf("%s: %v", name, err))
+	}
+	return nil
+}
+
+func (f *File) lineError(node *yaml.Node, msg string) error {
+	return fmt.Errorf("%s:%d: %s", f.Path, node.Line, msg)
+}
+
+// UnknownKey explains why name is not a key the config file accepts.
+func UnknownKey(name string) error {
+	if strings.HasPrefix(name, "keys.") {
+		return fmt.Errorf("%s is a key binding; change it with marcel config edit", name)
+	}
+	if strings.HasPrefix(name, "colors.") {
+		return fmt.Errorf("%s is a colour override; change it with marcel config edit", name)
+	}
+	if strings.HasPrefix(name, "rewards.") {
+		return fmt.Errorf("%s is a local reward; change it with marcel config edit", name)
+	}
+	if _, field, ok := splitProfileKey(name); ok {
+		if key, found := lookup(field); found && !key.Profile {
+			return fmt.Errorf("%s cannot be set per profile (profiles can set %s)", field, profileKeyNames())
+		}
+	}
+	return fmt.Errorf("unknown key %q (run marcel config list to see all keys)", name)
+}
+
+func profileKeyNames() string {
+	var names []string
+	for _, key := range Schema {
+		if key.Profile {
+			names = append(names, key.Name)
+		}
+	}
+	return orList(names)
+}
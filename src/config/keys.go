@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KeyList is the keys bound to one action under keys in the config file,
+// written either as a single key or as a list:
+//
+//	keys:
+//	  toggle: [x, space]
+//	  quit: ctrl+q
+type KeyList []string
+
+func (k *KeyList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*k = KeyList{value.Value}
+		return nil
+	}
+	var keys []string
+	if err := value.Decode(&keys); err != nil {
+		return err
+	}
+	*k = keys
+	return nil
+}
+
+// Keys returns the key bindings set in the file, by action.
+func (f *File) Keys() map[string]KeyList {
+	_, node := mappingValue(f.root(), "keys")
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	var keys map[string]KeyList
+	if err := node.Decode(&keys); err != nil {
+		return nil
+	}
+	return keys
+}
+
+// validateKeys checks the shape of the keys section; which actions exist
+// and whether bindings clash is up to the TUI's keymap.
+func (f *File) validateKeys(keys *yaml.Node) []error {
+	if keys.Tag == "!!null" {
+		return nil
+	}
+	if keys.Kind != yaml.MappingNode {
+		return []error{f.lineError(keys, "keys: expected a mapping of actions to keys")}
+	}
+
+	var errs []error
+	for i := 0; i+1 < len(keys.Content); i += 2 {
+		name, value := keys.Content[i].Value, keys.Content[i+1]
+		switch value.Kind {
+		case yaml.ScalarNode:
+			if value.Value == "" {
+				errs = append(errs, f.lineError(value, fmt.Sprintf("keys.%s: expected a key or a list of keys ([] unbinds it)", name)))
+			}
+		case yaml.SequenceNode:
+			for _, item := range value.Content {
+				if item.Kind != yaml.ScalarNode || item.Value == "" {
+					errs = append(errs, f.lineError(item, fmt.Sprintf("keys.%s: expected a key such as x, space or ctrl+x", name)))
+				}
+			}
+		default:
+			errs = append(errs, f.lineError(value, fmt.Sprintf("keys.%s: expected a key or a list of keys", name)))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Layers a setting can come from, lowest precedence first.
+const (
+	LayerDefault = "default"
+	LayerFile    = "file"
+	LayerProfile = "profile"
+	LayerEnv     = "env"
+	LayerFlag    = "flag"
+)
+
+// Setting is one layer's value for a key.
+type Setting struct {
+	Layer  string
+	Origin string
+	Value  string
+}
+
+var (
+	selectedProfile string
+	flagValues      = map[string]string{}
+)
+
+// UseProfile selects the profile Load applies, overriding MARCEL_PROFILE.
+func UseProfile(name string) {
+	selectedProfile = name
+}
+
+// UseFlag records a command line value for a key; it beats every other
+// layer when Load runs.
+func UseFlag(name, value string) {
+	flagValues[name] = value
+}
+
+// Explain lists every layer that set the key, lowest precedence first; the
+// last one is the value in use.
+func (c *Config) Explain(name string) []Setting {
+	return c.settings[name]
+}
+
+func (c *Config) apply(key Key, setting Setting) {
+	if key.set != nil {
+		key.set(c, setting.Value)
+	}
+	if c.settings == nil {
+		c.settings = map[string][]Setting{}
+	}
+	c.settings[key.Name] = append(c.settings[key.Name], setting)
+}
+
+func (c *Config) winner(name string) Setting {
+	settings := c.settings[name]
+	if len(settings) == 0 {
+		return Setting{Layer: LayerDefault}
+	}
+	return settings[len(settings)-1]
+}
+
+// applyLayers builds the config from defaults, the file, the selected
+// profile, MARCEL_* environment variables and flags, in that order.
+func (c *Config) applyLayers(file *File) error {
+	for _, key := range Schema {
+		c.apply(key, Setting{Layer: LayerDefault, Value: key.Default()})
+		if value, ok := file.Get(key.Name); ok && value != "" {
+			c.apply(key, Setting{Layer: LayerFile, Origin: file.Origin(key.Name), Value: value})
+		}
+	}
+
+	if err := c.applyProfile(file); err != nil {
+		return err
+	}
+
+	for _, key := range Schema {
+		if value := os.Getenv(key.EnvVar()); value != "" {
+			if err := key.Check(value); err != nil {
+				return fmt.Errorf("%s: %w", key.EnvVar(), err)
+			}
+			c.apply(key, Setting{Layer: LayerEnv, Origin: key.EnvVar(), Value: value})
+		}
+	}
+
+	for _, key := range Schema {
+		if value, ok := flagValues[key.Name]; ok {
+			if err := key.Check(value); err != nil {
+				return fmt.Errorf("--%s: %w", key.Flag(), err)
+			}
+			c.apply(key, Setting{Layer: LayerFlag, Origin: "--" + key.Flag(), Value: value})
+		}
+	}
+	return nil
+}
+
+// applyProfile layers the selected profile over the file. A profile never
+// borrows the default account's token_command.
+func (c *Config) applyProfile(file *File) error {
+	name := selectedProfile
+	if name == "" {
+		name = os.Getenv("MARCEL_PROFILE")
+	}
+	if name == "" {
+		return nil
+	}
+
+	if _, ok := c.Profiles[name]; !ok {
+		return fmt.Errorf("unknown profile %q: %s", name, c.profileNames())
+	}
+	c.Profile = name
+
+	if c.winner("token_command").Layer == LayerFile {
+		key, _ := lookup("token_command")
+		c.apply(key, Setting{Layer: LayerProfile, Origin: "profile " + name + " (not inherited)", Value: ""})
+	}
+
+	for _, key := range Schema {
+		if !key.Profile {
+			continue
+		}
+		fullName := "profiles." + name + "." + key.Name
+		if value, ok := file.Get(fullName); ok && value != "" {
+			c.apply(key, Setting{Layer: LayerProfile, Origin: file.Origin(fullName), Value: value})
+		}
+	}
+	return nil
+}
+
+// resolvePaths settles the data directories. Without cache_dir, data from
+// the legacy ~/.marcel/ directory is moved to the XDG cache and state
+// directories first. A cache_dir from the file is shared by all profiles,
+// each in its own profiles/<name> subdirectory; one from a profile, the
+// environment or a flag belongs to the active account alone.
+func (c *Config) resolvePaths(homeDir string) {
+	base := c.Paths
+	dir := expandHome(c.CacheDir, homeDir)
+	shared := c.winner("cache_dir").Layer == LayerFile
+
+	switch {
+	case dir == "":
+		legacyDir := filepath.Join(homeDir, ".marcel")
+		if err := migrateDataDir(legacyDir, base.CacheDir, base.StateDir); err != nil {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("%v; using %s", err, legacyDir))
+			base.CacheDir, base.StateDir = legacyDir, legacyDir
+		}
+	case shared || c.Profile == "":
+		base.CacheDir, base.StateDir = dir, dir
+	}
+	c.Paths = base
+
+	if c.Profile != "" {
+		c.Paths = base.forProfile(c.Profile, homeDir)
+		if dir != "" && !shared {
+			c.Paths.CacheDir, c.Paths.StateDir = dir, dir
+		}
+	}
+}
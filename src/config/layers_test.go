@@ -0,0 +1,136 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildLayers builds a config from a config file, environment variables,
+// flags and a profile, with every other MARCEL_* variable cleared.
+func buildLayers(t *testing.T, file string, env, flags map[string]string, profile string) (*Config, error) {
+	t.Helper()
+	for _, key := range Schema {
+		t.Setenv(key.EnvVar(), "")
+	}
+	t.Setenv("MARCEL_PROFILE", "")
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	flagValues = map[string]string{}
+	for name, value := range flags {
+		UseFlag(name, value)
+	}
+	UseProfile(profile)
+	t.Cleanup(func() {
+		flagValues = map[string]string{}
+		UseProfile("")
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return build(Paths{ConfigFile: path, CacheDir: dir, StateDir: dir})
+}
+
+func TestLayers(t *testing.T) {
+	const file = `week_start_day: monday
+api_url: https://file.example
+token_command: echo file
+profiles:
+  work:
+    api_url: https://work.example
+`
+
+	tests := []struct {
+		name      string
+		file      string
+		env       map[string]string
+		flags     map[string]string
+		profile   string
+		key       string
+		want      string
+		wantLayer string
+	}{
+		{"default", "", nil, nil, "", "week_start_day", "sunday", LayerDefault},
+		{"file", file, nil, nil, "", "week_start_day", "monday", LayerFile},
+		{"env beats file", file, map[string]string{"MARCEL_WEEK_START_DAY": "sunday"}, nil, "", "week_start_day", "sunday", LayerEnv},
+		{"flag beats env", file, map[string]string{"MARCEL_WEEK_START_DAY": "sunday"}, map[string]string{"week_start_day": "monday"}, "", "week_start_day", "monday", LayerFlag},
+		{"profile beats file", file, nil, nil, "work", "api_url", "https://work.example", LayerProfile},
+		{"env beats profile", file, map[string]string{"MARCEL_API_URL": "https://env.example"}, nil, "work", "api_url", "https://env.example", LayerEnv},
+		{"profile does not inherit token_command", file, nil, nil, "work", "token_command", "", LayerProfile},
+		{"profile from the environment", file, map[string]string{"MARCEL_PROFILE": "work"}, nil, "", "api_url", "https://work.example", LayerProfile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := buildLayers(t, tt.file, tt.env, tt.flags, tt.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, _ := lookup(tt.key)
+			if got := key.Value(c); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.key, got, tt.want)
+			}
+			if got := c.winner(tt.key).Layer; got != tt.wantLayer {
+				t.Errorf("%s came from %s, want %s", tt.key, got, tt.wantLayer)
+			}
+		})
+	}
+}
+
+func TestLayersRejectBadValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		flags   map[string]string
+		profile string
+	}{
+		{"env", "", map[string]string{"MARCEL_WEEK_START_DAY": "tuesday"}, nil, ""},
+		{"flag", "", nil, map[string]string{"sync_interval": "often"}, ""},
+		{"unknown profile", "", nil, nil, "home"},
+		{"reward without gold", "rewards:\n  epic: {xp: 100}\n", nil, nil, ""},
+		{"reward for an unknown difficulty", "rewards:\n  trivial: {xp: 1, gold: 1}\n", nil, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := buildLayers(t, tt.file, tt.env, tt.flags, tt.profile); err == nil {
+				t.Error("built a config, want an error")
+			}
+		})
+	}
+}
+
+func TestTokenPrecedence(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string
+		flags      map[string]string
+		wantToken  string
+		wantSource string
+	}{
+		{"MARCEL_TOKEN beats token_command from the file", "token_command: echo from-command\n", nil, "from-env", TokenSourceEnv},
+		{"token_command flag beats MARCEL_TOKEN", "", map[string]string{"token_command": "echo from-flag"}, "from-flag", TokenSourceCommand},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := buildLayers(t, tt.file, map[string]string{"MARCEL_TOKEN": "from-env", "MARCEL_TOKEN_FD": ""}, tt.flags, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Paths.TokenFile = filepath.Join(t.TempDir(), "token")
+			if err := c.loadToken(); err != nil {
+				t.Fatal(err)
+			}
+			if c.AuthToken != tt.wantToken || c.TokenSource != tt.wantSource {
+				t.Errorf("token %q from %s, want %q from %s", c.AuthToken, c.TokenSource, tt.wantToken, tt.wantSource)
+			}
+		})
+	}
+}
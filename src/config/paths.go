@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Paths is where marcel keeps its files. They follow the XDG base directory
+// spec; files from the old layout (~/.marcel.yml, ~/.marcel.token and
+// ~/.marcel/) are moved over on first start and used in place if they
+// cannot be.
+type Paths struct {
+	ConfigFile string
+	TokenFile  string
+	CacheDir   string // database and cache lock
+	StateDir   string // daily snapshots and local backend data
+
+	LegacyTokenFile string
+}
+
+func xdgDir(env, homeDir string, fallback ...string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "marcel")
+	}
+	return filepath.Join(append([]string{homeDir}, fallback...)...)
+}
+
+func defaultPaths(homeDir string) Paths {
+	configDir := xdgDir("XDG_CONFIG_HOME", homeDir, ".config", "marcel")
+	return Paths{
+		ConfigFile:      filepath.Join(configDir, "config.yml"),
+		TokenFile:       filepath.Join(configDir, "token"),
+		CacheDir:        xdgDir("XDG_CACHE_HOME", homeDir, ".cache", "marcel"),
+		StateDir:        xdgDir("XDG_STATE_HOME", homeDir, ".local", "state", "marcel"),
+		LegacyTokenFile: filepath.Join(homeDir, ".marcel.token"),
+	}
+}
+
+func migrateConfigFile(homeDir string, p Paths) (string, error) {
+	return migrateFile(filepath.Join(homeDir, ".marcel.yml"), p.ConfigFile)
+}
+
+// FilePath returns where the config file lives, without reading it, so a
+// broken file can still be found and fixed.
+func FilePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	path, _ := migrateConfigFile(homeDir, defaultPaths(homeDir))
+	return path, nil
+}
+
+func (p Paths) forProfile(name, homeDir string) Paths {
+	p.TokenFile = filepath.Join(filepath.Dir(p.TokenFile), name+".token")
+	p.LegacyTokenFile = filepath.Join(homeDir, ".marcel."+name+".token")
+	p.CacheDir = filepath.Join(p.CacheDir, "profiles", name)
+	p.StateDir = filepath.Join(p.StateDir, "profiles", name)
+	return p
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// migrateFile moves legacy to target unless target already exists, and
+// returns the path to use. Symlinked legacy files, as kept by dotfile
+// managers, are left where they are.
+func migrateFile(legacy, target string) (string, error) {
+	if exists(target) {
+		return target, nil
+	}
+	info, err := os.Lstat(legacy)
+	if err != nil {
+		return target, nil
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return legacy, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return legacy, fmt.Errorf("could not move %s to %s: %w", legacy, target, err)
+	}
+	if err := os.Rename(legacy, target); err != nil {
+		return legacy, fmt.Errorf("could not move %s to %s: %w", legacy, target, err)
+	}
+	return target, nil
+}
+
+type move struct {
+	from, to string
+}
+
+// legacyDataMoves lists what ~/.marcel/ holds and where each entry goes: the
+// database to the cache directory, snapshots and local data to the state
+// directory, and the same split for every profile.
+func legacyDataMoves(legacyDir, cacheDir, stateDir string) []move {
+	var moves []move
+	for _, name := range []string{"marcel.db", "cache.json"} {
+		moves = append(moves, move{filepath.Join(legacyDir, name), filepath.Join(cacheDir, name)})
+	}
+	for _, name := range []string{"history", "local"} {
+		moves = append(moves, move{filepath.Join(legacyDir, name), filepath.Join(stateDir, name)})
+	}
+
+	profiles, _ := os.ReadDir(filepath.Join(legacyDir, "profiles"))
+	for _, entry := range profiles {
+		if entry.IsDir() {
+			name := entry.Name()
+			moves = append(moves, legacyDataMoves(
+				filepath.Join(legacyDir, "profiles", name),
+				filepath.Join(cacheDir, "profiles", name),
+				filepath.Join(stateDir, "profiles", name),
+			)...)
+		}
+	}
+	return moves
+}
+
+// migrateDataDir moves the contents of the legacy ~/.marcel/ directory into
+// the XDG cache and state directories. It is all or nothing: if any entry
+// cannot be moved, the ones already moved are put back so the legacy
+// directory stays complete and usable.
+func migrateDataDir(legacyDir, cacheDir, stateDir string) error {
+	if exists(filepath.Join(cacheDir, "marcel.db")) || exists(filepath.Join(stateDir, "local")) {
+		return nil
+	}
+
+	var done []move
+	for _, m := range legacyDataMoves(legacyDir, cacheDir, stateDir) {
+		if !exists(m.from) || exists(m.to) {
+			continue
+		}
+
+		err := os.MkdirAll(filepath.Dir(m.to), 0700)
+		if err == nil {
+			err = os.Rename(m.from, m.to)
+		}
+		if err != nil {
+			for i := len(done) - 1; i >= 0; i-- {
+				os.Rename(done[i].to, done[i].from)
+			}
+			return fmt.Errorf("could not move %s to %s: %w", m.from, m.to, err)
+		}
+		done = append(done, m)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Reward is the XP and gold the local backend gives for a quest of one
+// difficulty, or for a habit, under rewards in the config file:
+//
+//	rewards:
+//	  epic: {xp: 120, gold: 50}
+//	  habit: {xp: 20, gold: 5}
+type Reward struct {
+	XP   int `yaml:"xp"`
+	Gold int `yaml:"gold"`
+}
+
+// rewardNames are the names the rewards section accepts.
+var rewardNames = []string{"easy", "medium", "hard", "epic", "legendary", "habit"}
+
+// Rewards returns the reward overrides set in the file, by name.
+func (f *File) Rewards() map[string]Reward {
+	_, node := mappingValue(f.root(), "rewards")
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	var rewards map[string]Reward
+	if err := node.Decode(&rewards); err != nil {
+		return nil
+	}
+	return rewards
+}
+
+// validateRewards checks that every reward names a difficulty or habit and
+// gives both xp and gold.
+func (f *File) validateRewards(rewards *yaml.Node) []error {
+	if rewards.Tag == "!!null" {
+		return nil
+	}
+	if rewards.Kind != yaml.MappingNode {
+		return []error{f.lineError(rewards, "rewards: expected a mapping of difficulties to rewards")}
+	}
+
+	var errs []error
+	for i := 0; i+1 < len(rewards.Content); i += 2 {
+		nameNode, value := rewards.Content[i], rewards.Content[i+1]
+		name := nameNode.Value
+		if !slices.Contains(rewardNames, name) {
+			errs = append(errs, f.lineError(nameNode, fmt.Sprintf("rewards.%s: expected %s", name, orList(rewardNames))))
+			continue
+		}
+
+		var r struct {
+			XP   *int `yaml:"xp"`
+			Gold *int `yaml:"gold"`
+		}
+		if value.Kind != yaml.MappingNode || value.Decode(&r) != nil || r.XP == nil || r.Gold == nil || *r.XP < 0 || *r.Gold < 0 {
+			errs = append(errs, f.lineError(value, fmt.Sprintf("rewards.%s: expected {xp: N, gold: N} with N 0 or more", name)))
+		}
+	}
+	return errs
+}
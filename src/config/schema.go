@@ -0,0 +1,214 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Key describes one setting in the config file. Profile keys can also be
+// set under profiles.<name>; live keys take effect in a running TUI when the
+// file changes.
+type Key struct {
+	Name        string
+	Description string
+	Values      []string
+	Profile     bool
+	Live        bool
+
+	check func(value string) error
+	get   func(c *Config) string
+	set   func(c *Config, value string)
+}
+
+var Schema = []Key{
+	{
+		Name:        "backend",
+		Description: "Where your data lives: your Marcel account or only this machine",
+		Values:      []string{BackendAPI, BackendLocal},
+		get:         func(c *Config) string { return c.Backend },
+		set:         func(c *Config, v string) { c.Backend = v },
+	},
+	{
+		Name:        "api_url",
+		Description: "Marcel server to talk to",
+		Profile:     true,
+		check:       checkURL,
+		get:         func(c *Config) string { return c.APIURL },
+		set:         func(c *Config, v string) { c.APIURL = v },
+	},
+	{
+		Name:        "token_command",
+		Description: "Shell command that prints the token, e.g. pass show marcel",
+		Profile:     true,
+		get:         func(c *Config) string { return c.TokenCommand },
+		set:         func(c *Config, v string) { c.TokenCommand = v },
+	},
+	{
+		Name:        "week_start_day",
+		Description: "First day of the week in the calendar",
+		Values:      []string{"sunday", "monday"},
+		Profile:     true,
+		Live:        true,
+		get:         func(c *Config) string { return c.WeekStartDay },
+		set:         func(c *Config, v string) { c.WeekStartDay = v },
+	},
+	{
+		Name:        "theme",
+		Description: "Colour theme of the TUI",
+		Values:      []string{"default", "catppuccin", "gruvbox", "solarized", "high-contrast", "colour-blind-safe"},
+		Live:        true,
+		get:         func(c *Config) string { return c.Theme },
+		set:         func(c *Config, v string) { c.Theme = v },
+	},
+	{
+		Name:        "color_mode",
+		Description: "Use the theme's light or dark variant; auto asks the terminal",
+		Values:      []string{"auto", "light", "dark"},
+		Live:        true,
+		get:         func(c *Config) string { return c.ColorMode },
+		set:         func(c *Config, v string) { c.ColorMode = v },
+	},
+	{
+		Name:        "max_cache_age",
+		Description: "Cached data older than this is refreshed before the TUI opens",
+		check:       checkDuration,
+		get:         func(c *Config) string { return c.MaxCacheAge.String() },
+		set:         func(c *Config, v string) { c.MaxCacheAge = parseDuration(v) },
+	},
+	{
+		Name:        "sync_interval",
+		Description: "How often the TUI syncs in the background; 0 turns it off",
+		check:       checkDuration,
+		get:         func(c *Config) string { return c.SyncInterval.String() },
+		set:         func(c *Config, v string) { c.SyncInterval = parseDuration(v) },
+	},
+	{
+		Name:        "cache_encryption",
+		Description: "How the local cache is encrypted",
+		Values:      []string{EncryptionNone, EncryptionKeyring, EncryptionPassphrase, EncryptionKeyFile},
+		get:         func(c *Config) string { return c.CacheEncryption },
+		set:         func(c *Config, v string) { c.CacheEncryption = v },
+	},
+	{
+		Name:        "cache_key_file",
+		Description: "Key file used with cache_encryption: keyfile",
+		get:         func(c *Config) string { return c.CacheKeyFile },
+		set:         func(c *Config, v string) { c.CacheKeyFile = v },
+	},
+	{
+		Name:        "cache_dir",
+		Description: "Keep the cache, snapshots and local data in this directory",
+		Profile:     true,
+		get:         func(c *Config) string { return c.CacheDir },
+		set:         func(c *Config, v string) { c.CacheDir = v },
+	},
+}
+
+// LookupKey finds a top-level key, or a profile key written as
+// profiles.<name>.<key>.
+func LookupKey(name string) (Key, bool) {
+	if profile, field, ok := splitProfileKey(name); ok {
+		key, found := lookup(field)
+		if !found || !key.Profile || profile == "" {
+			return Key{}, false
+		}
+		key.Name = name
+		return key, true
+	}
+	return lookup(name)
+}
+
+func lookup(name string) (Key, bool) {
+	for _, key := range Schema {
+		if key.Name == name {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+func splitProfileKey(name string) (profile, field string, ok bool) {
+	rest, ok := strings.CutPrefix(name, "profiles.")
+	if !ok {
+		return "", "", false
+	}
+	i := strings.LastIndex(rest, ".")
+	if i < 0 {
+		return "", "", false
+	}
+	return rest[:i], rest[i+1:], true
+}
+
+// Check reports whether value is allowed for the key.
+func (k Key) Check(value string) error {
+	if len(k.Values) > 0 {
+		if !slices.Contains(k.Values, strings.ToLower(value)) {
+			return fmt.Errorf("invalid value %q (expected %s)", value, orList(k.Values))
+		}
+		return nil
+	}
+	if k.check != nil {
+		return k.check(value)
+	}
+	return nil
+}
+
+// Default is the value used when the key is not set.
+func (k Key) Default() string {
+	if k.get == nil {
+		return ""
+	}
+	return k.get(defaultConfig())
+}
+
+// EnvVar is the environment variable that overrides the key.
+func (k Key) EnvVar() string {
+	return "MARCEL_" + strings.ToUpper(k.Name)
+}
+
+// Flag is the command line flag that overrides the key.
+func (k Key) Flag() string {
+	return strings.ReplaceAll(k.Name, "_", "-")
+}
+
+// Value is the key's value in a loaded config.
+func (k Key) Value(c *Config) string {
+	if k.get == nil {
+		return ""
+	}
+	return k.get(c)
+}
+
+func checkDuration(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q (use values like 30m or 24h)", value)
+	}
+	if d < 0 {
+		return fmt.Errorf("duration %q must not be negative", value)
+	}
+	return nil
+}
+
+func parseDuration(value string) Duration {
+	d, _ := time.ParseDuration(value)
+	return Duration{d}
+}
+
+func checkURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL %q (expected an http or https URL)", value)
+	}
+	return nil
+}
+
+func orList(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+}
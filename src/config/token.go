@@ -0,0 +1,217 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"marcel-cli/fsutil"
+
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	keyringService   = "marcel-cli"
+	keyringTokenUser = "token"
+
+	tokenCommandTimeout = 10 * time.Second
+)
+
+const (
+	TokenSourceFD      = "MARCEL_TOKEN_FD"
+	TokenSourceCommand = "token_command"
+	TokenSourceFile    = "token file"
+	TokenSourceEnv     = "MARCEL_TOKEN"
+	TokenSourceKeyring = "keyring"
+)
+
+func (c *Config) keyringUser() string {
+	if c.Profile != "" {
+		return keyringTokenUser + ":" + c.Profile
+	}
+	return keyringTokenUser
+}
+
+// loadToken sets the token from the first source that has one, following
+// the same precedence as every other setting: token_command given as a
+// flag, the environment (MARCEL_TOKEN_FD, then MARCEL_TOKEN), token_command
+// from the environment or a file, the token file and finally the OS keyring.
+// The explicit sources fail loudly instead of falling through to the others.
+func (c *Config) loadToken() error {
+	path, err := migrateFile(c.Paths.LegacyTokenFile, c.Paths.TokenFile)
+	if err != nil {
+		c.Warnings = append(c.Warnings, err.Error())
+	}
+	c.Paths.TokenFile = path
+
+	if c.TokenCommand != "" && c.winner("token_command").Layer == LayerFlag {
+		return c.runTokenCommand()
+	}
+
+	if fd := os.Getenv("MARCEL_TOKEN_FD"); fd != "" {
+		token, err := readTokenFD(fd)
+		if err != nil {
+			return err
+		}
+		c.AuthToken, c.TokenSource = token, TokenSourceFD
+		return nil
+	}
+
+	if token := os.Getenv("MARCEL_TOKEN"); token != "" {
+		c.AuthToken, c.TokenSource = token, TokenSourceEnv
+		return nil
+	}
+
+	if c.TokenCommand != "" {
+		return c.runTokenCommand()
+	}
+
+	if data, err := os.ReadFile(path); err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			c.checkTokenFileMode(path)
+			c.AuthToken, c.TokenSource = token, TokenSourceFile
+			return nil
+		}
+	}
+
+	if token, err := keyring.Get(keyringService, c.keyringUser()); err == nil && token != "" {
+		c.AuthToken, c.TokenSource = token, TokenSourceKeyring
+	}
+	return nil
+}
+
+func (c *Config) runTokenCommand() error {
+	token, err := runTokenCommand(c.TokenCommand)
+	if err != nil {
+		return err
+	}
+	c.AuthToken, c.TokenSource = token, TokenSourceCommand
+	return nil
+}
+
+func readTokenFD(value string) (string, error) {
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < 0 {
+		return "", fmt.Errorf("invalid MARCEL_TOKEN_FD %q: expected a file descriptor number", value)
+	}
+
+	file := os.NewFile(uintptr(fd), "token-fd")
+	if file == nil {
+		return "", fmt.Errorf("invalid MARCEL_TOKEN_FD %d", fd)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token from file descriptor %d: %w", fd, err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("file descriptor %d from MARCEL_TOKEN_FD was empty", fd)
+	}
+	return token, nil
+}
+
+// runTokenCommand runs token_command through the shell, e.g.
+// "pass show marcel", and uses the first line it prints.
+func runTokenCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenCommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("token_command timed out after %s", tokenCommandTimeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("token_command failed: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("token_command failed: %w", err)
+	}
+
+	token, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("token_command printed no token")
+	}
+	return token, nil
+}
+
+// checkTokenFileMode warns when other users can read the token file.
+func (c *Config) checkTokenFileMode(path string) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("%s is readable by other users (mode %04o); run chmod 600 %s or move the token to the keyring with marcel login", path, perm, path))
+	}
+}
+
+// SaveToken stores the token in the OS keyring and removes plaintext token
+// files that would otherwise shadow it. Without a secret service the token
+// goes to the token file with mode 0600. It returns where the token went.
+func (c *Config) SaveToken(token string) (string, error) {
+	if err := keyring.Set(keyringService, c.keyringUser(), token); err == nil {
+		if err := c.removeTokenFiles(); err != nil {
+			return "", fmt.Errorf("token stored in the OS keyring, but %w", err)
+		}
+		return "the OS keyring", nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.Paths.TokenFile), 0700); err != nil {
+		return "", err
+	}
+	if err := fsutil.WriteFileAtomic(c.Paths.TokenFile, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return c.Paths.TokenFile, nil
+}
+
+func (c *Config) removeTokenFiles() error {
+	for _, path := range []string{c.Paths.TokenFile, c.Paths.LegacyTokenFile} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("%s could not be removed: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// DeleteToken removes the token from both the OS keyring and the token files.
+func (c *Config) DeleteToken() error {
+	if err := c.removeTokenFiles(); err != nil {
+		return err
+	}
+
+	err := keyring.Delete(keyringService, c.keyringUser())
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		if _, getErr := keyring.Get(keyringService, c.keyringUser()); getErr == nil {
+			return err
+		}
+	}
+	return nil
+}
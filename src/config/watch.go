@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch calls onChange when the config file at path is written, replaced or
+// removed. Editors that save by renaming a new file into place are covered
+// because the directory is watched rather than the file, and so is the
+// target of a symlinked config file. The returned function stops watching.
+func Watch(path string, onChange func()) (func() error, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{filepath.Base(path): true}
+	dirs := []string{filepath.Dir(path)}
+	if target, err := filepath.EvalSymlinks(path); err == nil && target != path {
+		names[filepath.Base(target)] = true
+		dirs = append(dirs, filepath.Dir(target))
+	}
+
+	if err := os.MkdirAll(dirs[0], 0700); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	var mu sync.Mutex
+	var debounce *time.Timer
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !names[filepath.Base(event.Name)] || event.Op == fsnotify.Chmod {
+					continue
+				}
+				mu.Lock()
+				if debounce != nil {
+					debounce.Stop()
+				}
+				debounce = time.AfterFunc(150*time.Millisecond, onChange)
+				mu.Unlock()
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+
+	return watcher.Close, nil
+}
@@ -0,0 +1,47 @@
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+type Lock struct {
+	file *os.File
+}
+
+// AcquireLock takes an exclusive advisory lock on path, creating it if
+// needed, and waits up to timeout for other processes to release it.
+func AcquireLock(path string, timeout time.Duration) (*Lock, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLock(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if ok {
+			return &Lock{file: file}, nil
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, fmt.Errorf("timed out waiting for lock on %s: another marcel instance is busy", path)
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+}
+
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	unlock(l.file)
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package fsutil
+
+import "os"
+
+func tryLock(file *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlock(file *os.File) {}
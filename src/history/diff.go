@@ -0,0 +1,256 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"marcel-cli/models"
+	"marcel-cli/storage"
+)
+
+type Entry struct {
+	ID     int
+	Title  string
+	Detail string
+}
+
+type Section struct {
+	Title   string
+	Entries []Entry
+}
+
+// Report describes what changed between two snapshots.
+type Report struct {
+	From time.Time
+	To   time.Time
+
+	QuestsCreated   []Entry
+	QuestsCompleted []Entry
+	QuestsEdited    []Entry
+	QuestsDeleted   []Entry
+	HabitCheckIns   []Entry
+	EventsCreated   []Entry
+	EventsEdited    []Entry
+	EventsDeleted   []Entry
+}
+
+func (r Report) Sections() []Section {
+	all := []Section{
+		{"Quests created", r.QuestsCreated},
+		{"Quests completed", r.QuestsCompleted},
+		{"Quests edited", r.QuestsEdited},
+		{"Quests deleted", r.QuestsDeleted},
+		{"Habit check-ins", r.HabitCheckIns},
+		{"Events added", r.EventsCreated},
+		{"Events changed", r.EventsEdited},
+		{"Events removed", r.EventsDeleted},
+	}
+
+	var sections []Section
+	for _, section := range all {
+		if len(section.Entries) > 0 {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+func (r Report) Empty() bool {
+	return len(r.Sections()) == 0
+}
+
+// Markdown renders the report as a list that can be pasted into standup notes.
+func (r Report) Markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## Changes %s → %s\n", r.From.Format("Mon Jan 2"), r.To.Format("Mon Jan 2"))
+
+	if r.Empty() {
+		sb.WriteString("\nNo changes.\n")
+		return sb.String()
+	}
+
+	for _, section := range r.Sections() {
+		fmt.Fprintf(&sb, "\n### %s\n", section.Title)
+		for _, e := range section.Entries {
+			if e.Detail != "" {
+				fmt.Fprintf(&sb, "- %s (%s)\n", e.Title, e.Detail)
+			} else {
+				fmt.Fprintf(&sb, "- %s\n", e.Title)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// Compare diffs two snapshots. Reopening a quest counts as an edit; a quest
+// that was both completed and edited is only reported as completed.
+func Compare(from, to *storage.CacheData) Report {
+	report := Report{From: from.Timestamp.Local(), To: to.Timestamp.Local()}
+
+	journeyNames := map[int]string{}
+	for _, j := range from.Journeys {
+		journeyNames[j.ID] = j.Name
+	}
+	for _, j := range to.Journeys {
+		journeyNames[j.ID] = j.Name
+	}
+
+	oldQuests := map[int]models.Quest{}
+	for _, q := range from.Quests {
+		oldQuests[q.ID] = q
+	}
+	for _, q := range to.Quests {
+		old, existed := oldQuests[q.ID]
+		delete(oldQuests, q.ID)
+
+		switch {
+		case !existed:
+			detail := q.Difficulty
+			if q.Done {
+				detail = strings.TrimPrefix(detail+", done", ", ")
+			}
+			report.QuestsCreated = append(report.QuestsCreated, Entry{q.ID, q.Title, detail})
+		case q.Done && !old.Done:
+			report.QuestsCompleted = append(report.QuestsCompleted, Entry{q.ID, q.Title, rewardDetail(q.XPReward, q.GoldReward)})
+		default:
+			if changes := questChanges(old, q, journeyNames); len(changes) > 0 {
+				report.QuestsEdited = append(report.QuestsEdited, Entry{q.ID, q.Title, strings.Join(changes, ", ")})
+			}
+		}
+	}
+	for _, q := range oldQuests {
+		report.QuestsDeleted = append(report.QuestsDeleted, Entry{q.ID, q.Title, ""})
+	}
+
+	oldHabits := map[int]models.Habit{}
+	for _, h := range from.Habits {
+		oldHabits[h.ID] = h
+	}
+	for _, h := range to.Habits {
+		seen := map[string]bool{}
+		for _, day := range oldHabits[h.ID].Completed {
+			seen[day] = true
+		}
+		var days []string
+		for _, day := range h.Completed {
+			if !seen[day] {
+				days = append(days, formatDay(day))
+			}
+		}
+		if len(days) > 0 {
+			report.HabitCheckIns = append(report.HabitCheckIns, Entry{h.ID, h.Name, strings.Join(days, ", ")})
+		}
+	}
+
+	oldEvents := map[int]models.Event{}
+	for _, e := range from.Events {
+		oldEvents[e.ID] = e
+	}
+	for _, e := range to.Events {
+		old, existed := oldEvents[e.ID]
+		delete(oldEvents, e.ID)
+
+		if !existed {
+			report.EventsCreated = append(report.EventsCreated, Entry{e.ID, e.Title, e.Date.Local().Format("Mon Jan 2")})
+		} else if changes := eventChanges(old, e); len(changes) > 0 {
+			report.EventsEdited = append(report.EventsEdited, Entry{e.ID, e.Title, strings.Join(changes, ", ")})
+		}
+	}
+	for _, e := range oldEvents {
+		report.EventsDeleted = append(report.EventsDeleted, Entry{e.ID, e.Title, e.Date.Local().Format("Mon Jan 2")})
+	}
+
+	for _, entries := range []*[]Entry{
+		&report.QuestsCreated, &report.QuestsCompleted, &report.QuestsEdited, &report.QuestsDeleted,
+		&report.HabitCheckIns, &report.EventsCreated, &report.EventsEdited, &report.EventsDeleted,
+	} {
+		sort.Slice(*entries, func(i, j int) bool { return (*entries)[i].ID < (*entries)[j].ID })
+	}
+
+	return report
+}
+
+func questChanges(old, q models.Quest, journeyNames map[int]string) []string {
+	var changes []string
+	if old.Done && !q.Done {
+		changes = append(changes, "reopened")
+	}
+	if old.Title != q.Title {
+		changes = append(changes, fmt.Sprintf("renamed from %q", old.Title))
+	}
+	if old.Note != q.Note {
+		changes = append(changes, "note")
+	}
+	if old.Difficulty != q.Difficulty {
+		changes = append(changes, fmt.Sprintf("difficulty %s → %s", old.Difficulty, q.Difficulty))
+	}
+	if deref(old.Date) != deref(q.Date) || deref(old.Time) != deref(q.Time) {
+		changes = append(changes, "rescheduled")
+	}
+	if journeyID(old.JourneyID) != journeyID(q.JourneyID) {
+		name := journeyNames[journeyID(q.JourneyID)]
+		if q.JourneyID == nil || name == "" {
+			name = "My Quests"
+		}
+		changes = append(changes, "moved to "+name)
+	}
+	return changes
+}
+
+func eventChanges(old, e models.Event) []string {
+	var changes []string
+	if old.Title != e.Title {
+		changes = append(changes, fmt.Sprintf("renamed from %q", old.Title))
+	}
+	if !old.Date.Equal(e.Date) || deref(old.Time) != deref(e.Time) ||
+		!timesEqual(old.EndDate, e.EndDate) || deref(old.EndTime) != deref(e.EndTime) {
+		changes = append(changes, "moved to "+e.Date.Local().Format("Mon Jan 2"))
+	}
+	if deref(old.Location) != deref(e.Location) {
+		changes = append(changes, "location")
+	}
+	if deref(old.Description) != deref(e.Description) {
+		changes = append(changes, "description")
+	}
+	return changes
+}
+
+func rewardDetail(xp, gold int) string {
+	if xp == 0 && gold == 0 {
+		return ""
+	}
+	return fmt.Sprintf("+%d XP, +%d gold", xp, gold)
+}
+
+func formatDay(day string) string {
+	if len(day) > 10 {
+		day = day[:10]
+	}
+	if t, err := time.Parse("2006-01-02", day); err == nil {
+		return t.Format("Mon Jan 2")
+	}
+	return day
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func journeyID(id *int) int {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+func timesEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,85 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"marcel-cli/storage"
+)
+
+var ErrNoHistory = errors.New("no snapshots yet: one is recorded each day marcel syncs with the server")
+
+// relativeDay matches a number of days or weeks ago with exactly one unit.
+var relativeDay = regexp.MustCompile(`^(\d+)([dw])$`)
+
+// ParseDay accepts "today", "yesterday", a number of days or weeks ago
+// ("3d", "2w") or a date ("2006-01-02"), and returns local midnight of it.
+func ParseDay(value string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	switch value {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	}
+
+	if match := relativeDay.FindStringSubmatch(value); match != nil {
+		if n, err := strconv.Atoi(match[1]); err == nil {
+			if match[2] == "w" {
+				n *= 7
+			}
+			return today.AddDate(0, 0, -n), nil
+		}
+	}
+
+	if day, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return day, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid day %q: expected today, yesterday, 3d, 2w or YYYY-MM-DD", value)
+}
+
+// Since compares the state at the end of the day before since with the
+// newest snapshot taken on or before until. If history does not reach back
+// that far, the oldest snapshot is used as the starting point.
+func Since(s storage.SnapshotStore, since, until time.Time) (Report, error) {
+	snapshots, err := s.Snapshots()
+	if err != nil {
+		return Report{}, err
+	}
+
+	var base, target *storage.Snapshot
+	for i := range snapshots {
+		if snapshots[i].Day.After(until) {
+			break
+		}
+		if snapshots[i].Day.Before(since) {
+			base = &snapshots[i]
+		}
+		target = &snapshots[i]
+	}
+
+	if target == nil {
+		return Report{}, ErrNoHistory
+	}
+	if base == nil {
+		base = &snapshots[0]
+	}
+
+	from, err := s.LoadSnapshot(*base)
+	if err != nil {
+		return Report{}, err
+	}
+	to, err := s.LoadSnapshot(*target)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return Compare(from, to), nil
+}
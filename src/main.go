@@ -4,7 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 
+	"marcel-cli/commands"
+	"marcel-cli/config"
+	"marcel-cli/storage"
 	"marcel-cli/ui"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -15,8 +20,39 @@ var version = "dev"
 func main() {
 	var showVersion = flag.Bool("version", false, "Show version information")
 	var showHelp = flag.Bool("help", false, "Show help information")
+	var noCache = flag.Bool("no-cache", false, "Ignore cached data and load everything from the server")
+	var cacheOnly = flag.Bool("cache-only", false, "Use cached data only and never contact the server")
+	var profile = flag.String("profile", "", "Use a profile from the config file")
+
+	settings := map[string]string{}
+	for _, key := range config.Schema {
+		flag.String(key.Flag(), "", key.Description)
+		settings[key.Flag()] = key.Name
+	}
 	flag.Parse()
 
+	if *profile != "" {
+		config.UseProfile(*profile)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if name, ok := settings[f.Name]; ok {
+			config.UseFlag(name, f.Value.String())
+		}
+	})
+
+	if flag.NArg() > 0 {
+		name := flag.Arg(0)
+		if !commands.Exists(name) {
+			fmt.Fprintf(os.Stderr, "marcel: unknown command %q\n\nCommands:\n%s\n", name, commands.Usage())
+			os.Exit(2)
+		}
+		if err := commands.Run(name, flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "marcel: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *showVersion {
 		fmt.Printf("marcel version %s\n", version)
 		return
@@ -27,47 +63,102 @@ func main() {
 		return
 	}
 
-	model, err := ui.NewModel()
+	s, err := storage.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	model, err := ui.NewModel(s, ui.Options{
+		NoCache:   *noCache,
+		CacheOnly: *cacheOnly,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	p := tea.NewProgram(model, tea.WithAltScreen())
 
+	if stopWatching, err := model.WatchCache(p.Send); err == nil {
+		defer stopWatching()
+	}
+	if stopWatching, err := model.WatchConfig(p.Send); err == nil {
+		defer stopWatching()
+	}
+
 	if _, err := p.Run(); err != nil {
 		log.Fatal(err)
 	}
 }
 
 func showHelpText() {
-	fmt.Println(`Marcel CLI - Gamified productivity TUI application
+	fmt.Printf(`Marcel CLI - Gamified productivity TUI application
 
 USAGE:
     marcel [OPTIONS]
+    marcel [--profile NAME] <COMMAND> [ARGS]
+
+COMMANDS:
+%s
 
 OPTIONS:
     --version    Show version information
     --help       Show this help message
+    --no-cache   Ignore cached data and load everything from the server
+    --cache-only Use cached data only and never contact the server
+    --profile    Use a named profile from the config file (or set MARCEL_PROFILE)
+
+    Every config key can also be given as a flag or a MARCEL_ environment
+    variable, e.g. --week-start-day monday or MARCEL_WEEK_START_DAY=monday.
+    Flags beat the environment, which beats the profile, then the config
+    file, then the defaults. marcel config explain KEY shows which won.
 
 KEYBOARD CONTROLS:
 
-Quest View:
-    j/k, arrows  Navigate quests
-    gg           Jump to top
-    G            Jump to bottom
-    Space        Toggle quest completion
-    ?            Show/hide help
-    q, Ctrl+C    Quit
+%s
+    Forms: enter confirms a field, esc cancels.
 
-Input Mode:
-    Type         Enter text
-    Enter        Confirm
-    Esc          Cancel
-    Backspace    Delete character
+    Rebind any action under keys in the config file, as a key or a list:
+        keys:
+          toggle: [x, space]
+          history: []        # unbind
+    Action names: %s
 
 CONFIGURATION:
-    Auth token: Create ~/.marcel.token file with your token
-                OR set MARCEL_TOKEN environment variable
+    Auth token: run marcel login (or just marcel) and paste your token
+                OR set token_command in the config file (e.g. pass show marcel)
+                OR set MARCEL_TOKEN_FD or MARCEL_TOKEN environment variable
+
+    The config file is ~/.config/marcel/config.yml; run marcel paths to
+    see where the token, cache and snapshots live.
+
+    profiles in the config file hold extra accounts, each with its own
+    api_url, token_command, week_start_day and cache_dir.
+
+    theme (default, catppuccin, gruvbox, solarized, high-contrast or
+    colour-blind-safe) and color_mode (auto, light or dark) set the colours;
+    colors in the config file overrides single ones. NO_COLOR turns colour off.
+    The TUI applies changes to these, week_start_day and keys as soon as the
+    config file is saved.
+
+    backend: local keeps everything on this machine,
+    without an account or token.
 
-For more information, visit: https://github.com/marcel-org/cli`)
+    max_cache_age (default 24h): cached data older than
+    this is refreshed before the TUI opens instead of in the background.
+
+    sync_interval (default 5m): how often the TUI syncs
+    in the background. It backs off while offline; 0 turns it off.
+
+For more information, visit: https://github.com/marcel-org/cli
+`, commands.Usage(), indent(ui.DefaultKeyMap().HelpText(), "    "), strings.Join(ui.KeyActions(), ", "))
+}
+
+func indent(text, prefix string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
 }
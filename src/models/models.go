@@ -66,6 +66,24 @@ type Event struct {
 	UpdatedAt        time.Time  `json:"updatedAt"`
 }
 
+type User struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+func (u User) DisplayName() string {
+	switch {
+	case u.Name != "":
+		return u.Name
+	case u.Username != "":
+		return u.Username
+	default:
+		return u.Email
+	}
+}
+
 type AppData struct {
 	Journeys       []Journey
 	Habits         []Habit
@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"marcel-cli/config"
+
+	"github.com/zalando/go-keyring"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+const (
+	keyringService = "marcel-cli"
+	keyringUser    = "cache-key"
+
+	// sealedPrefix marks an encrypted value. JSON never starts with it, so
+	// plaintext and sealed rows can be told apart.
+	sealedPrefix = 0x01
+)
+
+var (
+	metaKDFSalt  = []byte("kdf_salt")
+	metaKeyCheck = []byte("key_check")
+	keyCheck     = []byte("marcel cache key check")
+
+	errWrongKey       = errors.New("cache key does not match: the cache was encrypted with a different key or passphrase")
+	errCacheLocked    = errors.New("cache passphrase required: restart marcel to enter it, or set MARCEL_CACHE_PASSPHRASE")
+	errCacheEncrypted = errors.New("cache is encrypted but cache_encryption is \"none\": set it back, or run `marcel cache clear --all`")
+)
+
+// sealer encrypts cache values with XChaCha20-Poly1305. The bucket and key
+// of each row are bound as additional data so rows cannot be swapped. A nil
+// sealer stores plaintext.
+type sealer struct {
+	aead cipher.AEAD
+}
+
+func (sc *sealer) seal(bucket, key, plaintext []byte) ([]byte, error) {
+	if sc == nil {
+		return plaintext, nil
+	}
+
+	nonce := make([]byte, sc.aead.NonceSize(), 1+sc.aead.NonceSize()+len(plaintext)+sc.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{sealedPrefix}, nonce...)
+	return sc.aead.Seal(out, nonce, plaintext, rowAD(bucket, key)), nil
+}
+
+func (sc *sealer) open(bucket, key, value []byte) ([]byte, error) {
+	sealed := len(value) > 0 && value[0] == sealedPrefix
+	if sc == nil {
+		if sealed {
+			return nil, errCacheEncrypted
+		}
+		return value, nil
+	}
+	if !sealed {
+		return nil, fmt.Errorf("%w: unencrypted %s row in encrypted cache", errCorruptCache, bucket)
+	}
+
+	nonceSize := sc.aead.NonceSize()
+	if len(value) < 1+nonceSize {
+		return nil, fmt.Errorf("%w: truncated %s row", errCorruptCache, bucket)
+	}
+	plaintext, err := sc.aead.Open(nil, value[1:1+nonceSize], value[1+nonceSize:], rowAD(bucket, key))
+	if err != nil {
+		return nil, errWrongKey
+	}
+	return plaintext, nil
+}
+
+func rowAD(bucket, key []byte) []byte {
+	return append(append(append([]byte{}, bucket...), 0), key...)
+}
+
+// loadSealer resolves the cache key once per process. For passphrases the
+// scrypt salt lives unencrypted in the meta bucket; a sealed check value lets
+// a wrong key fail up front instead of looking like a corrupt cache.
+func (s *Storage) loadSealer() error {
+	s.sealerMu.Lock()
+	defer s.sealerMu.Unlock()
+	if s.sealerLoaded.Load() {
+		return nil
+	}
+
+	mode := s.config.CacheEncryption
+	dbPath, err := s.getDBPath()
+	if err != nil {
+		return err
+	}
+
+	if mode == config.EncryptionNone {
+		if _, err := os.Stat(dbPath); err == nil {
+			var encrypted bool
+			err := s.viewDB(func(tx *bolt.Tx) error {
+				encrypted = tx.Bucket(bucketMeta) != nil && tx.Bucket(bucketMeta).Get(metaKeyCheck) != nil
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if encrypted {
+				return errCacheEncrypted
+			}
+		}
+		s.sealerLoaded.Store(true)
+		return nil
+	}
+
+	var salt []byte
+	err = s.updateDB(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		if meta.Get(metaKDFSalt) == nil {
+			fresh := make([]byte, 16)
+			if _, err := rand.Read(fresh); err != nil {
+				return err
+			}
+			if err := meta.Put(metaKDFSalt, fresh); err != nil {
+				return err
+			}
+		}
+		salt = append([]byte{}, meta.Get(metaKDFSalt)...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The key is resolved outside any transaction so a passphrase prompt
+	// never holds the database open.
+	key, err := s.cacheKey(salt)
+	if err != nil {
+		return err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return err
+	}
+	sc := &sealer{aead: aead}
+
+	fresh := false
+	err = s.updateDB(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		if check := meta.Get(metaKeyCheck); check != nil {
+			plaintext, err := sc.open(bucketMeta, metaKeyCheck, check)
+			if err != nil || !bytes.Equal(plaintext, keyCheck) {
+				return errWrongKey
+			}
+			return nil
+		}
+
+		check, err := sc.seal(bucketMeta, metaKeyCheck, keyCheck)
+		if err != nil {
+			return err
+		}
+		if err := meta.Put(metaKeyCheck, check); err != nil {
+			return err
+		}
+		fresh = true
+		return sealExistingTx(tx, sc)
+	})
+	if err != nil {
+		// Ask again next time rather than keep a wrong passphrase.
+		s.passphrase = ""
+		return err
+	}
+
+	if fresh {
+		if err := s.sealSnapshots(sc); err != nil {
+			return err
+		}
+	}
+	s.sealer.Store(sc)
+	s.sealerLoaded.Store(true)
+	return nil
+}
+
+// viewDB and updateDB run a transaction without the checks of withDB, for
+// the code that sets the database up.
+func (s *Storage) viewDB(fn func(tx *bolt.Tx) error) error {
+	return s.useDB(false, func(db *bolt.DB) error { return db.View(fn) })
+}
+
+func (s *Storage) updateDB(fn func(tx *bolt.Tx) error) error {
+	return s.useDB(true, func(db *bolt.DB) error { return db.Update(fn) })
+}
+
+// sealExistingTx encrypts rows written before encryption was turned on.
+// Snapshots are handled by sealSnapshots.
+func sealExistingTx(tx *bolt.Tx, sc *sealer) error {
+	for _, name := range [][]byte{bucketJourneys, bucketQuests, bucketHabits, bucketEvents, bucketPending} {
+		b := tx.Bucket(name)
+		rows := map[string][]byte{}
+		err := b.ForEach(func(k, v []byte) error {
+			if len(v) > 0 && v[0] != sealedPrefix {
+				rows[string(k)] = append([]byte{}, v...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for k, v := range rows {
+			sealed, err := sc.seal(name, []byte(k), v)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(k), sealed); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Storage) cacheKey(salt []byte) ([]byte, error) {
+	switch s.config.CacheEncryption {
+	case config.EncryptionKeyring:
+		return keyringKey()
+	case config.EncryptionKeyFile:
+		return keyFileKey(s.config.CacheKeyFile)
+	case config.EncryptionPassphrase:
+		// The passphrase is kept so that a cache cleared and created again
+		// does not have to ask for it.
+		if s.passphrase == "" {
+			passphrase, err := readPassphrase(!s.noPrompt)
+			if err != nil {
+				return nil, err
+			}
+			s.passphrase = passphrase
+		}
+		return scrypt.Key([]byte(s.passphrase), salt, 1<<15, 8, 1, chacha20poly1305.KeySize)
+	}
+	return nil, fmt.Errorf("unknown cache_encryption %q", s.config.CacheEncryption)
+}
+
+func newRandomKey() ([]byte, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func keyringKey() ([]byte, error) {
+	secret, err := keyring.Get(keyringService, keyringUser)
+	if errors.Is(err, keyring.ErrNotFound) {
+		key, err := newRandomKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := keyring.Set(keyringService, keyringUser, hex.EncodeToString(key)); err != nil {
+			return nil, fmt.Errorf("failed to store cache key in the OS keyring: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache key from the OS keyring: %w", err)
+	}
+	return decodeKey(secret)
+}
+
+func keyFileKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, fmt.Errorf("cache_encryption is \"keyfile\" but cache_key_file is not set")
+	}
+	if strings.HasPrefix(path, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(homeDir, path[2:])
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		key, err := newRandomKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to create cache key file %s: %w", path, err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache key file %s: %w", path, err)
+	}
+
+	if len(data) == chacha20poly1305.KeySize {
+		return data, nil
+	}
+	key, err := decodeKey(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("cache key file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("expected a %d-byte hex-encoded key", chacha20poly1305.KeySize)
+	}
+	return key, nil
+}
+
+// readPassphrase takes the passphrase from MARCEL_CACHE_PASSPHRASE or, if
+// prompt is set, asks for it on the terminal.
+func readPassphrase(prompt bool) (string, error) {
+	if passphrase := os.Getenv("MARCEL_CACHE_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	if !prompt {
+		return "", errCacheLocked
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("cache passphrase required: set MARCEL_CACHE_PASSPHRASE or run marcel in a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, "Cache passphrase: ")
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(passphrase) == 0 {
+		return "", fmt.Errorf("cache passphrase must not be empty")
+	}
+	return string(passphrase), nil
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"marcel-cli/config"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func newTestSealer(t *testing.T, fill byte) *sealer {
+	t.Helper()
+	aead, err := chacha20poly1305.NewX(bytes.Repeat([]byte{fill}, chacha20poly1305.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sealer{aead: aead}
+}
+
+func TestSealerOpen(t *testing.T) {
+	sc := newTestSealer(t, 1)
+	plaintext := []byte(`{"id":1}`)
+	sealed, err := sc.seal(bucketQuests, []byte("1"), plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		sc      *sealer
+		bucket  []byte
+		key     []byte
+		value   []byte
+		want    []byte
+		wantErr string
+	}{
+		{"round trip", sc, bucketQuests, []byte("1"), sealed, plaintext, ""},
+		{"wrong key", newTestSealer(t, 2), bucketQuests, []byte("1"), sealed, nil, "does not match"},
+		{"row moved to another key", sc, bucketQuests, []byte("2"), sealed, nil, "does not match"},
+		{"row moved to another bucket", sc, bucketHabits, []byte("1"), sealed, nil, "does not match"},
+		{"truncated row", sc, bucketQuests, []byte("1"), sealed[:5], nil, "truncated"},
+		{"plaintext row in an encrypted cache", sc, bucketQuests, []byte("1"), plaintext, nil, "unencrypted"},
+		{"sealed row without a key", nil, bucketQuests, []byte("1"), sealed, nil, "cache is encrypted"},
+		{"plaintext without a key", nil, bucketQuests, []byte("1"), plaintext, plaintext, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.sc.open(tt.bucket, tt.key, tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("opened %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSealUsesFreshNonces(t *testing.T) {
+	sc := newTestSealer(t, 1)
+	a, _ := sc.seal(bucketQuests, []byte("1"), []byte("same"))
+	b, _ := sc.seal(bucketQuests, []byte("1"), []byte("same"))
+	if bytes.Equal(a, b) {
+		t.Error("sealing the same value twice gave the same bytes")
+	}
+}
+
+func TestEncryptedCacheKey(t *testing.T) {
+	dir := t.TempDir()
+	open := func(encryption, keyFile string) *Storage {
+		s := newTestStorage(t, "http://127.0.0.1:0")
+		s.config.Paths = config.Paths{CacheDir: dir, StateDir: dir}
+		s.config.CacheEncryption = encryption
+		s.config.CacheKeyFile = keyFile
+		return s
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "cache.key")
+	s := open(config.EncryptionKeyFile, keyFile)
+	if err := s.writeCache(&CacheData{}); err != nil {
+		t.Fatal(err)
+	}
+	s.closeDB()
+
+	tests := []struct {
+		name       string
+		encryption string
+		keyFile    string
+		wantErr    error
+	}{
+		{"same key", config.EncryptionKeyFile, keyFile, nil},
+		{"other key", config.EncryptionKeyFile, filepath.Join(t.TempDir(), "other.key"), errWrongKey},
+		{"encryption turned off", config.EncryptionNone, "", errCacheEncrypted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := open(tt.encryption, tt.keyFile)
+			defer s.closeDB()
+			if _, err := s.readCache(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("readCache error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
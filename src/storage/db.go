@@ -0,0 +1,540 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"marcel-cli/fsutil"
+	"marcel-cli/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketMeta     = []byte("meta")
+	bucketJourneys = []byte("journeys")
+	bucketQuests   = []byte("quests")
+	bucketHabits   = []byte("habits")
+	bucketEvents   = []byte("events")
+	bucketPending  = []byte("pending")
+
+	indexQuestsByJourney = []byte("idx_quests_journey")
+	indexQuestsByDate    = []byte("idx_quests_date")
+	indexQuestsByDone    = []byte("idx_quests_done")
+	indexEventsByDate    = []byte("idx_events_date")
+
+	metaTimestamp = []byte("timestamp")
+	metaRevision  = []byte("revision")
+	metaWriter    = []byte("writer")
+	pendingKey    = []byte("queue")
+)
+
+// instanceID identifies this process as the writer of a revision, so the
+// cache watcher can ignore changes it made itself.
+var instanceID = fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+
+var allBuckets = [][]byte{
+	bucketMeta, bucketJourneys, bucketQuests, bucketHabits, bucketEvents, bucketPending,
+	indexQuestsByJourney, indexQuestsByDate, indexQuestsByDone, indexEventsByDate,
+}
+
+var (
+	errNoCache = errors.New("no cached data")
+	// errCorruptCache marks cached data that cannot be decoded as this build
+	// expects. Only such data is thrown away; other read errors leave it be.
+	errCorruptCache = errors.New("corrupt cache")
+)
+
+func (s *Storage) getDBPath() (string, error) {
+	cachePath, err := s.getCachePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(cachePath), "marcel.db"), nil
+}
+
+func (s *Storage) lockCache() (*fsutil.Lock, error) {
+	dbPath, err := s.getDBPath()
+	if err != nil {
+		return nil, err
+	}
+	return fsutil.AcquireLock(filepath.Join(filepath.Dir(dbPath), "cache.lock"), 10*time.Second)
+}
+
+// withLockedDB runs a write transaction while holding the cross-process
+// cache lock.
+func (s *Storage) withLockedDB(fn func(tx *bolt.Tx) error) error {
+	lock, err := s.lockCache()
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	return s.withDB(true, fn)
+}
+
+func bumpRevisionTx(tx *bolt.Tx) error {
+	meta := tx.Bucket(bucketMeta)
+
+	revision := make([]byte, 8)
+	if current := meta.Get(metaRevision); len(current) == 8 {
+		binary.BigEndian.PutUint64(revision, binary.BigEndian.Uint64(current)+1)
+	} else {
+		binary.BigEndian.PutUint64(revision, 1)
+	}
+
+	if err := meta.Put(metaRevision, revision); err != nil {
+		return err
+	}
+	return meta.Put(metaWriter, []byte(instanceID))
+}
+
+func revisionTx(tx *bolt.Tx) (uint64, string) {
+	meta := tx.Bucket(bucketMeta)
+	if meta == nil {
+		return 0, ""
+	}
+	var revision uint64
+	if v := meta.Get(metaRevision); len(v) == 8 {
+		revision = binary.BigEndian.Uint64(v)
+	}
+	return revision, string(meta.Get(metaWriter))
+}
+
+func (s *Storage) openDB(writable bool) (*bolt.DB, error) {
+	dbPath, err := s.getDBPath()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{
+		Timeout:  5 * time.Second,
+		ReadOnly: !writable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache database at %s: %w", dbPath, err)
+	}
+	if writable {
+		os.Chmod(dbPath, 0600)
+	}
+
+	if writable {
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, name := range allBuckets {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// dbIdleTimeout is how long the database handle stays open after its last
+// transaction. bbolt locks the file while it is open, so a handle kept for
+// the lifetime of the TUI would block every other marcel process; closing
+// it once idle lets them in, while a burst of transactions, such as a sync,
+// shares one open.
+const dbIdleTimeout = time.Second
+
+// useDB runs fn with the shared database handle, opening it, or reopening
+// it writable, as needed. Transactions of this process take turns on it.
+func (s *Storage) useDB(writable bool, fn func(db *bolt.DB) error) error {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	if s.db != nil && writable && s.db.IsReadOnly() {
+		s.closeDBLocked()
+	}
+	if s.db == nil {
+		db, err := s.openDB(writable)
+		if err != nil {
+			return err
+		}
+		s.db = db
+	}
+
+	s.dbUses++
+	uses := s.dbUses
+	time.AfterFunc(dbIdleTimeout, func() {
+		s.dbMu.Lock()
+		defer s.dbMu.Unlock()
+		if s.dbUses == uses {
+			s.closeDBLocked()
+		}
+	})
+	return fn(s.db)
+}
+
+func (s *Storage) closeDBLocked() error {
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
+
+// closeDB closes the shared handle, for instance before the file goes away.
+func (s *Storage) closeDB() error {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+	return s.closeDBLocked()
+}
+
+// withDB runs a single transaction on the shared handle.
+func (s *Storage) withDB(writable bool, fn func(tx *bolt.Tx) error) error {
+	dbPath, err := s.getDBPath()
+	if err != nil {
+		return err
+	}
+
+	if err := s.setUp(dbPath, writable); err != nil {
+		return err
+	}
+
+	return s.useDB(writable, func(db *bolt.DB) error {
+		if writable {
+			return db.Update(fn)
+		}
+		return db.View(fn)
+	})
+}
+
+// setUp imports a legacy cache, loads the sealer and migrates the schema
+// before the first transaction. Concurrent callers wait for one another, so
+// this happens once.
+func (s *Storage) setUp(dbPath string, writable bool) error {
+	s.setupMu.Lock()
+	defer s.setupMu.Unlock()
+
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		if err := s.importLegacyCache(); err != nil {
+			return err
+		}
+		if _, err := os.Stat(dbPath); os.IsNotExist(err) && !writable {
+			return errNoCache
+		}
+	}
+
+	if err := s.loadSealer(); err != nil {
+		return err
+	}
+	return s.ensureSchema()
+}
+
+// unlockCache sets the database up now, creating it if needed, so that the
+// cache key is resolved while marcel still owns the terminal. From then on
+// the storage never prompts for a passphrase.
+func (s *Storage) unlockCache() error {
+	dbPath, err := s.getDBPath()
+	if err != nil {
+		return err
+	}
+	err = s.setUp(dbPath, true)
+	s.noPrompt = true
+	return err
+}
+
+// idKey encodes an ID so that byte order matches numeric order, including
+// the negative placeholder IDs used for offline creates.
+func idKey(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(int64(id))^(1<<63))
+	return key
+}
+
+func keyID(key []byte) int {
+	return int(int64(binary.BigEndian.Uint64(key[len(key)-8:]) ^ (1 << 63)))
+}
+
+func indexKey(prefix []byte, id int) []byte {
+	return append(append(append([]byte{}, prefix...), 0), idKey(id)...)
+}
+
+func questIndexes(q models.Quest) map[string][]byte {
+	indexes := map[string][]byte{}
+
+	journeyID := 0
+	if q.JourneyID != nil {
+		journeyID = *q.JourneyID
+	}
+	indexes[string(indexQuestsByJourney)] = indexKey(idKey(journeyID), q.ID)
+
+	if q.Date != nil && *q.Date != "" {
+		date := *q.Date
+		if len(date) > 10 {
+			date = date[:10]
+		}
+		indexes[string(indexQuestsByDate)] = indexKey([]byte(date), q.ID)
+	}
+
+	done := []byte("0")
+	if q.Done {
+		done = []byte("1")
+	}
+	indexes[string(indexQuestsByDone)] = indexKey(done, q.ID)
+
+	return indexes
+}
+
+func eventIndexes(e models.Event) map[string][]byte {
+	return map[string][]byte{
+		string(indexEventsByDate): indexKey([]byte(e.Date.Local().Format("2006-01-02")), e.ID),
+	}
+}
+
+func putIndexes(tx *bolt.Tx, indexes map[string][]byte) error {
+	for bucket, key := range indexes {
+		if err := tx.Bucket([]byte(bucket)).Put(key, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteIndexes(tx *bolt.Tx, indexes map[string][]byte) error {
+	for bucket, key := range indexes {
+		if err := tx.Bucket([]byte(bucket)).Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncBucket upserts items into bucket, only touching rows whose encoding
+// changed, and deletes rows that are no longer present.
+func syncBucket[T any](tx *bolt.Tx, sc *sealer, bucket []byte, items []T, id func(T) int, indexes func(T) map[string][]byte) error {
+	b := tx.Bucket(bucket)
+	seen := make(map[string]bool, len(items))
+
+	for _, item := range items {
+		key := idKey(id(item))
+		seen[string(key)] = true
+
+		value, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+
+		var existing []byte
+		if stored := b.Get(key); stored != nil {
+			existing, _ = sc.open(bucket, key, stored)
+		}
+		if existing != nil && bytes.Equal(existing, value) {
+			continue
+		}
+
+		if existing != nil && indexes != nil {
+			var old T
+			if err := json.Unmarshal(existing, &old); err == nil {
+				if err := deleteIndexes(tx, indexes(old)); err != nil {
+					return err
+				}
+			}
+		}
+
+		sealed, err := sc.seal(bucket, key, value)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(key, sealed); err != nil {
+			return err
+		}
+
+		if indexes != nil {
+			if err := putIndexes(tx, indexes(item)); err != nil {
+				return err
+			}
+		}
+	}
+
+	var stale [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		if seen[string(k)] {
+			return nil
+		}
+		stale = append(stale, append([]byte{}, k...))
+		if indexes != nil {
+			plaintext, err := sc.open(bucket, k, v)
+			if err != nil {
+				return nil
+			}
+			var old T
+			if err := json.Unmarshal(plaintext, &old); err == nil {
+				return deleteIndexes(tx, indexes(old))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range stale {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readBucket[T any](tx *bolt.Tx, sc *sealer, bucket []byte) ([]T, error) {
+	var items []T
+	b := tx.Bucket(bucket)
+	if b == nil {
+		return items, nil
+	}
+
+	err := b.ForEach(func(k, v []byte) error {
+		plaintext, err := sc.open(bucket, k, v)
+		if err != nil {
+			return err
+		}
+		var item T
+		if err := json.Unmarshal(plaintext, &item); err != nil {
+			return fmt.Errorf("%w: %s row %d: %w", errCorruptCache, bucket, keyID(k), err)
+		}
+		items = append(items, item)
+		return nil
+	})
+	return items, err
+}
+
+// countIndex counts the rows an index files under prefix, without reading
+// the rows themselves.
+func countIndex(tx *bolt.Tx, index, prefix []byte) int {
+	idx := tx.Bucket(index)
+	if idx == nil {
+		return 0
+	}
+
+	prefix = append(append([]byte{}, prefix...), 0)
+	count := 0
+	c := idx.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		count++
+	}
+	return count
+}
+
+func readCacheTx(tx *bolt.Tx, sc *sealer) (*CacheData, error) {
+	meta := tx.Bucket(bucketMeta)
+	if meta == nil || meta.Get(metaTimestamp) == nil {
+		return nil, errNoCache
+	}
+
+	cache := &CacheData{Version: schemaVersionTx(tx)}
+	if err := cache.Timestamp.UnmarshalText(meta.Get(metaTimestamp)); err != nil {
+		return nil, fmt.Errorf("%w: timestamp: %w", errCorruptCache, err)
+	}
+
+	var err error
+	if cache.Journeys, err = readBucket[models.Journey](tx, sc, bucketJourneys); err != nil {
+		return nil, err
+	}
+	if cache.Quests, err = readBucket[models.Quest](tx, sc, bucketQuests); err != nil {
+		return nil, err
+	}
+	if cache.Habits, err = readBucket[models.Habit](tx, sc, bucketHabits); err != nil {
+		return nil, err
+	}
+	if cache.Events, err = readBucket[models.Event](tx, sc, bucketEvents); err != nil {
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+func writeCacheTx(tx *bolt.Tx, sc *sealer, cache *CacheData) error {
+	journeys := make([]models.Journey, 0, len(cache.Journeys))
+	for _, j := range cache.Journeys {
+		if j.ID == 0 {
+			continue
+		}
+		j.Quests = nil
+		journeys = append(journeys, j)
+	}
+
+	if err := syncBucket(tx, sc, bucketJourneys, journeys, func(j models.Journey) int { return j.ID }, nil); err != nil {
+		return err
+	}
+	if err := syncBucket(tx, sc, bucketQuests, cache.Quests, func(q models.Quest) int { return q.ID }, questIndexes); err != nil {
+		return err
+	}
+	if err := syncBucket(tx, sc, bucketHabits, cache.Habits, func(h models.Habit) int { return h.ID }, nil); err != nil {
+		return err
+	}
+	if err := syncBucket(tx, sc, bucketEvents, cache.Events, func(e models.Event) int { return e.ID }, eventIndexes); err != nil {
+		return err
+	}
+
+	timestamp, err := cache.Timestamp.MarshalText()
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketMeta).Put(metaTimestamp, timestamp); err != nil {
+		return err
+	}
+	return bumpRevisionTx(tx)
+}
+
+// importLegacyCache moves a cache.json written by older versions into the
+// database once. The file is deleted once the import has committed, so an
+// encrypted cache never has a readable copy next to it.
+func (s *Storage) importLegacyCache() error {
+	cachePath, err := s.getCachePath()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil
+	}
+
+	if err := s.loadSealer(); err != nil {
+		return err
+	}
+
+	err = s.updateDB(func(tx *bolt.Tx) error {
+		var cache CacheData
+		if err := json.Unmarshal(data, &cache); err != nil {
+			return nil
+		}
+		return writeCacheTx(tx, s.sealer.Load(), &cache)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", cachePath, err)
+	}
+
+	if err := os.Remove(cachePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("imported %s but could not delete it: %w", cachePath, err)
+	}
+	return nil
+}
+
+func (s *Storage) CacheTimestamp() (time.Time, error) {
+	var timestamp time.Time
+	err := s.withDB(false, func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		if meta == nil || meta.Get(metaTimestamp) == nil {
+			return errNoCache
+		}
+		return timestamp.UnmarshalText(meta.Get(metaTimestamp))
+	})
+	return timestamp, err
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"marcel-cli/models"
+)
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// habitSchedule is how the local backend reads a habit's cycle. Weekly habits
+// take {"days": ["mon", "thu"]} (or weekday numbers, 0 = Sunday) and default
+// to the weekday they started on; interval habits take {"every": 3}.
+type habitSchedule struct {
+	cycle string
+	days  map[time.Weekday]bool
+	every int
+	start time.Time
+	end   *time.Time
+}
+
+func newHabitSchedule(h models.Habit) habitSchedule {
+	schedule := habitSchedule{
+		cycle: h.CycleType,
+		days:  map[time.Weekday]bool{},
+		every: 1,
+		start: startOfDay(h.StartDate),
+	}
+	if h.EndDate != nil {
+		end := startOfDay(*h.EndDate)
+		schedule.end = &end
+	}
+
+	config, _ := h.CycleConfig.(map[string]any)
+
+	if days, ok := config["days"].([]any); ok {
+		for _, d := range days {
+			switch v := d.(type) {
+			case float64:
+				schedule.days[time.Weekday(int(v)%7)] = true
+			case string:
+				for i, name := range weekdayNames {
+					if strings.HasPrefix(strings.ToLower(v), name) {
+						schedule.days[time.Weekday(i)] = true
+					}
+				}
+			}
+		}
+	}
+	if len(schedule.days) == 0 {
+		schedule.days[schedule.start.Weekday()] = true
+	}
+
+	if every, ok := config["every"].(float64); ok && every >= 1 {
+		schedule.every = int(every)
+	}
+
+	return schedule
+}
+
+func (hs habitSchedule) isDue(day time.Time) bool {
+	if day.Before(hs.start) || (hs.end != nil && day.After(*hs.end)) {
+		return false
+	}
+
+	switch hs.cycle {
+	case "weekly":
+		return hs.days[day.Weekday()]
+	case "interval":
+		return daysBetween(hs.start, day)%hs.every == 0
+	default:
+		return true
+	}
+}
+
+func (hs habitSchedule) describe() string {
+	switch hs.cycle {
+	case "weekly":
+		var names []string
+		for i, name := range weekdayNames {
+			if hs.days[time.Weekday(i)] {
+				names = append(names, strings.ToUpper(name[:1])+name[1:])
+			}
+		}
+		return "Every " + strings.Join(names, ", ")
+	case "interval":
+		if hs.every == 1 {
+			return "Every day"
+		}
+		return fmt.Sprintf("Every %d days", hs.every)
+	default:
+		return "Every day"
+	}
+}
+
+// refreshHabit recomputes the fields the server would derive: whether the
+// habit is due today, its cycle description and its streaks. A due day that
+// is still open today does not break the current streak.
+func refreshHabit(h *models.Habit, now time.Time) {
+	schedule := newHabitSchedule(*h)
+	today := startOfDay(now)
+
+	completed := map[string]bool{}
+	for _, d := range h.Completed {
+		if len(d) >= 10 {
+			completed[d[:10]] = true
+		}
+	}
+	done := func(day time.Time) bool {
+		return completed[day.Format("2006-01-02")]
+	}
+
+	h.IsDueToday = schedule.isDue(today)
+	h.CycleDescription = schedule.describe()
+
+	run, longest := 0, 0
+	for day := schedule.start; !day.After(today); day = day.AddDate(0, 0, 1) {
+		if !schedule.isDue(day) {
+			continue
+		}
+		if done(day) {
+			run++
+			longest = max(longest, run)
+		} else if !day.Equal(today) {
+			run = 0
+		}
+	}
+
+	h.CurrentStreak = run
+	h.MaxStreak = longest
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Round(24*time.Hour) / (24 * time.Hour))
+}
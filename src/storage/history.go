@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"marcel-cli/fsutil"
+)
+
+// snapshotRetention is how many daily snapshots are kept before the oldest
+// are rotated out.
+const snapshotRetention = 30
+
+var bucketHistory = []byte("history")
+
+// Snapshot is the last synced server state of one local day.
+type Snapshot struct {
+	Day  time.Time
+	Path string
+}
+
+func (s *Storage) getHistoryDir() (string, error) {
+	dir := filepath.Join(s.config.Paths.StateDir, "history")
+	if s.local {
+		dir = filepath.Join(s.config.Paths.StateDir, "local", "history")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// saveSnapshot records cache as today's snapshot, replacing any earlier sync
+// from the same day, and rotates out old days.
+func (s *Storage) saveSnapshot(cache *CacheData) error {
+	if err := s.loadSealer(); err != nil {
+		return err
+	}
+
+	dir, err := s.getHistoryDir()
+	if err != nil {
+		return err
+	}
+
+	day := cache.Timestamp.Local().Format("2006-01-02")
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	sealed, err := s.sealer.Load().seal(bucketHistory, []byte(day), data)
+	if err != nil {
+		return err
+	}
+	if err := fsutil.WriteFileAtomic(filepath.Join(dir, day+".json"), sealed, 0600); err != nil {
+		return err
+	}
+
+	snapshots, err := s.Snapshots()
+	if err != nil {
+		return err
+	}
+	for len(snapshots) > snapshotRetention {
+		os.Remove(snapshots[0].Path)
+		snapshots = snapshots[1:]
+	}
+	return nil
+}
+
+// Snapshots lists the stored snapshots, oldest first.
+func (s *Storage) Snapshots() ([]Snapshot, error) {
+	dir, err := s.getHistoryDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		day, err := time.ParseInLocation("2006-01-02", name, time.Local)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{Day: day, Path: filepath.Join(dir, entry.Name())})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Day.Before(snapshots[j].Day)
+	})
+	return snapshots, nil
+}
+
+func (s *Storage) LoadSnapshot(snapshot Snapshot) (*CacheData, error) {
+	if err := s.loadSealer(); err != nil {
+		return nil, err
+	}
+
+	sealed, err := os.ReadFile(snapshot.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.sealer.Load().open(bucketHistory, []byte(snapshot.Day.Format("2006-01-02")), sealed)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", snapshot.Day.Format("2006-01-02"), err)
+	}
+
+	var cache CacheData
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("corrupt snapshot %s: %w", snapshot.Day.Format("2006-01-02"), err)
+	}
+	return &cache, nil
+}
+
+func (s *Storage) sealSnapshots(sc *sealer) error {
+	snapshots, err := s.Snapshots()
+	if err != nil {
+		return err
+	}
+
+	for _, snapshot := range snapshots {
+		data, err := os.ReadFile(snapshot.Path)
+		if err != nil {
+			return err
+		}
+		if len(data) > 0 && data[0] == sealedPrefix {
+			continue
+		}
+		sealed, err := sc.seal(bucketHistory, []byte(snapshot.Day.Format("2006-01-02")), data)
+		if err != nil {
+			return err
+		}
+		if err := fsutil.WriteFileAtomic(snapshot.Path, sealed, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
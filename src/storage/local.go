@@ -0,0 +1,454 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"marcel-cli/api"
+	"marcel-cli/config"
+	"marcel-cli/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// questDifficulties are the difficulties the server accepts.
+var questDifficulties = []string{"easy", "medium", "hard", "epic", "legendary"}
+
+// questRewards are the XP and gold the server gives per difficulty, and
+// habitReward what it gives per habit. The rewards section of the config
+// file overrides them.
+var questRewards = map[string]config.Reward{
+	"easy":      {XP: 10, Gold: 5},
+	"medium":    {XP: 25, Gold: 10},
+	"hard":      {XP: 50, Gold: 20},
+	"epic":      {XP: 100, Gold: 40},
+	"legendary": {XP: 200, Gold: 80},
+}
+
+var habitReward = config.Reward{XP: 15, Gold: 5}
+
+// LocalStore keeps all data on this machine, without an account. It uses the
+// same database layout as the cache, in a local directory inside the state
+// directory (~/.local/state/marcel/local by default) so clearing the cache
+// never touches it.
+type LocalStore struct {
+	s *Storage
+}
+
+func NewLocal(cfg *config.Config) *LocalStore {
+	return &LocalStore{s: &Storage{config: cfg, local: true}}
+}
+
+func (l *LocalStore) GetConfig() *config.Config {
+	return l.s.config
+}
+
+func (l *LocalStore) CheckAuth() error {
+	return nil
+}
+
+func (l *LocalStore) Load() (*models.AppData, error) {
+	return l.LoadAll()
+}
+
+// LoadAll reads everything and records today's snapshot for marcel diff.
+func (l *LocalStore) LoadAll() (*models.AppData, error) {
+	cache, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+
+	cache.Timestamp = time.Now()
+	l.s.saveSnapshot(cache)
+
+	return buildAppData(cache.Journeys, cache.Quests, cache.Habits, cache.Events), nil
+}
+
+func (l *LocalStore) LoadFromCache() (*models.AppData, error) {
+	cache, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+	return buildAppData(cache.Journeys, cache.Quests, cache.Habits, cache.Events), nil
+}
+
+func (l *LocalStore) CacheTimestamp() (time.Time, error) {
+	timestamp, err := l.s.CacheTimestamp()
+	if errors.Is(err, errNoCache) {
+		return time.Now(), nil
+	}
+	return timestamp, err
+}
+
+func (l *LocalStore) WatchCache(onChange func()) (func() error, error) {
+	return l.s.WatchCache(onChange)
+}
+
+func (l *LocalStore) Snapshots() ([]Snapshot, error) {
+	return l.s.Snapshots()
+}
+
+func (l *LocalStore) LoadSnapshot(snapshot Snapshot) (*CacheData, error) {
+	return l.s.LoadSnapshot(snapshot)
+}
+
+func (l *LocalStore) read() (*CacheData, error) {
+	var cache *CacheData
+	err := l.s.withDB(true, func(tx *bolt.Tx) error {
+		var err error
+		cache, err = readCacheTx(tx, l.s.sealer.Load())
+		if errors.Is(err, errNoCache) {
+			cache, err = &CacheData{}, nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	today := time.Now()
+	for i := range cache.Habits {
+		refreshHabit(&cache.Habits[i], today)
+	}
+	return cache, nil
+}
+
+// mutate applies a change to the stored data in one locked transaction.
+func (l *LocalStore) mutate(apply func(tx *bolt.Tx, cache *CacheData) error) error {
+	return l.s.withLockedDB(func(tx *bolt.Tx) error {
+		cache, err := readCacheTx(tx, l.s.sealer.Load())
+		if errors.Is(err, errNoCache) {
+			cache, err = &CacheData{}, nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := apply(tx, cache); err != nil {
+			return err
+		}
+
+		cache.Timestamp = time.Now()
+		return writeCacheTx(tx, l.s.sealer.Load(), cache)
+	})
+}
+
+func nextID(tx *bolt.Tx, bucket []byte) (int, error) {
+	id, err := tx.Bucket(bucket).NextSequence()
+	return int(id), err
+}
+
+func notFound(entity string, id int) error {
+	return fmt.Errorf("%s %d not found", entity, id)
+}
+
+func checkDifficulty(difficulty string) error {
+	if !slices.Contains(questDifficulties, difficulty) {
+		return fmt.Errorf("unknown difficulty %q: expected one of %s", difficulty, strings.Join(questDifficulties, ", "))
+	}
+	return nil
+}
+
+// reward is what a quest of the given difficulty, or a habit for "habit",
+// earns.
+func (l *LocalStore) reward(name string) config.Reward {
+	if r, ok := l.s.config.Rewards[name]; ok {
+		return r
+	}
+	if name == "habit" {
+		return habitReward
+	}
+	return questRewards[name]
+}
+
+func (l *LocalStore) setQuestReward(quest *models.Quest) {
+	r := l.reward(quest.Difficulty)
+	quest.XPReward, quest.GoldReward = r.XP, r.Gold
+}
+
+func (l *LocalStore) CreateQuest(title, note, difficulty string, journeyID *int) (*models.Quest, error) {
+	if err := checkDifficulty(difficulty); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	quest := models.Quest{
+		Title:      title,
+		Note:       note,
+		Difficulty: difficulty,
+		JourneyID:  journeyID,
+		Status:     "active",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	l.setQuestReward(&quest)
+
+	err := l.mutate(func(tx *bolt.Tx, cache *CacheData) error {
+		if journeyID != nil && findJourney(cache, *journeyID) < 0 {
+			return notFound("journey", *journeyID)
+		}
+		id, err := nextID(tx, bucketQuests)
+		if err != nil {
+			return err
+		}
+		quest.ID = id
+		cache.Quests = append(cache.Quests, quest)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &quest, nil
+}
+
+func (l *LocalStore) UpdateQuest(questID int, updates api.UpdateQuestRequest) (*models.Quest, error) {
+	if updates.Difficulty != nil {
+		if err := checkDifficulty(*updates.Difficulty); err != nil {
+			return nil, err
+		}
+	}
+	var updated models.Quest
+	err := l.mutate(func(tx *bolt.Tx, cache *CacheData) error {
+		for i := range cache.Quests {
+			if cache.Quests[i].ID == questID {
+				applyQuestUpdate(&cache.Quests[i], updates)
+				l.setQuestReward(&cache.Quests[i])
+				updated = cache.Quests[i]
+				return nil
+			}
+		}
+		return notFound("quest", questID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// UpdateQuestIfUnchanged is a plain update: there is no server copy that
+// could have been edited elsewhere.
+func (l *LocalStore) UpdateQuestIfUnchanged(base models.Quest, updates api.UpdateQuestRequest) (*models.Quest, error) {
+	return l.UpdateQuest(base.ID, updates)
+}
+
+func (l *LocalStore) ToggleQuest(questID int, done bool) (*models.Quest, error) {
+	return l.UpdateQuest(questID, api.UpdateQuestRequest{Done: &done})
+}
+
+func (l *LocalStore) DeleteQuest(questID int) error {
+	return l.mutate(func(tx *bolt.Tx, cache *CacheData) error {
+		kept := cache.Quests[:0]
+		for _, q := range cache.Quests {
+			if q.ID != questID {
+				kept = append(kept, q)
+			}
+		}
+		if len(kept) == len(cache.Quests) {
+			return notFound("quest", questID)
+		}
+		cache.Quests = kept
+		return nil
+	})
+}
+
+func findJourney(cache *CacheData, journeyID int) int {
+	for i, j := range cache.Journeys {
+		if j.ID == journeyID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (l *LocalStore) CreateJourney(name string) (*models.Journey, error) {
+	now := time.Now()
+	journey := models.Journey{Name: name, CreatedAt: now, UpdatedAt: now}
+
+	err := l.mutate(func(tx *bolt.Tx, cache *CacheData) error {
+		id, err := nextID(tx, bucketJourneys)
+		if err != nil {
+			return err
+		}
+		journey.ID = id
+		cache.Journeys = append(cache.Journeys, journey)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &journey, nil
+}
+
+func (l *LocalStore) UpdateJourney(journeyID int, updates api.UpdateJourneyRequest) (*models.Journey, error) {
+	var updated models.Journey
+	err := l.mutate(func(tx *bolt.Tx, cache *CacheData) error {
+		i := findJourney(cache, journeyID)
+		if i < 0 {
+			return notFound("journey", journeyID)
+		}
+		if updates.Name != nil {
+			cache.Journeys[i].Name = *updates.Name
+		}
+		cache.Journeys[i].UpdatedAt = time.Now()
+		updated = cache.Journeys[i]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteJourney moves the journey's quests to My Quests rather than losing
+// them, as there is no server copy to recover them from.
+func (l *LocalStore) DeleteJourney(journeyID int) error {
+	return l.mutate(func(tx *bolt.Tx, cache *CacheData) error {
+		i := findJourney(cache, journeyID)
+		if i < 0 {
+			return notFound("journey", journeyID)
+		}
+		cache.Journeys = append(cache.Journeys[:i], cache.Journeys[i+1:]...)
+
+		for k := range cache.Quests {
+			if cache.Quests[k].JourneyID != nil && *cache.Quests[k].JourneyID == journeyID {
+				cache.Quests[k].JourneyID = nil
+			}
+		}
+		return nil
+	})
+}
+
+func (l *LocalStore) CreateHabit(name, cycleType string, cycleConfig any) (*models.Habit, error) {
+	now := time.Now()
+	reward := l.reward("habit")
+	habit := models.Habit{
+		Name:        name,
+		CycleType:   cycleType,
+		CycleConfig: cycleConfig,
+		XPReward:    reward.XP,
+		GoldReward:  reward.Gold,
+		StartDate:   now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	refreshHabit(&habit, now)
+
+	err := l.mutate(func(tx *bolt.Tx, cache *CacheData) error {
+		id, err := nextID(tx, bucketHabits)
+		if err != nil {
+			return err
+		}
+		habit.ID = id
+		cache.Habits = append(cache.Habits, habit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &habit, nil
+}
+
+func (l *LocalStore) UpdateHabit(habitID int, updates api.UpdateHabitRequest) (*models.Habit, error) {
+	var updated models.Habit
+	err := l.mutate(func(tx *bolt.Tx, cache *CacheData) error {
+		for i := range cache.Habits {
+			if cache.Habits[i].ID == habitID {
+				// Like the API, only a habit that is due today can be
+				// completed today; undoing a completion is always allowed.
+				now := time.Now()
+				refreshHabit(&cache.Habits[i], now)
+				if updates.CompleteToday != nil && *updates.CompleteToday && !cache.Habits[i].IsDueToday {
+					return fmt.Errorf("habit %q is not due today", cache.Habits[i].Name)
+				}
+				applyHabitUpdate(&cache.Habits[i], updates)
+				refreshHabit(&cache.Habits[i], now)
+				updated = cache.Habits[i]
+				return nil
+			}
+		}
+		return notFound("habit", habitID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (l *LocalStore) ToggleHabit(habitID int, completeToday bool) (*models.Habit, error) {
+	return l.UpdateHabit(habitID, api.UpdateHabitRequest{CompleteToday: &completeToday})
+}
+
+func (l *LocalStore) DeleteHabit(habitID int) error {
+	return l.mutate(func(tx *bolt.Tx, cache *CacheData) error {
+		kept := cache.Habits[:0]
+		for _, h := range cache.Habits {
+			if h.ID != habitID {
+				kept = append(kept, h)
+			}
+		}
+		if len(kept) == len(cache.Habits) {
+			return notFound("habit", habitID)
+		}
+		cache.Habits = kept
+		return nil
+	})
+}
+
+func (l *LocalStore) CreateEvent(req api.CreateEventRequest) (*models.Event, error) {
+	if _, err := time.ParseInLocation("2006-01-02", req.Date, time.Local); err != nil {
+		return nil, fmt.Errorf("invalid event date %q: expected YYYY-MM-DD", req.Date)
+	}
+	event := newEvent(req)
+
+	err := l.mutate(func(tx *bolt.Tx, cache *CacheData) error {
+		id, err := nextID(tx, bucketEvents)
+		if err != nil {
+			return err
+		}
+		event.ID = id
+		cache.Events = append(cache.Events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (l *LocalStore) UpdateEvent(eventID int, updates api.UpdateEventRequest) (*models.Event, error) {
+	var updated models.Event
+	err := l.mutate(func(tx *bolt.Tx, cache *CacheData) error {
+		for i := range cache.Events {
+			if cache.Events[i].ID == eventID {
+				applyEventUpdate(&cache.Events[i], updates)
+				updated = cache.Events[i]
+				return nil
+			}
+		}
+		return notFound("event", eventID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (l *LocalStore) DeleteEvent(eventID int) error {
+	return l.mutate(func(tx *bolt.Tx, cache *CacheData) error {
+		kept := cache.Events[:0]
+		for _, e := range cache.Events {
+			if e.ID != eventID {
+				kept = append(kept, e)
+			}
+		}
+		if len(kept) == len(cache.Events) {
+			return notFound("event", eventID)
+		}
+		cache.Events = kept
+		return nil
+	})
+}
+
+var _ Repository = (*LocalStore)(nil)
@@ -0,0 +1,599 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"marcel-cli/api"
+	"marcel-cli/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func (s *Storage) updateCache(apply func(cache *CacheData)) error {
+	return s.withLockedDB(func(tx *bolt.Tx) error {
+		return updateCacheTx(tx, s.sealer.Load(), apply)
+	})
+}
+
+func updateCacheTx(tx *bolt.Tx, sc *sealer, apply func(cache *CacheData)) error {
+	cache, err := readCacheTx(tx, sc)
+	if err != nil {
+		cache = &CacheData{}
+	}
+	apply(cache)
+	return writeCacheTx(tx, sc, cache)
+}
+
+// shouldQueue reports whether a mutation has to wait in the pending queue:
+// either it targets a placeholder, or earlier offline changes are still
+// unsent and must reach the server first. Being offline is not an error
+// here; a queue that cannot be read or sent otherwise is.
+func (s *Storage) shouldQueue(ids ...int) (bool, error) {
+	for _, id := range ids {
+		if IsTempID(id) {
+			return true, nil
+		}
+	}
+
+	queue, err := s.loadQueue()
+	if err != nil || len(queue.Ops) == 0 {
+		return false, err
+	}
+
+	if err := s.FlushPending(); err != nil && !api.IsOffline(err) {
+		return false, fmt.Errorf("failed to send earlier offline changes: %w", err)
+	}
+	queue, err = s.loadQueue()
+	if err != nil {
+		return false, err
+	}
+	return len(queue.Ops) > 0, nil
+}
+
+// enqueue records the op and applies it to the cached data in the same
+// transaction, so the queue and the cache can never disagree. If apply
+// fails, nothing is queued.
+func (s *Storage) enqueue(kind OpKind, id int, payload any, apply func(cache *CacheData, id int) error) (int, error) {
+	err := s.withLockedDB(func(tx *bolt.Tx) error {
+		queue, err := loadQueueTx(tx, s.sealer.Load())
+		if err != nil {
+			return err
+		}
+
+		if kind.isCreate() {
+			id = queue.allocateTempID()
+		} else {
+			id = queue.resolve(kind.entity(), id)
+		}
+
+		dropped := kind.isDelete() && IsTempID(id) && queue.dropEntity(kind.entity(), id)
+		if !dropped {
+			if err := queue.push(kind, id, payload); err != nil {
+				return err
+			}
+		}
+
+		if err := saveQueueTx(tx, s.sealer.Load(), queue); err != nil {
+			return err
+		}
+
+		cache, err := readCacheTx(tx, s.sealer.Load())
+		if err != nil {
+			cache = &CacheData{}
+		}
+		if err := apply(cache, id); err != nil {
+			return err
+		}
+		return writeCacheTx(tx, s.sealer.Load(), cache)
+	})
+	return id, err
+}
+
+// notCached is the error for an offline change to an item the cache does
+// not have. There is nothing to apply the change to, so it is not queued.
+func notCached(entity string, id int) error {
+	return fmt.Errorf("%s %d is not in the cache, so it cannot be changed offline", entity, id)
+}
+
+func (s *Storage) resolveTempID(entity string, id int) int {
+	queue, err := s.loadQueue()
+	if err != nil {
+		return id
+	}
+	return queue.resolve(entity, id)
+}
+
+func (s *Storage) CreateQuest(title, note, difficulty string, journeyID *int) (*models.Quest, error) {
+	if journeyID != nil {
+		resolved := s.resolveTempID("journey", *journeyID)
+		journeyID = &resolved
+	}
+
+	queueIDs := []int{}
+	if journeyID != nil {
+		queueIDs = append(queueIDs, *journeyID)
+	}
+
+	queued, err := s.shouldQueue(queueIDs...)
+	if err != nil {
+		return nil, err
+	}
+	if !queued {
+		quest, err := s.apiClient.Load().CreateQuest(title, note, difficulty, journeyID)
+		if !api.IsOffline(err) {
+			return quest, err
+		}
+	}
+
+	now := time.Now()
+	quest := models.Quest{
+		Title:      title,
+		Note:       note,
+		Difficulty: difficulty,
+		JourneyID:  journeyID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	req := api.CreateQuestRequest{Title: title, Note: note, Difficulty: difficulty, JourneyID: journeyID}
+	_, err = s.enqueue(OpCreateQuest, 0, req, func(cache *CacheData, id int) error {
+		quest.ID = id
+		cache.Quests = append(cache.Quests, quest)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &quest, nil
+}
+
+func (s *Storage) UpdateQuest(questID int, updates api.UpdateQuestRequest) (*models.Quest, error) {
+	questID = s.resolveTempID("quest", questID)
+
+	queueIDs := []int{questID}
+	if updates.JourneyID != nil {
+		resolved := s.resolveTempID("journey", *updates.JourneyID)
+		updates.JourneyID = &resolved
+		queueIDs = append(queueIDs, resolved)
+	}
+
+	queued, err := s.shouldQueue(queueIDs...)
+	if err != nil {
+		return nil, err
+	}
+	if !queued {
+		quest, err := s.apiClient.Load().UpdateQuest(questID, updates)
+		if !api.IsOffline(err) {
+			return quest, err
+		}
+	}
+
+	return s.queueQuestUpdate(questID, questUpdate{UpdateQuestRequest: updates})
+}
+
+func (s *Storage) UpdateQuestIfUnchanged(base models.Quest, updates api.UpdateQuestRequest) (*models.Quest, error) {
+	base.ID = s.resolveTempID("quest", base.ID)
+
+	queued, err := s.shouldQueue(base.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !queued {
+		quest, err := s.apiClient.Load().UpdateQuestIfUnchanged(base, updates)
+		if !api.IsOffline(err) {
+			return quest, err
+		}
+	}
+
+	return s.queueQuestUpdate(base.ID, questUpdate{UpdateQuestRequest: updates, Base: &base.UpdatedAt})
+}
+
+func (s *Storage) ToggleQuest(questID int, done bool) (*models.Quest, error) {
+	return s.UpdateQuest(questID, api.UpdateQuestRequest{Done: &done})
+}
+
+func (s *Storage) queueQuestUpdate(questID int, update questUpdate) (*models.Quest, error) {
+	var updated models.Quest
+	_, err := s.enqueue(OpUpdateQuest, questID, update, func(cache *CacheData, _ int) error {
+		for i := range cache.Quests {
+			if cache.Quests[i].ID == questID {
+				applyQuestUpdate(&cache.Quests[i], update.UpdateQuestRequest)
+				updated = cache.Quests[i]
+				return nil
+			}
+		}
+		return notCached("quest", questID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *Storage) DeleteQuest(questID int) error {
+	questID = s.resolveTempID("quest", questID)
+
+	queued, err := s.shouldQueue(questID)
+	if err != nil {
+		return err
+	}
+	if !queued {
+		err = s.apiClient.Load().DeleteQuest(questID)
+		if !api.IsOffline(err) {
+			return err
+		}
+	}
+
+	_, err = s.enqueue(OpDeleteQuest, questID, nil, func(cache *CacheData, _ int) error {
+		kept := cache.Quests[:0]
+		for _, q := range cache.Quests {
+			if q.ID != questID {
+				kept = append(kept, q)
+			}
+		}
+		cache.Quests = kept
+		return nil
+	})
+	return err
+}
+
+func (s *Storage) CreateJourney(name string) (*models.Journey, error) {
+	queued, err := s.shouldQueue()
+	if err != nil {
+		return nil, err
+	}
+	if !queued {
+		journey, err := s.apiClient.Load().CreateJourney(name)
+		if !api.IsOffline(err) {
+			return journey, err
+		}
+	}
+
+	now := time.Now()
+	journey := models.Journey{Name: name, CreatedAt: now, UpdatedAt: now}
+
+	_, err = s.enqueue(OpCreateJourney, 0, api.CreateJourneyRequest{Name: name}, func(cache *CacheData, id int) error {
+		journey.ID = id
+		cache.Journeys = append(cache.Journeys, journey)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &journey, nil
+}
+
+func (s *Storage) UpdateJourney(journeyID int, updates api.UpdateJourneyRequest) (*models.Journey, error) {
+	journeyID = s.resolveTempID("journey", journeyID)
+
+	queued, err := s.shouldQueue(journeyID)
+	if err != nil {
+		return nil, err
+	}
+	if !queued {
+		journey, err := s.apiClient.Load().UpdateJourney(journeyID, updates)
+		if !api.IsOffline(err) {
+			return journey, err
+		}
+	}
+
+	var updated models.Journey
+	_, err = s.enqueue(OpUpdateJourney, journeyID, updates, func(cache *CacheData, _ int) error {
+		for i := range cache.Journeys {
+			if cache.Journeys[i].ID == journeyID {
+				if updates.Name != nil {
+					cache.Journeys[i].Name = *updates.Name
+				}
+				cache.Journeys[i].UpdatedAt = time.Now()
+				updated = cache.Journeys[i]
+				return nil
+			}
+		}
+		return notCached("journey", journeyID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *Storage) DeleteJourney(journeyID int) error {
+	journeyID = s.resolveTempID("journey", journeyID)
+
+	queued, err := s.shouldQueue(journeyID)
+	if err != nil {
+		return err
+	}
+	if !queued {
+		err = s.apiClient.Load().DeleteJourney(journeyID)
+		if !api.IsOffline(err) {
+			return err
+		}
+	}
+
+	_, err = s.enqueue(OpDeleteJourney, journeyID, nil, func(cache *CacheData, _ int) error {
+		kept := cache.Journeys[:0]
+		for _, j := range cache.Journeys {
+			if j.ID != journeyID {
+				kept = append(kept, j)
+			}
+		}
+		cache.Journeys = kept
+		return nil
+	})
+	return err
+}
+
+func (s *Storage) CreateHabit(name, cycleType string, cycleConfig any) (*models.Habit, error) {
+	queued, err := s.shouldQueue()
+	if err != nil {
+		return nil, err
+	}
+	if !queued {
+		habit, err := s.apiClient.Load().CreateHabit(name, cycleType, cycleConfig)
+		if !api.IsOffline(err) {
+			return habit, err
+		}
+	}
+
+	now := time.Now()
+	habit := models.Habit{
+		Name:        name,
+		CycleType:   cycleType,
+		CycleConfig: cycleConfig,
+		StartDate:   now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		IsDueToday:  true,
+	}
+
+	req := api.CreateHabitRequest{Name: name, CycleType: cycleType, CycleConfig: cycleConfig}
+	_, err = s.enqueue(OpCreateHabit, 0, req, func(cache *CacheData, id int) error {
+		habit.ID = id
+		cache.Habits = append(cache.Habits, habit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &habit, nil
+}
+
+func (s *Storage) UpdateHabit(habitID int, updates api.UpdateHabitRequest) (*models.Habit, error) {
+	habitID = s.resolveTempID("habit", habitID)
+
+	queued, err := s.shouldQueue(habitID)
+	if err != nil {
+		return nil, err
+	}
+	if !queued {
+		habit, err := s.apiClient.Load().UpdateHabit(habitID, updates)
+		if !api.IsOffline(err) {
+			return habit, err
+		}
+	}
+
+	var updated models.Habit
+	_, err = s.enqueue(OpUpdateHabit, habitID, updates, func(cache *CacheData, _ int) error {
+		for i := range cache.Habits {
+			if cache.Habits[i].ID == habitID {
+				applyHabitUpdate(&cache.Habits[i], updates)
+				updated = cache.Habits[i]
+				return nil
+			}
+		}
+		return notCached("habit", habitID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *Storage) ToggleHabit(habitID int, completeToday bool) (*models.Habit, error) {
+	return s.UpdateHabit(habitID, api.UpdateHabitRequest{CompleteToday: &completeToday})
+}
+
+func (s *Storage) DeleteHabit(habitID int) error {
+	habitID = s.resolveTempID("habit", habitID)
+
+	queued, err := s.shouldQueue(habitID)
+	if err != nil {
+		return err
+	}
+	if !queued {
+		err = s.apiClient.Load().DeleteHabit(habitID)
+		if !api.IsOffline(err) {
+			return err
+		}
+	}
+
+	_, err = s.enqueue(OpDeleteHabit, habitID, nil, func(cache *CacheData, _ int) error {
+		kept := cache.Habits[:0]
+		for _, h := range cache.Habits {
+			if h.ID != habitID {
+				kept = append(kept, h)
+			}
+		}
+		cache.Habits = kept
+		return nil
+	})
+	return err
+}
+
+func (s *Storage) CreateEvent(req api.CreateEventRequest) (*models.Event, error) {
+	queued, err := s.shouldQueue()
+	if err != nil {
+		return nil, err
+	}
+	if !queued {
+		event, err := s.apiClient.Load().CreateEvent(req)
+		if !api.IsOffline(err) {
+			return event, err
+		}
+	}
+
+	event := newEvent(req)
+
+	_, err = s.enqueue(OpCreateEvent, 0, req, func(cache *CacheData, id int) error {
+		event.ID = id
+		cache.Events = append(cache.Events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+func (s *Storage) UpdateEvent(eventID int, updates api.UpdateEventRequest) (*models.Event, error) {
+	eventID = s.resolveTempID("event", eventID)
+
+	queued, err := s.shouldQueue(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if !queued {
+		event, err := s.apiClient.Load().UpdateEvent(eventID, updates)
+		if !api.IsOffline(err) {
+			return event, err
+		}
+	}
+
+	var updated models.Event
+	_, err = s.enqueue(OpUpdateEvent, eventID, updates, func(cache *CacheData, _ int) error {
+		for i := range cache.Events {
+			if cache.Events[i].ID == eventID {
+				applyEventUpdate(&cache.Events[i], updates)
+				updated = cache.Events[i]
+				return nil
+			}
+		}
+		return notCached("event", eventID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *Storage) DeleteEvent(eventID int) error {
+	eventID = s.resolveTempID("event", eventID)
+
+	queued, err := s.shouldQueue(eventID)
+	if err != nil {
+		return err
+	}
+	if !queued {
+		err = s.apiClient.Load().DeleteEvent(eventID)
+		if !api.IsOffline(err) {
+			return err
+		}
+	}
+
+	_, err = s.enqueue(OpDeleteEvent, eventID, nil, func(cache *CacheData, _ int) error {
+		kept := cache.Events[:0]
+		for _, e := range cache.Events {
+			if e.ID != eventID {
+				kept = append(kept, e)
+			}
+		}
+		cache.Events = kept
+		return nil
+	})
+	return err
+}
+
+func newEvent(req api.CreateEventRequest) models.Event {
+	now := time.Now()
+	event := models.Event{
+		Title:       req.Title,
+		Time:        req.Time,
+		EndTime:     req.EndTime,
+		Location:    req.Location,
+		Description: req.Description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if date, err := time.ParseInLocation("2006-01-02", req.Date, time.Local); err == nil {
+		event.Date = date
+	}
+	if req.EndDate != nil {
+		if endDate, err := time.ParseInLocation("2006-01-02", *req.EndDate, time.Local); err == nil {
+			event.EndDate = &endDate
+		}
+	}
+	return event
+}
+
+func applyQuestUpdate(quest *models.Quest, updates api.UpdateQuestRequest) {
+	if updates.Title != nil {
+		quest.Title = *updates.Title
+	}
+	if updates.Note != nil {
+		quest.Note = *updates.Note
+	}
+	if updates.Done != nil {
+		quest.Done = *updates.Done
+	}
+	if updates.Difficulty != nil {
+		quest.Difficulty = *updates.Difficulty
+	}
+	if updates.JourneyID != nil {
+		journeyID := *updates.JourneyID
+		quest.JourneyID = &journeyID
+	}
+	quest.UpdatedAt = time.Now()
+}
+
+func applyHabitUpdate(habit *models.Habit, updates api.UpdateHabitRequest) {
+	if updates.Name != nil {
+		habit.Name = *updates.Name
+	}
+	if updates.CycleType != nil {
+		habit.CycleType = *updates.CycleType
+	}
+	if updates.CycleConfig != nil {
+		habit.CycleConfig = updates.CycleConfig
+	}
+	if updates.CompleteToday != nil {
+		today := time.Now().Format("2006-01-02")
+		var completed []string
+		for _, d := range habit.Completed {
+			if len(d) < 10 || d[:10] != today {
+				completed = append(completed, d)
+			}
+		}
+		if *updates.CompleteToday {
+			completed = append(completed, today)
+		}
+		habit.Completed = completed
+	}
+	habit.UpdatedAt = time.Now()
+}
+
+func applyEventUpdate(event *models.Event, updates api.UpdateEventRequest) {
+	if updates.Title != nil {
+		event.Title = *updates.Title
+	}
+	if updates.Date != nil {
+		if date, err := time.ParseInLocation("2006-01-02", *updates.Date, time.Local); err == nil {
+			event.Date = date
+		}
+	}
+	if updates.EndDate != nil {
+		if endDate, err := time.ParseInLocation("2006-01-02", *updates.EndDate, time.Local); err == nil {
+			event.EndDate = &endDate
+		}
+	}
+	event.Time = updates.Time
+	event.EndTime = updates.EndTime
+	event.Location = updates.Location
+	event.Description = updates.Description
+	event.UpdatedAt = time.Now()
+}
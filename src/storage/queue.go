@@ -0,0 +1,583 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"marcel-cli/api"
+	"marcel-cli/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type OpKind string
+
+const (
+	OpCreateQuest   OpKind = "create_quest"
+	OpUpdateQuest   OpKind = "update_quest"
+	OpDeleteQuest   OpKind = "delete_quest"
+	OpCreateJourney OpKind = "create_journey"
+	OpUpdateJourney OpKind = "update_journey"
+	OpDeleteJourney OpKind = "delete_journey"
+	OpCreateHabit   OpKind = "create_habit"
+	OpUpdateHabit   OpKind = "update_habit"
+	OpDeleteHabit   OpKind = "delete_habit"
+	OpCreateEvent   OpKind = "create_event"
+	OpUpdateEvent   OpKind = "update_event"
+	OpDeleteEvent   OpKind = "delete_event"
+)
+
+func (k OpKind) isCreate() bool {
+	switch k {
+	case OpCreateQuest, OpCreateJourney, OpCreateHabit, OpCreateEvent:
+		return true
+	}
+	return false
+}
+
+func (k OpKind) isDelete() bool {
+	switch k {
+	case OpDeleteQuest, OpDeleteJourney, OpDeleteHabit, OpDeleteEvent:
+		return true
+	}
+	return false
+}
+
+func (k OpKind) entity() string {
+	switch k {
+	case OpCreateQuest, OpUpdateQuest, OpDeleteQuest:
+		return "quest"
+	case OpCreateJourney, OpUpdateJourney, OpDeleteJourney:
+		return "journey"
+	case OpCreateHabit, OpUpdateHabit, OpDeleteHabit:
+		return "habit"
+	default:
+		return "event"
+	}
+}
+
+// PendingOp is a mutation recorded while the server was unreachable. ID is
+// the target entity, or for creates the placeholder ID handed to the UI.
+// Placeholder IDs are always negative so they never collide with server IDs.
+type PendingOp struct {
+	Kind     OpKind          `json:"kind"`
+	ID       int             `json:"id"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	QueuedAt time.Time       `json:"queuedAt"`
+}
+
+// questUpdate is the payload of a queued quest update. Base is set for
+// edits that must not overwrite a newer change on the server: it is the
+// UpdatedAt the edit was made against, checked again on replay.
+type questUpdate struct {
+	api.UpdateQuestRequest
+	Base *time.Time `json:"base,omitempty"`
+}
+
+// FailedOp is a queued op the server refused on replay. It is kept, so an
+// offline change never disappears without a trace, and listed by marcel
+// cache inspect. Reported is set once a sync has told the user about it.
+type FailedOp struct {
+	PendingOp
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failedAt"`
+	Reported bool      `json:"reported,omitempty"`
+}
+
+// maxFailedOps bounds the failed list; the oldest entries go first.
+const maxFailedOps = 50
+
+// RejectedError reports queued offline changes the server refused. They
+// stay in the failed list after being reported.
+type RejectedError struct {
+	Ops []FailedOp
+}
+
+func (e *RejectedError) Error() string {
+	first := e.Ops[0]
+	if len(e.Ops) == 1 {
+		return fmt.Sprintf("the server rejected an offline change (%s): %s", first.Kind, first.Error)
+	}
+	return fmt.Sprintf("the server rejected %d offline changes, the first (%s): %s", len(e.Ops), first.Kind, first.Error)
+}
+
+type pendingQueue struct {
+	NextTempID int            `json:"nextTempId"`
+	Ops        []PendingOp    `json:"ops"`
+	Resolved   map[string]int `json:"resolved,omitempty"`
+	Failed     []FailedOp     `json:"failed,omitempty"`
+	Claim      *claim         `json:"claim,omitempty"`
+}
+
+// claim marks the op at the head of the queue as being sent by one flush,
+// so its request runs without the cache lock and no other flush sends it
+// too.
+type claim struct {
+	By string    `json:"by"`
+	At time.Time `json:"at"`
+}
+
+// claimTimeout is how long other flushes leave a claimed op alone. An older
+// claim was left by a process that died mid-request.
+const claimTimeout = 2 * time.Minute
+
+func resolvedKey(entity string, tempID int) string {
+	return fmt.Sprintf("%s:%d", entity, tempID)
+}
+
+func (q *pendingQueue) resolve(entity string, id int) int {
+	if realID, ok := q.Resolved[resolvedKey(entity, id)]; ok && IsTempID(id) {
+		return realID
+	}
+	return id
+}
+
+func IsTempID(id int) bool {
+	return id < 0
+}
+
+func loadQueueTx(tx *bolt.Tx, sc *sealer) (*pendingQueue, error) {
+	queue := &pendingQueue{NextTempID: -1}
+
+	b := tx.Bucket(bucketPending)
+	if b == nil || b.Get(pendingKey) == nil {
+		return queue, nil
+	}
+
+	data, err := sc.open(bucketPending, pendingKey, b.Get(pendingKey))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, queue); err != nil {
+		return nil, fmt.Errorf("corrupt pending queue: %w", err)
+	}
+
+	if queue.NextTempID >= 0 {
+		queue.NextTempID = -1
+	}
+
+	return queue, nil
+}
+
+func saveQueueTx(tx *bolt.Tx, sc *sealer, queue *pendingQueue) error {
+	data, err := json.Marshal(queue)
+	if err != nil {
+		return err
+	}
+	sealed, err := sc.seal(bucketPending, pendingKey, data)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketPending).Put(pendingKey, sealed); err != nil {
+		return err
+	}
+	return bumpRevisionTx(tx)
+}
+
+func (s *Storage) loadQueue() (*pendingQueue, error) {
+	var queue *pendingQueue
+	err := s.withDB(false, func(tx *bolt.Tx) error {
+		var err error
+		queue, err = loadQueueTx(tx, s.sealer.Load())
+		return err
+	})
+	if errors.Is(err, errNoCache) {
+		return &pendingQueue{NextTempID: -1}, nil
+	}
+	return queue, err
+}
+
+func (s *Storage) saveQueue(queue *pendingQueue) error {
+	return s.withDB(true, func(tx *bolt.Tx) error {
+		return saveQueueTx(tx, s.sealer.Load(), queue)
+	})
+}
+
+func (q *pendingQueue) allocateTempID() int {
+	id := q.NextTempID
+	q.NextTempID--
+	return id
+}
+
+func (q *pendingQueue) push(kind OpKind, id int, payload any) error {
+	var raw json.RawMessage
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		raw = data
+	}
+
+	q.Ops = append(q.Ops, PendingOp{
+		Kind:     kind,
+		ID:       id,
+		Payload:  raw,
+		QueuedAt: time.Now(),
+	})
+	return nil
+}
+
+func (q *pendingQueue) fail(op PendingOp, err error) {
+	q.Failed = append(q.Failed, FailedOp{PendingOp: op, Error: err.Error(), FailedAt: time.Now()})
+	if len(q.Failed) > maxFailedOps {
+		q.Failed = q.Failed[len(q.Failed)-maxFailedOps:]
+	}
+}
+
+// dropEntity removes every queued op that targets an entity which only ever
+// existed locally, so deleting it never reaches the server. It reports false
+// when a flush is sending the entity's create right now: the create stays,
+// and the delete has to follow it.
+func (q *pendingQueue) dropEntity(entity string, tempID int) bool {
+	sending := q.Claim != nil && len(q.Ops) > 0 && q.Ops[0].Kind.entity() == entity && q.Ops[0].ID == tempID
+	kept := q.Ops[:0]
+	for i, op := range q.Ops {
+		if op.Kind.entity() == entity && op.ID == tempID && !(sending && i == 0) {
+			continue
+		}
+		kept = append(kept, op)
+	}
+	q.Ops = kept
+	return !sending
+}
+
+// rewriteID replaces a placeholder ID with the server-assigned one in every
+// op still waiting in the queue, including quests created inside or moved
+// to a journey that was itself created offline.
+func (q *pendingQueue) rewriteID(entity string, tempID, realID int) error {
+	if q.Resolved == nil {
+		q.Resolved = make(map[string]int)
+	}
+	q.Resolved[resolvedKey(entity, tempID)] = realID
+
+	for i := range q.Ops {
+		op := &q.Ops[i]
+		if op.Kind.entity() == entity && op.ID == tempID {
+			op.ID = realID
+		}
+
+		if entity != "journey" {
+			continue
+		}
+		var err error
+		switch op.Kind {
+		case OpCreateQuest:
+			err = rewriteJourneyID(op, func(req *api.CreateQuestRequest) *int { return req.JourneyID }, tempID, realID)
+		case OpUpdateQuest:
+			err = rewriteJourneyID(op, func(req *questUpdate) *int { return req.JourneyID }, tempID, realID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteJourneyID points a quest op that names a journey created offline at
+// the journey's real ID.
+func rewriteJourneyID[T any](op *PendingOp, journeyID func(req *T) *int, tempID, realID int) error {
+	var req T
+	if err := json.Unmarshal(op.Payload, &req); err != nil {
+		return err
+	}
+	id := journeyID(&req)
+	if id == nil || *id != tempID {
+		return nil
+	}
+	*id = realID
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	op.Payload = data
+	return nil
+}
+
+// rebase points the checked updates still queued for a quest at the
+// UpdatedAt the server gave it for the op just sent. They were made on top
+// of that op, not of the copy the server had before it.
+func (q *pendingQueue) rebase(questID int, updatedAt time.Time) error {
+	for i := range q.Ops {
+		op := &q.Ops[i]
+		if op.Kind != OpUpdateQuest || op.ID != questID {
+			continue
+		}
+		var req questUpdate
+		if err := json.Unmarshal(op.Payload, &req); err != nil {
+			return err
+		}
+		if req.Base == nil {
+			continue
+		}
+		req.Base = &updatedAt
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		op.Payload = data
+	}
+	return nil
+}
+
+func (s *Storage) PendingCount() int {
+	queue, err := s.loadQueue()
+	if err != nil {
+		return 0
+	}
+	return len(queue.Ops)
+}
+
+// FlushPending replays queued ops in order. It stops at the first network
+// failure and keeps the remainder; ops the server rejects move to the failed
+// list, which the next LoadAll reports. The cache lock is only held to claim
+// an op and to settle it, never during a request, so other processes are not
+// kept waiting on a slow server.
+func (s *Storage) FlushPending() error {
+	queue, err := s.loadQueue()
+	if err != nil || len(queue.Ops) == 0 {
+		return err
+	}
+
+	token := fmt.Sprintf("%s-%d", instanceID, time.Now().UnixNano())
+	for {
+		op, ok, err := s.claimHead(token)
+		if err != nil || !ok {
+			return err
+		}
+
+		newID, updatedAt, err := s.replay(op)
+		if api.IsOffline(err) {
+			if releaseErr := s.releaseClaim(token); releaseErr != nil {
+				return releaseErr
+			}
+			return err
+		}
+		if err := s.settle(token, op, newID, updatedAt, err); err != nil {
+			return err
+		}
+	}
+}
+
+// claimHead claims the op at the head of the queue for this flush. Ops that
+// target a placeholder whose create never went through fail on the spot. ok
+// is false when the queue is empty or another flush is sending an op.
+func (s *Storage) claimHead(token string) (op PendingOp, ok bool, err error) {
+	err = s.withLockedDB(func(tx *bolt.Tx) error {
+		queue, err := loadQueueTx(tx, s.sealer.Load())
+		if err != nil {
+			return err
+		}
+		if queue.Claim != nil && queue.Claim.By != token && time.Since(queue.Claim.At) < claimTimeout {
+			return nil
+		}
+
+		before := len(queue.Ops)
+		for len(queue.Ops) > 0 && IsTempID(queue.Ops[0].ID) && !queue.Ops[0].Kind.isCreate() {
+			queue.fail(queue.Ops[0], fmt.Errorf("placeholder %d was never created", queue.Ops[0].ID))
+			queue.Ops = queue.Ops[1:]
+		}
+		if len(queue.Ops) == 0 {
+			if before == 0 && queue.Claim == nil {
+				return nil
+			}
+			queue.Claim = nil
+			return saveQueueTx(tx, s.sealer.Load(), queue)
+		}
+
+		op, ok = queue.Ops[0], true
+		queue.Claim = &claim{By: token, At: time.Now()}
+		return saveQueueTx(tx, s.sealer.Load(), queue)
+	})
+	return op, ok, err
+}
+
+func (s *Storage) releaseClaim(token string) error {
+	return s.withLockedDB(func(tx *bolt.Tx) error {
+		queue, err := loadQueueTx(tx, s.sealer.Load())
+		if err != nil {
+			return err
+		}
+		if queue.Claim == nil || queue.Claim.By != token {
+			return nil
+		}
+		queue.Claim = nil
+		return saveQueueTx(tx, s.sealer.Load(), queue)
+	})
+}
+
+// settle takes a replayed op off the queue. Once the server accepted it,
+// later ops learn the real ID and UpdatedAt; if it refused, the op moves to
+// the failed list.
+func (s *Storage) settle(token string, op PendingOp, newID int, updatedAt time.Time, replayErr error) error {
+	return s.withLockedDB(func(tx *bolt.Tx) error {
+		queue, err := loadQueueTx(tx, s.sealer.Load())
+		if err != nil {
+			return err
+		}
+		if queue.Claim != nil && queue.Claim.By == token {
+			queue.Claim = nil
+		}
+		queue.Ops = slices.DeleteFunc(queue.Ops, func(o PendingOp) bool {
+			return o.Kind == op.Kind && o.ID == op.ID && o.QueuedAt.Equal(op.QueuedAt)
+		})
+
+		if replayErr != nil {
+			queue.fail(op, replayErr)
+			return saveQueueTx(tx, s.sealer.Load(), queue)
+		}
+		if op.Kind.isCreate() && IsTempID(op.ID) {
+			if err := queue.rewriteID(op.Kind.entity(), op.ID, newID); err != nil {
+				return err
+			}
+		}
+		if !updatedAt.IsZero() {
+			if err := queue.rebase(newID, updatedAt); err != nil {
+				return err
+			}
+		}
+		return saveQueueTx(tx, s.sealer.Load(), queue)
+	})
+}
+
+// takeRejected returns the failed ops no sync has reported yet as a
+// RejectedError, and marks them reported.
+func (s *Storage) takeRejected() error {
+	var fresh []FailedOp
+	err := s.withLockedDB(func(tx *bolt.Tx) error {
+		queue, err := loadQueueTx(tx, s.sealer.Load())
+		if err != nil {
+			return err
+		}
+		for i := range queue.Failed {
+			if !queue.Failed[i].Reported {
+				queue.Failed[i].Reported = true
+				fresh = append(fresh, queue.Failed[i])
+			}
+		}
+		if len(fresh) == 0 {
+			return nil
+		}
+		return saveQueueTx(tx, s.sealer.Load(), queue)
+	})
+	if err != nil || len(fresh) == 0 {
+		return err
+	}
+	return &RejectedError{Ops: fresh}
+}
+
+// replay sends a queued op and returns the ID it ended up with. For quests it
+// also returns the UpdatedAt the server answered with.
+func (s *Storage) replay(op PendingOp) (int, time.Time, error) {
+	client := s.apiClient.Load()
+
+	switch op.Kind {
+	case OpCreateQuest:
+		var req api.CreateQuestRequest
+		if err := json.Unmarshal(op.Payload, &req); err != nil {
+			return 0, time.Time{}, err
+		}
+		if req.JourneyID != nil && IsTempID(*req.JourneyID) {
+			return 0, time.Time{}, fmt.Errorf("journey %d was never created", *req.JourneyID)
+		}
+		quest, err := client.CreateQuest(req.Title, req.Note, req.Difficulty, req.JourneyID)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		return quest.ID, quest.UpdatedAt, nil
+
+	case OpUpdateQuest:
+		var req questUpdate
+		if err := json.Unmarshal(op.Payload, &req); err != nil {
+			return 0, time.Time{}, err
+		}
+		if req.JourneyID != nil && IsTempID(*req.JourneyID) {
+			return 0, time.Time{}, fmt.Errorf("journey %d was never created", *req.JourneyID)
+		}
+		var quest *models.Quest
+		var err error
+		if req.Base != nil {
+			quest, err = client.UpdateQuestIfUnchanged(models.Quest{ID: op.ID, UpdatedAt: *req.Base}, req.UpdateQuestRequest)
+		} else {
+			quest, err = client.UpdateQuest(op.ID, req.UpdateQuestRequest)
+		}
+		if err != nil {
+			return op.ID, time.Time{}, err
+		}
+		return op.ID, quest.UpdatedAt, nil
+
+	case OpDeleteQuest:
+		return op.ID, time.Time{}, client.DeleteQuest(op.ID)
+
+	case OpCreateJourney:
+		var req api.CreateJourneyRequest
+		if err := json.Unmarshal(op.Payload, &req); err != nil {
+			return 0, time.Time{}, err
+		}
+		journey, err := client.CreateJourney(req.Name)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		return journey.ID, time.Time{}, nil
+
+	case OpUpdateJourney:
+		var req api.UpdateJourneyRequest
+		if err := json.Unmarshal(op.Payload, &req); err != nil {
+			return 0, time.Time{}, err
+		}
+		_, err := client.UpdateJourney(op.ID, req)
+		return op.ID, time.Time{}, err
+
+	case OpDeleteJourney:
+		return op.ID, time.Time{}, client.DeleteJourney(op.ID)
+
+	case OpCreateHabit:
+		var req api.CreateHabitRequest
+		if err := json.Unmarshal(op.Payload, &req); err != nil {
+			return 0, time.Time{}, err
+		}
+		habit, err := client.CreateHabit(req.Name, req.CycleType, req.CycleConfig)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		return habit.ID, time.Time{}, nil
+
+	case OpUpdateHabit:
+		var req api.UpdateHabitRequest
+		if err := json.Unmarshal(op.Payload, &req); err != nil {
+			return 0, time.Time{}, err
+		}
+		_, err := client.UpdateHabit(op.ID, req)
+		return op.ID, time.Time{}, err
+
+	case OpDeleteHabit:
+		return op.ID, time.Time{}, client.DeleteHabit(op.ID)
+
+	case OpCreateEvent:
+		var req api.CreateEventRequest
+		if err := json.Unmarshal(op.Payload, &req); err != nil {
+			return 0, time.Time{}, err
+		}
+		event, err := client.CreateEvent(req)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		return event.ID, time.Time{}, nil
+
+	case OpUpdateEvent:
+		var req api.UpdateEventRequest
+		if err := json.Unmarshal(op.Payload, &req); err != nil {
+			return 0, time.Time{}, err
+		}
+		_, err := client.UpdateEvent(op.ID, req)
+		return op.ID, time.Time{}, err
+
+	case OpDeleteEvent:
+		return op.ID, time.Time{}, client.DeleteEvent(op.ID)
+	}
+
+	return 0, time.Time{}, fmt.Errorf("unknown pending operation %q", op.Kind)
+}
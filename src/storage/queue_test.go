@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"marcel-cli/api"
+	"marcel-cli/models"
+)
+
+func mustPayload(t *testing.T, v any) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func intPtr(i int) *int { return &i }
+
+func TestRewriteID(t *testing.T) {
+	tests := []struct {
+		name    string
+		entity  string
+		op      PendingOp
+		wantID  int
+		journey *int
+	}{
+		{
+			name:   "op on the created entity",
+			entity: "quest",
+			op:     PendingOp{Kind: OpUpdateQuest, ID: -1, Payload: mustPayload(t, questUpdate{})},
+			wantID: 42,
+		},
+		{
+			name:   "op on another entity kind",
+			entity: "journey",
+			op:     PendingOp{Kind: OpDeleteHabit, ID: -1},
+			wantID: -1,
+		},
+		{
+			name:    "quest created in the journey",
+			entity:  "journey",
+			op:      PendingOp{Kind: OpCreateQuest, ID: -2, Payload: mustPayload(t, api.CreateQuestRequest{Title: "q", JourneyID: intPtr(-1)})},
+			wantID:  -2,
+			journey: intPtr(42),
+		},
+		{
+			name:    "quest moved to the journey",
+			entity:  "journey",
+			op:      PendingOp{Kind: OpUpdateQuest, ID: 5, Payload: mustPayload(t, questUpdate{UpdateQuestRequest: api.UpdateQuestRequest{JourneyID: intPtr(-1)}})},
+			wantID:  5,
+			journey: intPtr(42),
+		},
+		{
+			name:    "quest moved to another journey",
+			entity:  "journey",
+			op:      PendingOp{Kind: OpUpdateQuest, ID: 5, Payload: mustPayload(t, questUpdate{UpdateQuestRequest: api.UpdateQuestRequest{JourneyID: intPtr(-3)}})},
+			wantID:  5,
+			journey: intPtr(-3),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &pendingQueue{Ops: []PendingOp{tt.op}}
+			if err := q.rewriteID(tt.entity, -1, 42); err != nil {
+				t.Fatal(err)
+			}
+			op := q.Ops[0]
+			if op.ID != tt.wantID {
+				t.Errorf("ID = %d, want %d", op.ID, tt.wantID)
+			}
+			if got := q.resolve(tt.entity, -1); got != 42 {
+				t.Errorf("resolve(-1) = %d, want 42", got)
+			}
+			if tt.journey == nil {
+				return
+			}
+			var req struct {
+				JourneyID *int `json:"journeyId"`
+			}
+			if err := json.Unmarshal(op.Payload, &req); err != nil {
+				t.Fatal(err)
+			}
+			if req.JourneyID == nil || *req.JourneyID != *tt.journey {
+				t.Errorf("journeyId = %v, want %d", req.JourneyID, *tt.journey)
+			}
+		})
+	}
+}
+
+func TestRebase(t *testing.T) {
+	local := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	server := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	q := &pendingQueue{Ops: []PendingOp{
+		{Kind: OpUpdateQuest, ID: 1, Payload: mustPayload(t, questUpdate{Base: &local})},
+		{Kind: OpUpdateQuest, ID: 1, Payload: mustPayload(t, questUpdate{})},
+		{Kind: OpUpdateQuest, ID: 2, Payload: mustPayload(t, questUpdate{Base: &local})},
+	}}
+	if err := q.rebase(1, server); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*time.Time{&server, nil, &local}
+	for i, op := range q.Ops {
+		var req questUpdate
+		if err := json.Unmarshal(op.Payload, &req); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case want[i] == nil && req.Base != nil:
+			t.Errorf("op %d: base = %v, want none", i, req.Base)
+		case want[i] != nil && (req.Base == nil || !req.Base.Equal(*want[i])):
+			t.Errorf("op %d: base = %v, want %v", i, req.Base, want[i])
+		}
+	}
+}
+
+func TestQuestUpdateReadsOldPayloads(t *testing.T) {
+	var req questUpdate
+	if err := json.Unmarshal([]byte(`{"title":"t","done":true}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Title == nil || *req.Title != "t" || req.Done == nil || !*req.Done || req.Base != nil {
+		t.Errorf("decoded %+v", req)
+	}
+}
+
+func TestDropEntity(t *testing.T) {
+	ops := func() []PendingOp {
+		return []PendingOp{
+			{Kind: OpCreateQuest, ID: -1},
+			{Kind: OpUpdateQuest, ID: -1},
+			{Kind: OpUpdateQuest, ID: 3},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		claim       *claim
+		wantDropped bool
+		wantOps     int
+	}{
+		{"nothing sent yet", nil, true, 1},
+		{"create being sent", &claim{By: "other", At: time.Now()}, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &pendingQueue{Ops: ops(), Claim: tt.claim}
+			if dropped := q.dropEntity("quest", -1); dropped != tt.wantDropped {
+				t.Errorf("dropped = %v, want %v", dropped, tt.wantDropped)
+			}
+			if len(q.Ops) != tt.wantOps {
+				t.Errorf("%d ops left, want %d: %+v", len(q.Ops), tt.wantOps, q.Ops)
+			}
+		})
+	}
+}
+
+func TestFailedListIsBounded(t *testing.T) {
+	q := &pendingQueue{}
+	for i := range maxFailedOps + 5 {
+		q.fail(PendingOp{Kind: OpDeleteQuest, ID: i}, errors.New("no"))
+	}
+	if len(q.Failed) != maxFailedOps || q.Failed[0].ID != 5 {
+		t.Errorf("%d failed ops, first %d", len(q.Failed), q.Failed[0].ID)
+	}
+}
+
+func TestFlushPending(t *testing.T) {
+	server := &fakeQuestServer{quests: map[int]models.Quest{}, nextID: 99}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	s := newTestStorage(t, srv.URL)
+
+	local := time.Now()
+	title := "renamed"
+	ops := []PendingOp{
+		{Kind: OpCreateQuest, ID: -1, Payload: mustPayload(t, api.CreateQuestRequest{Title: "new"}), QueuedAt: local},
+		// Edited offline on top of the create: checked against what the
+		// server answered to the create, not the local stamp.
+		{Kind: OpUpdateQuest, ID: -1, Payload: mustPayload(t, questUpdate{UpdateQuestRequest: api.UpdateQuestRequest{Title: &title}, Base: &local}), QueuedAt: local.Add(time.Second)},
+		{Kind: OpUpdateQuest, ID: 7, Payload: mustPayload(t, questUpdate{UpdateQuestRequest: api.UpdateQuestRequest{Title: &title}}), QueuedAt: local.Add(2 * time.Second)},
+		{Kind: OpDeleteQuest, ID: -9, QueuedAt: local.Add(3 * time.Second)},
+	}
+	if err := s.saveQueue(&pendingQueue{NextTempID: -10, Ops: ops}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.FlushPending(); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, err := s.loadQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.Ops) != 0 || queue.Claim != nil {
+		t.Errorf("queue left with %+v, claim %+v", queue.Ops, queue.Claim)
+	}
+	if got := server.quests[100].Title; got != title {
+		t.Errorf("server title = %q, want %q", got, title)
+	}
+	if len(queue.Failed) != 2 {
+		t.Fatalf("failed = %+v, want the refused update and the orphaned delete", queue.Failed)
+	}
+
+	var rejected *RejectedError
+	if err := s.takeRejected(); !errors.As(err, &rejected) || len(rejected.Ops) != 2 {
+		t.Fatalf("takeRejected = %v, want both failures", err)
+	}
+	if err := s.takeRejected(); err != nil {
+		t.Errorf("second takeRejected = %v, want nil", err)
+	}
+}
+
+func TestFlushPendingConflict(t *testing.T) {
+	server := &fakeQuestServer{quests: map[int]models.Quest{
+		5: {ID: 5, Title: "theirs", UpdatedAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	s := newTestStorage(t, srv.URL)
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	title := "mine"
+	op := PendingOp{Kind: OpUpdateQuest, ID: 5, Payload: mustPayload(t, questUpdate{UpdateQuestRequest: api.UpdateQuestRequest{Title: &title}, Base: &base})}
+	if err := s.saveQueue(&pendingQueue{NextTempID: -1, Ops: []PendingOp{op}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.FlushPending(); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.quests[5].Title; got != "theirs" {
+		t.Errorf("server title = %q, the newer change was overwritten", got)
+	}
+	queue, _ := s.loadQueue()
+	if len(queue.Failed) != 1 || !strings.Contains(queue.Failed[0].Error, "changed elsewhere") {
+		t.Errorf("failed = %+v, want the conflict", queue.Failed)
+	}
+}
+
+func TestFlushPendingOffline(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	s := newTestStorage(t, srv.URL)
+
+	op := PendingOp{Kind: OpDeleteQuest, ID: 3, QueuedAt: time.Now()}
+	if err := s.saveQueue(&pendingQueue{NextTempID: -1, Ops: []PendingOp{op}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.FlushPending(); !api.IsOffline(err) {
+		t.Fatalf("FlushPending = %v, want offline", err)
+	}
+	queue, _ := s.loadQueue()
+	if len(queue.Ops) != 1 || queue.Claim != nil || len(queue.Failed) != 0 {
+		t.Errorf("queue = %+v, want the op kept and the claim released", queue)
+	}
+}
+
+func TestFlushPendingLeavesClaimedOps(t *testing.T) {
+	server := &fakeQuestServer{quests: map[int]models.Quest{}}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	s := newTestStorage(t, srv.URL)
+
+	tests := []struct {
+		name     string
+		claimAge time.Duration
+		wantSent bool
+	}{
+		{"another flush is sending", time.Second, false},
+		{"its process died", claimTimeout + time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.requests = nil
+			queue := &pendingQueue{
+				NextTempID: -1,
+				Ops:        []PendingOp{{Kind: OpCreateQuest, ID: -1, Payload: mustPayload(t, api.CreateQuestRequest{Title: "q"})}},
+				Claim:      &claim{By: "other", At: time.Now().Add(-tt.claimAge)},
+			}
+			if err := s.saveQueue(queue); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.FlushPending(); err != nil {
+				t.Fatal(err)
+			}
+			if sent := len(server.requests) > 0; sent != tt.wantSent {
+				t.Errorf("sent = %v, want %v", sent, tt.wantSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"time"
+
+	"marcel-cli/api"
+	"marcel-cli/config"
+	"marcel-cli/models"
+)
+
+type QuestStore interface {
+	CreateQuest(title, note, difficulty string, journeyID *int) (*models.Quest, error)
+	UpdateQuest(questID int, updates api.UpdateQuestRequest) (*models.Quest, error)
+	UpdateQuestIfUnchanged(base models.Quest, updates api.UpdateQuestRequest) (*models.Quest, error)
+	ToggleQuest(questID int, done bool) (*models.Quest, error)
+	DeleteQuest(questID int) error
+}
+
+type JourneyStore interface {
+	CreateJourney(name string) (*models.Journey, error)
+	UpdateJourney(journeyID int, updates api.UpdateJourneyRequest) (*models.Journey, error)
+	DeleteJourney(journeyID int) error
+}
+
+type HabitStore interface {
+	CreateHabit(name, cycleType string, cycleConfig any) (*models.Habit, error)
+	UpdateHabit(habitID int, updates api.UpdateHabitRequest) (*models.Habit, error)
+	ToggleHabit(habitID int, completeToday bool) (*models.Habit, error)
+	DeleteHabit(habitID int) error
+}
+
+type EventStore interface {
+	CreateEvent(req api.CreateEventRequest) (*models.Event, error)
+	UpdateEvent(eventID int, updates api.UpdateEventRequest) (*models.Event, error)
+	DeleteEvent(eventID int) error
+}
+
+type SnapshotStore interface {
+	Snapshots() ([]Snapshot, error)
+	LoadSnapshot(snapshot Snapshot) (*CacheData, error)
+}
+
+// Authenticator is implemented by backends that need an account token.
+type Authenticator interface {
+	Login(token string) (*models.User, string, error)
+	Logout() error
+}
+
+// Repository is the backend the UI talks to. Load prefers the server and
+// falls back to the cache when offline; LoadAll always syncs with the server.
+type Repository interface {
+	GetConfig() *config.Config
+	CheckAuth() error
+
+	Load() (*models.AppData, error)
+	LoadAll() (*models.AppData, error)
+	LoadFromCache() (*models.AppData, error)
+	CacheTimestamp() (time.Time, error)
+	WatchCache(onChange func()) (func() error, error)
+
+	QuestStore
+	JourneyStore
+	HabitStore
+	EventStore
+	SnapshotStore
+}
+
+var (
+	_ Repository    = (*Storage)(nil)
+	_ Authenticator = (*Storage)(nil)
+)
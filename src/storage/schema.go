@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"marcel-cli/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// SchemaVersion is the layout of the cache database this build understands.
+// Bump it and append a migration whenever a cached model changes shape.
+const SchemaVersion = 1
+
+var metaSchemaVersion = []byte("schema_version")
+
+type migration struct {
+	version int
+	name    string
+	apply   func(tx *bolt.Tx, sc *sealer) error
+}
+
+var migrations = []migration{
+	{version: 1, name: "rebuild secondary indexes", apply: rebuildIndexes},
+}
+
+var entityBuckets = [][]byte{
+	bucketJourneys, bucketQuests, bucketHabits, bucketEvents,
+	indexQuestsByJourney, indexQuestsByDate, indexQuestsByDone, indexEventsByDate,
+}
+
+func schemaVersionTx(tx *bolt.Tx) int {
+	meta := tx.Bucket(bucketMeta)
+	if meta == nil {
+		return 0
+	}
+	v := meta.Get(metaSchemaVersion)
+	if len(v) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(v))
+}
+
+func setSchemaVersionTx(tx *bolt.Tx, version int) error {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(version))
+	return tx.Bucket(bucketMeta).Put(metaSchemaVersion, v)
+}
+
+// ensureSchema brings the database up to SchemaVersion. If a migration
+// fails, or the file was written by a newer build, the cached entities are
+// dropped so the next sync rebuilds them from the server instead of decoding
+// data of the wrong shape. Queued offline changes are always kept, and data
+// of the local backend is never dropped since there is nothing to resync.
+func (s *Storage) ensureSchema() error {
+	if s.schemaChecked.Load() {
+		return nil
+	}
+
+	dbPath, err := s.getDBPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	var current int
+	if err := s.updateDB(func(tx *bolt.Tx) error {
+		current = schemaVersionTx(tx)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if current == SchemaVersion {
+		s.schemaChecked.Store(true)
+		return nil
+	}
+
+	migrateErr := fmt.Errorf("cache schema %d is newer than supported version %d", current, SchemaVersion)
+	if current < SchemaVersion {
+		migrateErr = s.updateDB(func(tx *bolt.Tx) error {
+			for _, m := range migrations {
+				if m.version <= current {
+					continue
+				}
+				if err := m.apply(tx, s.sealer.Load()); err != nil {
+					return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+				}
+			}
+			return setSchemaVersionTx(tx, SchemaVersion)
+		})
+	}
+
+	if migrateErr != nil {
+		if s.local {
+			return fmt.Errorf("failed to migrate local data: %w", migrateErr)
+		}
+		if err := s.updateDB(resetEntitiesTx); err != nil {
+			return fmt.Errorf("failed to reset cache after %v: %w", migrateErr, err)
+		}
+	}
+
+	s.schemaChecked.Store(true)
+	return nil
+}
+
+func resetEntitiesTx(tx *bolt.Tx) error {
+	for _, name := range entityBuckets {
+		if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		if _, err := tx.CreateBucket(name); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(bucketMeta).Delete(metaTimestamp); err != nil {
+		return err
+	}
+	return setSchemaVersionTx(tx, SchemaVersion)
+}
+
+func rebuildIndexes(tx *bolt.Tx, sc *sealer) error {
+	for _, name := range [][]byte{indexQuestsByJourney, indexQuestsByDate, indexQuestsByDone, indexEventsByDate} {
+		if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		if _, err := tx.CreateBucket(name); err != nil {
+			return err
+		}
+	}
+
+	quests, err := readBucket[models.Quest](tx, sc, bucketQuests)
+	if err != nil {
+		return err
+	}
+	for _, q := range quests {
+		if err := putIndexes(tx, questIndexes(q)); err != nil {
+			return err
+		}
+	}
+
+	events, err := readBucket[models.Event](tx, sc, bucketEvents)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if err := putIndexes(tx, eventIndexes(e)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type CacheInfo struct {
+	Path          string
+	SizeBytes     int64
+	SchemaVersion int
+	Encryption    string
+	LastSynced    time.Time
+	Counts        map[string]int
+	// OpenQuests, LooseQuests (outside any journey), QuestsToday and
+	// EventsToday come from the secondary indexes.
+	OpenQuests  int
+	LooseQuests int
+	QuestsToday int
+	EventsToday int
+	PendingOps  []PendingOp
+	FailedOps   []FailedOp
+}
+
+func (s *Storage) InspectCache() (*CacheInfo, error) {
+	dbPath, err := s.getDBPath()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &CacheInfo{Path: dbPath, Encryption: s.config.CacheEncryption, Counts: map[string]int{}}
+
+	stat, err := os.Stat(dbPath)
+	if os.IsNotExist(err) {
+		return info, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info.SizeBytes = stat.Size()
+
+	err = s.withDB(false, func(tx *bolt.Tx) error {
+		info.SchemaVersion = schemaVersionTx(tx)
+
+		if meta := tx.Bucket(bucketMeta); meta != nil && meta.Get(metaTimestamp) != nil {
+			if err := info.LastSynced.UnmarshalText(meta.Get(metaTimestamp)); err != nil {
+				return err
+			}
+		}
+
+		for _, name := range [][]byte{bucketJourneys, bucketQuests, bucketHabits, bucketEvents} {
+			if b := tx.Bucket(name); b != nil {
+				info.Counts[string(name)] = b.Stats().KeyN
+			}
+		}
+
+		today := []byte(time.Now().Format("2006-01-02"))
+		info.OpenQuests = countIndex(tx, indexQuestsByDone, []byte("0"))
+		info.LooseQuests = countIndex(tx, indexQuestsByJourney, idKey(0))
+		info.QuestsToday = countIndex(tx, indexQuestsByDate, today)
+		info.EventsToday = countIndex(tx, indexEventsByDate, today)
+
+		queue, err := loadQueueTx(tx, s.sealer.Load())
+		if err != nil {
+			return err
+		}
+		info.PendingOps = queue.Ops
+		info.FailedOps = queue.Failed
+		return nil
+	})
+
+	return info, err
+}
+
+// ClearCache deletes cached entities. Unsent offline changes and the daily
+// snapshots are kept unless includePending is set.
+func (s *Storage) ClearCache(includePending bool) error {
+	dbPath, err := s.getDBPath()
+	if err != nil {
+		return err
+	}
+
+	if includePending {
+		lock, err := s.lockCache()
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+
+		if err := s.closeDB(); err != nil {
+			return err
+		}
+		if err := os.Remove(dbPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.RemoveAll(filepath.Join(filepath.Dir(dbPath), "history")); err != nil {
+			return err
+		}
+		s.setupMu.Lock()
+		s.sealerMu.Lock()
+		s.schemaChecked.Store(false)
+		s.sealerLoaded.Store(false)
+		s.sealer.Store(nil)
+		s.sealerMu.Unlock()
+		s.setupMu.Unlock()
+		return nil
+	}
+
+	return s.withLockedDB(func(tx *bolt.Tx) error {
+		if err := resetEntitiesTx(tx); err != nil {
+			return err
+		}
+		return bumpRevisionTx(tx)
+	})
+}
+
+// RebuildCache refetches everything and replaces the cached entities in one
+// transaction, so a failed fetch leaves the existing cache untouched.
+func (s *Storage) RebuildCache() (*models.AppData, error) {
+	cache, err := s.fetchAll()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.withLockedDB(func(tx *bolt.Tx) error {
+		if err := resetEntitiesTx(tx); err != nil {
+			return err
+		}
+		return writeCacheTx(tx, s.sealer.Load(), cache)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.saveSnapshot(cache)
+
+	return buildAppData(cache.Journeys, cache.Quests, cache.Habits, cache.Events), nil
+}
@@ -1,22 +1,44 @@
 package storage
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"marcel-cli/api"
 	"marcel-cli/config"
 	"marcel-cli/models"
+
+	bolt "go.etcd.io/bbolt"
 )
 
+// Storage is safe for concurrent use: the TUI runs its saves and syncs side
+// by side. The database is set up once, under setupMu, and the client and
+// sealer are swapped atomically. The passphrase is guarded by sealerMu.
 type Storage struct {
 	config    *config.Config
-	apiClient *api.Client
+	apiClient atomic.Pointer[api.Client]
+	local     bool
+
+	setupMu       sync.Mutex
+	schemaChecked atomic.Bool
+	sealerMu      sync.Mutex
+	sealer        atomic.Pointer[sealer]
+	sealerLoaded  atomic.Bool
+	passphrase    string
+	noPrompt      bool
+
+	dbMu   sync.Mutex
+	db     *bolt.DB
+	dbUses int
 }
 
 type CacheData struct {
+	Version   int              `json:"version"`
 	Timestamp time.Time        `json:"timestamp"`
 	Journeys  []models.Journey `json:"journeys"`
 	Quests    []models.Quest   `json:"quests"`
@@ -30,16 +52,47 @@ func New() (*Storage, error) {
 		return nil, err
 	}
 
-	client := api.NewClient(cfg)
+	return newStorage(cfg), nil
+}
 
-	return &Storage{
-		config:    cfg,
-		apiClient: client,
-	}, nil
+// Open returns the backend selected by the backend key in the config file,
+// with its cache unlocked. Any passphrase prompt happens here, before the
+// TUI takes over the terminal; later access fails instead of asking.
+func Open() (Repository, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Backend == config.BackendLocal {
+		l := NewLocal(cfg)
+		if err := l.s.unlockCache(); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+
+	s := newStorage(cfg)
+	if err := s.unlockCache(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newStorage(cfg *config.Config) *Storage {
+	s := &Storage{config: cfg}
+	s.apiClient.Store(api.NewClient(cfg))
+	return s
 }
 
 func (s *Storage) Load() (*models.AppData, error) {
-	return s.LoadAll()
+	data, err := s.LoadAll()
+	if err != nil && api.IsOffline(err) {
+		if cached, cacheErr := s.LoadFromCache(); cacheErr == nil {
+			return cached, nil
+		}
+	}
+	return data, err
 }
 
 func (s *Storage) Save(data *models.AppData) error {
@@ -50,120 +103,112 @@ func (s *Storage) GetConfig() *config.Config {
 	return s.config
 }
 
-func (s *Storage) GetAPIClient() *api.Client {
-	return s.apiClient
+func (s *Storage) CheckAuth() error {
+	return s.apiClient.Load().CheckAuth()
 }
 
-func (s *Storage) getCachePath() (string, error) {
-	homeDir, err := os.UserHomeDir()
+// Login validates token against the server, stores it and switches this
+// storage over to it. It returns the account and where the token was kept.
+func (s *Storage) Login(token string) (*models.User, string, error) {
+	cfg := *s.config
+	cfg.AuthToken = token
+	client := api.NewClient(&cfg)
+
+	if err := client.CheckAuth(); err != nil {
+		return nil, "", err
+	}
+	user, err := client.GetMe()
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
 
-	cacheDir := filepath.Join(homeDir, ".marcel")
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		return "", err
+	where, err := s.config.SaveToken(token)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to store token: %w", err)
 	}
 
-	return filepath.Join(cacheDir, "cache.json"), nil
+	s.config.AuthToken = token
+	s.apiClient.Store(client)
+	return user, where, nil
 }
 
-func (s *Storage) LoadFromCache() (*models.AppData, error) {
-	cachePath, err := s.getCachePath()
-	if err != nil {
-		return nil, err
+// Logout forgets the stored token and deletes the cache, including unsynced
+// offline changes and snapshots that belong to the account.
+func (s *Storage) Logout() error {
+	if err := s.config.DeleteToken(); err != nil {
+		return fmt.Errorf("failed to remove token: %w", err)
 	}
+	s.config.AuthToken = ""
+	s.apiClient.Store(api.NewClient(s.config))
+	return s.ClearCache(true)
+}
 
-	data, err := os.ReadFile(cachePath)
-	if err != nil {
-		return nil, err
+func (s *Storage) getCachePath() (string, error) {
+	cacheDir := s.config.Paths.CacheDir
+	if s.local {
+		cacheDir = filepath.Join(s.config.Paths.StateDir, "local")
 	}
-
-	var cache CacheData
-	if err := json.Unmarshal(data, &cache); err != nil {
-		return nil, err
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return "", err
 	}
 
-	appData := models.NewAppData()
-
-	questsByJourney := make(map[int][]models.Quest)
-	var unassignedQuests []models.Quest
+	return filepath.Join(cacheDir, "cache.json"), nil
+}
 
-	for _, quest := range cache.Quests {
-		if quest.JourneyID != nil {
-			questsByJourney[*quest.JourneyID] = append(questsByJourney[*quest.JourneyID], quest)
-		} else {
-			unassignedQuests = append(unassignedQuests, quest)
+func (s *Storage) readCache() (*CacheData, error) {
+	var cache *CacheData
+	err := s.withDB(false, func(tx *bolt.Tx) error {
+		var err error
+		cache, err = readCacheTx(tx, s.sealer.Load())
+		if err == nil && cache.Version != SchemaVersion {
+			// Another process with a different build rewrote the cache
+			// since this one checked the schema.
+			err = fmt.Errorf("%w: schema %d, want %d", errCorruptCache, cache.Version, SchemaVersion)
 		}
-	}
+		return err
+	})
+	return cache, err
+}
 
-	if len(unassignedQuests) > 0 {
-		appData.Journeys = append(appData.Journeys, models.Journey{
-			ID:     0,
-			Name:   "My Quests",
-			Quests: unassignedQuests,
-		})
-	}
+func (s *Storage) writeCache(cache *CacheData) error {
+	return s.withLockedDB(func(tx *bolt.Tx) error {
+		return writeCacheTx(tx, s.sealer.Load(), cache)
+	})
+}
 
-	for _, journey := range cache.Journeys {
-		journey.Quests = questsByJourney[journey.ID]
-		if len(journey.Quests) > 0 || journey.ID != 0 {
-			appData.Journeys = append(appData.Journeys, journey)
+func (s *Storage) LoadFromCache() (*models.AppData, error) {
+	cache, err := s.readCache()
+	if err != nil {
+		if errors.Is(err, errCorruptCache) {
+			s.ClearCache(false)
 		}
+		return nil, err
 	}
 
-	appData.Habits = cache.Habits
-	appData.Events = cache.Events
-	appData.CurrentSection = "quests"
-
-	return &appData, nil
+	return buildAppData(cache.Journeys, cache.Quests, cache.Habits, cache.Events), nil
 }
 
 func (s *Storage) SaveToCache(journeys []models.Journey, quests []models.Quest, habits []models.Habit, events []models.Event) error {
-	cachePath, err := s.getCachePath()
-	if err != nil {
-		return err
-	}
-
-	cache := CacheData{
+	return s.writeCache(&CacheData{
+		Version:   SchemaVersion,
 		Timestamp: time.Now(),
 		Journeys:  journeys,
 		Quests:    quests,
 		Habits:    habits,
 		Events:    events,
-	}
-
-	data, err := json.MarshalIndent(cache, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(cachePath, data, 0644)
+	})
 }
 
-func (s *Storage) LoadWithCache() (*models.AppData, error) {
-	cachedData, err := s.LoadFromCache()
-	if err == nil {
-		go func() {
-			s.LoadAll()
-		}()
-		return cachedData, nil
-	}
-
-	return s.LoadQuestsOnly()
-}
-
-func (s *Storage) LoadQuestsOnly() (*models.AppData, error) {
+func buildAppData(journeys []models.Journey, quests []models.Quest, habits []models.Habit, events []models.Event) *models.AppData {
 	data := models.NewAppData()
 
-	quests, err := s.apiClient.GetQuests()
-	if err != nil {
-		return &data, err
-	}
-
+	questsByJourney := make(map[int][]models.Quest)
 	var unassignedQuests []models.Quest
+
 	for _, quest := range quests {
-		if quest.JourneyID == nil {
+		if quest.JourneyID != nil {
+			questsByJourney[*quest.JourneyID] = append(questsByJourney[*quest.JourneyID], quest)
+		} else {
 			unassignedQuests = append(unassignedQuests, quest)
 		}
 	}
@@ -176,65 +221,69 @@ func (s *Storage) LoadQuestsOnly() (*models.AppData, error) {
 		})
 	}
 
+	for _, journey := range journeys {
+		journey.Quests = questsByJourney[journey.ID]
+		if len(journey.Quests) > 0 || journey.ID != 0 {
+			data.Journeys = append(data.Journeys, journey)
+		}
+	}
+
+	data.Habits = habits
+	data.Events = events
 	data.CurrentSection = "quests"
 
-	return &data, nil
+	return &data
 }
 
+// LoadAll syncs with the server. Offline changes the server refused come
+// back as a *RejectedError alongside the data, which is still up to date.
 func (s *Storage) LoadAll() (*models.AppData, error) {
-	data := models.NewAppData()
-
-	quests, err := s.apiClient.GetQuests()
+	cache, err := s.fetchAll()
 	if err != nil {
+		data := models.NewAppData()
 		return &data, err
 	}
 
-	journeys, err := s.apiClient.GetJourneys()
-	if err != nil {
-		return &data, err
+	if err := s.writeCache(cache); err != nil {
+		data := models.NewAppData()
+		return &data, fmt.Errorf("failed to update the cache: %w", err)
 	}
+	s.saveSnapshot(cache)
 
-	habits, err := s.apiClient.GetHabits()
-	if err != nil {
-		return &data, err
+	return buildAppData(cache.Journeys, cache.Quests, cache.Habits, cache.Events), s.takeRejected()
+}
+
+func (s *Storage) fetchAll() (*CacheData, error) {
+	if err := s.FlushPending(); err != nil {
+		return nil, err
 	}
 
-	events, err := s.apiClient.GetEvents()
+	quests, err := s.apiClient.Load().GetQuests()
 	if err != nil {
-		return &data, err
+		return nil, err
 	}
 
-	questsByJourney := make(map[int][]models.Quest)
-	var unassignedQuests []models.Quest
-
-	for _, quest := range quests {
-		if quest.JourneyID != nil {
-			questsByJourney[*quest.JourneyID] = append(questsByJourney[*quest.JourneyID], quest)
-		} else {
-			unassignedQuests = append(unassignedQuests, quest)
-		}
+	journeys, err := s.apiClient.Load().GetJourneys()
+	if err != nil {
+		return nil, err
 	}
 
-	if len(unassignedQuests) > 0 {
-		data.Journeys = append(data.Journeys, models.Journey{
-			ID:     0,
-			Name:   "My Quests",
-			Quests: unassignedQuests,
-		})
+	habits, err := s.apiClient.Load().GetHabits()
+	if err != nil {
+		return nil, err
 	}
 
-	for _, journey := range journeys {
-		journey.Quests = questsByJourney[journey.ID]
-		if len(journey.Quests) > 0 || journey.ID != 0 {
-			data.Journeys = append(data.Journeys, journey)
-		}
+	events, err := s.apiClient.Load().GetEvents()
+	if err != nil {
+		return nil, err
 	}
 
-	data.Habits = habits
-	data.Events = events
-	data.CurrentSection = "quests"
-
-	s.SaveToCache(journeys, quests, habits, events)
-
-	return &data, nil
+	return &CacheData{
+		Version:   SchemaVersion,
+		Timestamp: time.Now(),
+		Journeys:  journeys,
+		Quests:    quests,
+		Habits:    habits,
+		Events:    events,
+	}, nil
 }
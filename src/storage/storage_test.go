@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"marcel-cli/api"
+	"marcel-cli/config"
+	"marcel-cli/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestStorage(t *testing.T, apiURL string) *Storage {
+	t.Helper()
+	dir := t.TempDir()
+	return newStorage(&config.Config{
+		APIURL:          apiURL,
+		AuthToken:       "token",
+		CacheEncryption: config.EncryptionNone,
+		Paths:           config.Paths{CacheDir: dir, StateDir: dir},
+	})
+}
+
+// fakeQuestServer answers the quest endpoints and lists no journeys, habits
+// or events. Updates to quest 7 are refused, and If-Unmodified-Since is
+// honoured.
+type fakeQuestServer struct {
+	mu       sync.Mutex
+	quests   map[int]models.Quest
+	nextID   int
+	requests []string
+}
+
+func (f *fakeQuestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	var id int
+	fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/quest/"), "%d", &id)
+	stamp := time.Date(2024, 1, 1, 9, 0, len(f.requests), 0, time.UTC)
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/quest":
+		var quests []models.Quest
+		for _, q := range f.quests {
+			quests = append(quests, q)
+		}
+		json.NewEncoder(w).Encode(api.QuestsResponse{Quests: quests})
+	case r.Method == "GET" && r.URL.Path == "/journey":
+		json.NewEncoder(w).Encode(api.JourneysResponse{})
+	case r.Method == "GET" && r.URL.Path == "/habit":
+		json.NewEncoder(w).Encode(api.HabitsResponse{})
+	case r.Method == "GET" && r.URL.Path == "/event":
+		json.NewEncoder(w).Encode(api.EventsResponse{})
+	case r.Method == "POST" && r.URL.Path == "/quest":
+		var req api.CreateQuestRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.nextID++
+		q := models.Quest{ID: f.nextID, Title: req.Title, UpdatedAt: stamp}
+		f.quests[q.ID] = q
+		json.NewEncoder(w).Encode(api.QuestResponse{Quest: q})
+	case r.Method == "PUT" && id == 7:
+		http.Error(w, "nope", http.StatusBadRequest)
+	case r.Method == "PUT" && f.changedSince(id, r):
+		w.WriteHeader(http.StatusPreconditionFailed)
+	case r.Method == "PUT":
+		var req api.UpdateQuestRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		q := f.quests[id]
+		applyQuestUpdate(&q, req)
+		q.UpdatedAt = stamp
+		f.quests[id] = q
+		json.NewEncoder(w).Encode(api.QuestResponse{Quest: q})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// changedSince reports whether quest id changed after the If-Unmodified-Since
+// date of r, at the one-second resolution of HTTP dates.
+func (f *fakeQuestServer) changedSince(id int, r *http.Request) bool {
+	since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since"))
+	return err == nil && f.quests[id].UpdatedAt.Truncate(time.Second).After(since)
+}
+
+// TestConcurrentMutations runs saves, syncs and a config reload side by
+// side, as the TUI does, on a fresh encrypted cache. Run it with -race.
+func TestConcurrentMutations(t *testing.T) {
+	server := &fakeQuestServer{quests: map[int]models.Quest{}}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	s := newTestStorage(t, srv.URL)
+	cfg := s.GetConfig()
+	cfg.CacheEncryption = config.EncryptionKeyFile
+	cfg.CacheKeyFile = filepath.Join(t.TempDir(), "cache.key")
+
+	next := *cfg
+	next.WeekStartDay = "monday"
+
+	const saves = 8
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range saves {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+			if _, err := s.CreateQuest(fmt.Sprintf("quest %d", i), "", "easy", nil); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			if _, err := s.LoadAll(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	close(start)
+	cfg.Update(&next)
+	wg.Wait()
+
+	if _, err := s.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := s.readCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.Quests) != saves {
+		t.Errorf("cached %d quests, want %d", len(cache.Quests), saves)
+	}
+	if s.PendingCount() != 0 {
+		t.Errorf("%d ops left in the queue", s.PendingCount())
+	}
+}
+
+func TestOfflineUpdateOfUncachedItem(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	name := "renamed"
+	tests := []struct {
+		name   string
+		update func(s *Storage) error
+	}{
+		{"quest", func(s *Storage) error {
+			_, err := s.UpdateQuest(5, api.UpdateQuestRequest{Title: &name})
+			return err
+		}},
+		{"journey", func(s *Storage) error {
+			_, err := s.UpdateJourney(5, api.UpdateJourneyRequest{Name: &name})
+			return err
+		}},
+		{"habit", func(s *Storage) error {
+			_, err := s.UpdateHabit(5, api.UpdateHabitRequest{Name: &name})
+			return err
+		}},
+		{"event", func(s *Storage) error {
+			_, err := s.UpdateEvent(5, api.UpdateEventRequest{Title: &name})
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t, srv.URL)
+			if err := tt.update(s); err == nil || !strings.Contains(err.Error(), "not in the cache") {
+				t.Fatalf("got error %v, want one about the cache", err)
+			}
+			if n := s.PendingCount(); n != 0 {
+				t.Errorf("queued %d ops for an item that is not cached", n)
+			}
+		})
+	}
+}
+
+func TestLoadFromCacheClearsOnlyCorruptData(t *testing.T) {
+	tests := []struct {
+		name      string
+		damage    func(tx *bolt.Tx) error
+		wantClear bool
+	}{
+		{"undecodable row", func(tx *bolt.Tx) error {
+			return tx.Bucket(bucketQuests).Put(idKey(1), []byte("{"))
+		}, true},
+		{"newer schema", func(tx *bolt.Tx) error {
+			return setSchemaVersionTx(tx, SchemaVersion+1)
+		}, true},
+		{"encrypted row with encryption off", func(tx *bolt.Tx) error {
+			return tx.Bucket(bucketQuests).Put(idKey(1), []byte{sealedPrefix, 0})
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t, "http://127.0.0.1:0")
+			defer s.closeDB()
+			if err := s.SaveToCache(nil, []models.Quest{{ID: 2, Title: "walk"}}, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			// A new cache gets its schema version on the next read.
+			if _, err := s.readCache(); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.updateDB(tt.damage); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.LoadFromCache(); err == nil {
+				t.Fatal("loaded a damaged cache")
+			}
+			_, err := s.readCache()
+			if cleared := errors.Is(err, errNoCache); cleared != tt.wantClear {
+				t.Errorf("cleared = %v (read error %v), want %v", cleared, err, tt.wantClear)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	bolt "go.etcd.io/bbolt"
+)
+
+func (s *Storage) currentRevision() (uint64, string) {
+	var revision uint64
+	var writer string
+	s.withDB(false, func(tx *bolt.Tx) error {
+		revision, writer = revisionTx(tx)
+		return nil
+	})
+	return revision, writer
+}
+
+// WatchCache calls onChange whenever another marcel process commits new data
+// to the cache. Writes made by this process are ignored. The returned
+// function stops the watcher.
+func (s *Storage) WatchCache(onChange func()) (func() error, error) {
+	dbPath, err := s.getDBPath()
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := watcher.Add(filepath.Dir(dbPath)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	lastSeen, _ := s.currentRevision()
+
+	var mu sync.Mutex
+	var debounce *time.Timer
+
+	check := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		revision, writer := s.currentRevision()
+		if revision == lastSeen {
+			return
+		}
+		lastSeen = revision
+		if writer != instanceID {
+			onChange()
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Base(event.Name) != filepath.Base(dbPath) {
+					continue
+				}
+				if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+					continue
+				}
+				mu.Lock()
+				if debounce != nil {
+					debounce.Stop()
+				}
+				debounce = time.AfterFunc(150*time.Millisecond, check)
+				mu.Unlock()
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+
+	return watcher.Close, nil
+}
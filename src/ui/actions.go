@@ -1,9 +1,12 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
 	"marcel-cli/api"
 	"marcel-cli/models"
+	"marcel-cli/storage"
+	"slices"
 	"strings"
 	"time"
 
@@ -11,31 +14,46 @@ import (
 )
 
 func (m Model) toggleQuest(quest models.Quest) (Model, tea.Cmd) {
-	newDone := !quest.Done
-
-	_, err := m.storage.GetAPIClient().ToggleQuest(quest.ID, newDone)
-	if err != nil {
-		m.message = fmt.Sprintf("Failed to toggle quest: %v", err)
+	if m, busy := m.busy("quest", quest.ID); busy {
 		return m, nil
 	}
+	newDone := !quest.Done
 
-	for i := range m.data.Journeys {
-		for j := range m.data.Journeys[i].Quests {
-			if m.data.Journeys[i].Quests[j].ID == quest.ID {
-				m.data.Journeys[i].Quests[j].Done = newDone
-			}
-		}
-	}
-
-	m.questList = newQuestList(m.data, m.width-4, m.height-8)
+	restore := keepQuest(m.data, quest.ID)
+	quest.Done = newDone
+	putQuest(m.data, quest)
 
 	if newDone {
 		m.message = "✓ Quest completed!"
 	} else {
 		m.message = "Quest marked as incomplete"
 	}
+	clearCmd := clearMessageAfter(m.message, 1*time.Second)
 
-	return m, clearMessageAfter(1 * time.Second)
+	s := m.storage
+	m, cmd := m.mutate(pendingKey{"quest", quest.ID}, func() func(Model) (Model, tea.Cmd) {
+		updated, err := s.ToggleQuest(quest.ID, newDone)
+		return func(m Model) (Model, tea.Cmd) {
+			if err != nil {
+				return m.rollBack(restore, fmt.Sprintf("Failed to toggle quest: %v", err))
+			}
+			putQuest(m.data, *updated)
+			m.undo.record(change{
+				desc: fmt.Sprintf("%s quest %q", doneVerb(newDone, "completed", "reopened"), quest.Title),
+				undo: questDoneStep(quest.ID, !newDone),
+				redo: questDoneStep(quest.ID, newDone),
+			})
+			return m, nil
+		}
+	})
+	return m, tea.Batch(cmd, clearCmd)
+}
+
+func doneVerb(done bool, yes, no string) string {
+	if done {
+		return yes
+	}
+	return no
 }
 
 func (m Model) showDeleteConfirm(quest models.Quest) Model {
@@ -46,105 +64,119 @@ func (m Model) showDeleteConfirm(quest models.Quest) Model {
 }
 
 func (m Model) confirmDeleteQuest() (Model, tea.Cmd) {
-	if m.confirmQuest == nil {
-		m.mode = QuestListView
+	quest := m.confirmQuest
+	m = m.backToList()
+	m.confirmQuest = nil
+	if quest == nil {
 		return m, nil
 	}
-
-	err := m.storage.GetAPIClient().DeleteQuest(m.confirmQuest.ID)
-	if err != nil {
-		m.message = fmt.Sprintf("Failed to delete quest: %v", err)
-		m.mode = QuestListView
-		m.confirmQuest = nil
+	if m, busy := m.busy("quest", quest.ID); busy {
 		return m, nil
 	}
 
-	for i := range m.data.Journeys {
-		newQuests := []models.Quest{}
-		for _, q := range m.data.Journeys[i].Quests {
-			if q.ID != m.confirmQuest.ID {
-				newQuests = append(newQuests, q)
+	restore := keepQuest(m.data, quest.ID)
+	removeQuest(m.data, quest.ID)
+	m.message = "Quest deleted successfully"
+	clearCmd := clearMessageAfter(m.message, 1*time.Second)
+
+	s := m.storage
+	m, cmd := m.mutate(pendingKey{"quest", quest.ID}, func() func(Model) (Model, tea.Cmd) {
+		err := s.DeleteQuest(quest.ID)
+		return func(m Model) (Model, tea.Cmd) {
+			if err != nil {
+				return m.rollBack(restore, fmt.Sprintf("Failed to delete quest: %v", err))
 			}
+			m.undo.record(change{
+				desc: fmt.Sprintf("deleted quest %q", quest.Title),
+				undo: createQuestStep(*quest),
+				redo: deleteStep("quest", quest.ID),
+			})
+			return m, nil
 		}
-		m.data.Journeys[i].Quests = newQuests
-	}
-
-	m.questList = newQuestList(m.data, m.width-4, m.height-8)
-	m.message = "Quest deleted successfully"
-	m.mode = QuestListView
-	m.confirmQuest = nil
-
-	return m, clearMessageAfter(1 * time.Second)
+	})
+	return m, tea.Batch(cmd, clearCmd)
 }
 
 func (m Model) confirmDeleteHabit() (Model, tea.Cmd) {
-	if m.confirmHabit == nil {
-		m.mode = QuestListView
+	habit := m.confirmHabit
+	m.mode = QuestListView
+	m.confirmHabit = nil
+	if habit == nil {
 		return m, nil
 	}
-
-	err := m.storage.GetAPIClient().DeleteHabit(m.confirmHabit.ID)
-	if err != nil {
-		m.message = fmt.Sprintf("Failed to delete habit: %v", err)
-		m.mode = QuestListView
-		m.confirmHabit = nil
+	if m, busy := m.busy("habit", habit.ID); busy {
 		return m, nil
 	}
 
-	var newHabits []models.Habit
-	for _, h := range m.data.Habits {
-		if h.ID != m.confirmHabit.ID {
-			newHabits = append(newHabits, h)
-		}
-	}
-	m.data.Habits = newHabits
-
-	m.habitList = newHabitList(m.data, m.width-4, m.height-10)
+	restore := keepHabit(m.data, habit.ID)
+	removeHabit(m.data, habit.ID)
 	m.message = "Habit deleted successfully"
-	m.mode = QuestListView
-	m.confirmHabit = nil
-
-	return m, clearMessageAfter(1 * time.Second)
+	clearCmd := clearMessageAfter(m.message, 1*time.Second)
+
+	s := m.storage
+	m, cmd := m.mutate(pendingKey{"habit", habit.ID}, func() func(Model) (Model, tea.Cmd) {
+		err := s.DeleteHabit(habit.ID)
+		return func(m Model) (Model, tea.Cmd) {
+			if err != nil {
+				return m.rollBack(restore, fmt.Sprintf("Failed to delete habit: %v", err))
+			}
+			m.undo.record(change{
+				desc: fmt.Sprintf("deleted habit %q", habit.Name),
+				undo: createHabitStep(*habit),
+				redo: deleteStep("habit", habit.ID),
+			})
+			return m, nil
+		}
+	})
+	return m, tea.Batch(cmd, clearCmd)
 }
 
 func (m Model) confirmDeleteJourney() (Model, tea.Cmd) {
-	if m.confirmJourney == nil {
-		m.mode = QuestListView
+	journey := m.confirmJourney
+	m.mode = QuestListView
+	m.confirmJourney = nil
+	if journey == nil {
 		return m, nil
 	}
-
-	err := m.storage.GetAPIClient().DeleteJourney(m.confirmJourney.ID)
-	if err != nil {
-		m.message = fmt.Sprintf("Failed to delete journey: %v", err)
-		m.mode = QuestListView
-		m.confirmJourney = nil
+	if m, busy := m.busy("journey", journey.ID); busy {
 		return m, nil
 	}
 
-	var newJourneys []models.Journey
-	for _, j := range m.data.Journeys {
-		if j.ID != m.confirmJourney.ID {
-			newJourneys = append(newJourneys, j)
-		}
-	}
-	m.data.Journeys = newJourneys
-
-	m.journeyList = newJourneyList(m.data, m.width-4, m.height-10)
+	deleted, _ := findJourney(m.data, journey.ID)
+	restore := keepJourney(m.data, journey.ID)
+	removeJourney(m.data, journey.ID)
 	m.message = "Journey deleted successfully"
-	m.mode = QuestListView
-	m.confirmJourney = nil
-
-	return m, clearMessageAfter(1 * time.Second)
+	clearCmd := clearMessageAfter(m.message, 1*time.Second)
+
+	s := m.storage
+	m, cmd := m.mutate(pendingKey{"journey", journey.ID}, func() func(Model) (Model, tea.Cmd) {
+		err := s.DeleteJourney(journey.ID)
+		return func(m Model) (Model, tea.Cmd) {
+			if err != nil {
+				return m.rollBack(restore, fmt.Sprintf("Failed to delete journey: %v", err))
+			}
+			m.undo.record(change{
+				desc: fmt.Sprintf("deleted journey %q", journey.Name),
+				undo: createJourneyStep(deleted),
+				redo: deleteStep("journey", journey.ID),
+			})
+			// The backend decides what happens to the journey's quests.
+			return m.syncAfterSave()
+		}
+	})
+	return m, tea.Batch(cmd, clearCmd)
 }
 
 func (m Model) cancelDelete() Model {
 	returnToCalendar := m.confirmEvent != nil
 
-	m.mode = QuestListView
+	m = m.backToList()
 	m.confirmQuest = nil
 	m.confirmHabit = nil
 	m.confirmJourney = nil
 	m.confirmEvent = nil
+	m.confirmQuests = nil
+	m.confirmHabits = nil
 	m.message = "Deletion cancelled"
 
 	if returnToCalendar {
@@ -154,6 +186,16 @@ func (m Model) cancelDelete() Model {
 	return m
 }
 
+// backToList leaves a dialog for the list it was opened from: the open
+// journey's quests, or the sections.
+func (m Model) backToList() Model {
+	m.mode = QuestListView
+	if m.selectedJourney != nil {
+		m.mode = JourneyDetailView
+	}
+	return m
+}
+
 func (m Model) createNewQuest() (Model, tea.Cmd) {
 	m.questFormData = &QuestForm{
 		Title:      "",
@@ -204,97 +246,122 @@ func (m Model) createNewJourney() (Model, tea.Cmd) {
 
 func (m Model) enterJourney(journey models.Journey) Model {
 	m.selectedJourney = &journey
-	m.journeyQuestList = newJourneyQuestList(&journey, m.width-4, m.height-10)
+	m.marks.clear()
+	m.journeyQuestList = newJourneyQuestList(&journey, m.pending, m.marks, m.views["journey"], m.width-4, m.height-10)
 	m.mode = JourneyDetailView
 	return m
 }
 
-func (m Model) refreshData() Model {
+// refreshData reloads everything, from the server or, without one, from the
+// cache, and shows the loading screen until finishRefresh has the result.
+func (m Model) refreshData() (Model, tea.Cmd) {
 	m.mode = LoadingView
 	m.message = "Refreshing data..."
 
-	data, err := m.storage.Load()
-	if err != nil {
+	load := loadFromAPICmd(m.storage)
+	if m.cacheOnly {
+		load = loadDataCmd(m.storage)
+	}
+	return m, func() tea.Msg {
+		msg := load().(dataLoadedMsg)
+		msg.refresh = true
+		return msg
+	}
+}
+
+func (m Model) finishRefresh(msg dataLoadedMsg) Model {
+	if msg.err != nil {
 		m.mode = ErrorView
-		m.errorMessage = fmt.Sprintf("Failed to load data: %v", err)
+		m.errorMessage = fmt.Sprintf("Failed to load data: %v", msg.err)
 		return m
 	}
 
-	m.data = data
-	m.questList = newQuestList(m.data, m.width-4, m.height-10)
-	m.habitList = newHabitList(m.data, m.width-4, m.height-10)
-	m.journeyList = newJourneyList(m.data, m.width-4, m.height-10)
-	m.calendar.SetEvents(m.data.Events)
-	m.mode = QuestListView
-	m.message = "✓ Data refreshed!"
+	if synced, err := m.storage.CacheTimestamp(); err == nil {
+		m.lastSynced = synced
+	}
 
+	m = m.replaceData(msg.data)
+	m.mode = QuestListView
+	if m.message == "Refreshing data..." {
+		// Rejected offline changes were reported in its place.
+		m.message = "✓ Data refreshed!"
+	}
 	return m
 }
 
 func (m Model) toggleHabit(habit models.Habit) (Model, tea.Cmd) {
-	completedToday := false
-	today := fmt.Sprintf("%d-%02d-%02d", time.Now().Year(), time.Now().Month(), time.Now().Day())
-	for _, d := range habit.Completed {
-		if len(d) >= 10 && d[:10] == today {
-			completedToday = true
-			break
-		}
-	}
-
-	newDone := !completedToday
-
-	_, err := m.storage.GetAPIClient().ToggleHabit(habit.ID, newDone)
-	if err != nil {
-		errMsg := err.Error()
-		if strings.Contains(errMsg, "not scheduled for today") {
-			parts := strings.Split(errMsg, "It's configured for: ")
-			if len(parts) > 1 {
-				configPart := strings.Split(parts[1], ". Next due:")
-				if len(configPart) > 1 {
-					nextDue := strings.TrimSpace(configPart[1])
-					nextDue = strings.TrimSuffix(nextDue, ".")
-					nextDue = strings.TrimSuffix(nextDue, "\"}")
-					nextDue = strings.TrimSuffix(nextDue, "}")
-					m.message = fmt.Sprintf("Not due today. Next: %s", nextDue)
-				} else {
-					m.message = "This habit is not scheduled for today"
-				}
-			} else {
-				m.message = "This habit is not scheduled for today"
-			}
-		} else {
-			m.message = fmt.Sprintf("Failed to toggle habit: %v", err)
-		}
+	if m, busy := m.busy("habit", habit.ID); busy {
 		return m, nil
 	}
 
-	for i := range m.data.Habits {
-		if m.data.Habits[i].ID == habit.ID {
-			if newDone {
-				m.data.Habits[i].Completed = append(m.data.Habits[i].Completed, today)
-				m.data.Habits[i].CurrentStreak++
-			} else {
-				var newCompleted []string
-				for _, d := range m.data.Habits[i].Completed {
-					if len(d) < 10 || d[:10] != today {
-						newCompleted = append(newCompleted, d)
-					}
-				}
-				m.data.Habits[i].Completed = newCompleted
-				m.data.Habits[i].CurrentStreak--
-			}
-		}
-	}
+	today := time.Now().Format("2006-01-02")
+	newDone := !completedToday(habit)
 
-	m.habitList = newHabitList(m.data, m.width-4, m.height-10)
+	// Only today's check mark changes here; the streak is left to the
+	// server, whose reply replaces the habit.
+	restore := keepHabit(m.data, habit.ID)
+	if newDone {
+		habit.Completed = append(slices.Clone(habit.Completed), today)
+	} else {
+		habit.Completed = slices.DeleteFunc(slices.Clone(habit.Completed), func(d string) bool {
+			return len(d) >= 10 && d[:10] == today
+		})
+	}
+	putHabit(m.data, habit)
 
 	if newDone {
 		m.message = "✓ Habit completed!"
 	} else {
 		m.message = "Habit marked as incomplete"
 	}
+	clearCmd := clearMessageAfter(m.message, 1*time.Second)
+
+	s := m.storage
+	m, cmd := m.mutate(pendingKey{"habit", habit.ID}, func() func(Model) (Model, tea.Cmd) {
+		updated, err := s.ToggleHabit(habit.ID, newDone)
+		return func(m Model) (Model, tea.Cmd) {
+			if err != nil {
+				return m.rollBack(restore, habitToggleError(err))
+			}
+			putHabit(m.data, *updated)
+			m.undo.record(change{
+				desc: fmt.Sprintf("%s habit %q", doneVerb(newDone, "checked off", "unchecked"), habit.Name),
+				undo: habitDoneStep(habit.ID, !newDone),
+				redo: habitDoneStep(habit.ID, newDone),
+			})
+			return m, nil
+		}
+	})
+	return m, tea.Batch(cmd, clearCmd)
+}
 
-	return m, clearMessageAfter(1 * time.Second)
+func completedToday(habit models.Habit) bool {
+	today := time.Now().Format("2006-01-02")
+	return slices.ContainsFunc(habit.Completed, func(d string) bool {
+		return len(d) >= 10 && d[:10] == today
+	})
+}
+
+// habitToggleError turns the server's "not scheduled for today" reply into
+// the next due date.
+func habitToggleError(err error) string {
+	errMsg := err.Error()
+	if !strings.Contains(errMsg, "not scheduled for today") {
+		return fmt.Sprintf("Failed to toggle habit: %v", err)
+	}
+
+	parts := strings.Split(errMsg, "It's configured for: ")
+	if len(parts) > 1 {
+		configPart := strings.Split(parts[1], ". Next due:")
+		if len(configPart) > 1 {
+			nextDue := strings.TrimSpace(configPart[1])
+			nextDue = strings.TrimSuffix(nextDue, ".")
+			nextDue = strings.TrimSuffix(nextDue, "\"}")
+			nextDue = strings.TrimSuffix(nextDue, "}")
+			return fmt.Sprintf("Not due today. Next: %s", nextDue)
+		}
+	}
+	return "This habit is not scheduled for today"
 }
 
 func (m Model) showDeleteConfirmHabit(habit models.Habit) Model {
@@ -333,35 +400,38 @@ func (m Model) showDeleteConfirmEvent(event *models.Event) Model {
 }
 
 func (m Model) confirmDeleteEvent() (Model, tea.Cmd) {
-	if m.confirmEvent == nil {
-		m.mode = QuestListView
-		m.currentSection = "calendar"
+	event := m.confirmEvent
+	m.mode = QuestListView
+	m.currentSection = "calendar"
+	m.confirmEvent = nil
+	if event == nil {
 		return m, nil
 	}
-
-	err := m.storage.GetAPIClient().DeleteEvent(m.confirmEvent.ID)
-	if err != nil {
-		m.message = fmt.Sprintf("Failed to delete event: %v", err)
-		m.mode = QuestListView
-		m.currentSection = "calendar"
-		m.confirmEvent = nil
+	if m, busy := m.busy("event", event.ID); busy {
 		return m, nil
 	}
 
-	var newEvents []models.Event
-	for _, e := range m.data.Events {
-		if e.ID != m.confirmEvent.ID {
-			newEvents = append(newEvents, e)
-		}
-	}
-	m.data.Events = newEvents
-	m.calendar.SetEvents(newEvents)
-
+	restore := keepEvent(m.data, event.ID)
+	removeEvent(m.data, event.ID)
 	m.message = "Event deleted successfully"
-	m.mode = QuestListView
-	m.currentSection = "calendar"
-	m.confirmEvent = nil
-	return m, clearMessageAfter(1 * time.Second)
+	clearCmd := clearMessageAfter(m.message, 1*time.Second)
+
+	s := m.storage
+	m, cmd := m.mutate(pendingKey{"event", event.ID}, func() func(Model) (Model, tea.Cmd) {
+		err := s.DeleteEvent(event.ID)
+		return func(m Model) (Model, tea.Cmd) {
+			if err != nil {
+				return m.rollBack(restore, fmt.Sprintf("Failed to delete event: %v", err))
+			}
+			m.undo.record(change{
+				desc: fmt.Sprintf("deleted event %q", event.Title),
+				undo: createEventStep(*event),
+				redo: deleteStep("event", event.ID),
+			})
+			return m, nil
+		}
+	})
+	return m, tea.Batch(cmd, clearCmd)
 }
 
 func (m Model) editQuest(quest models.Quest) (Model, tea.Cmd) {
@@ -432,16 +502,19 @@ func (m Model) editEvent(event *models.Event) (Model, tea.Cmd) {
 	return m, m.eventForm.Init()
 }
 
+// handleFormCompletion closes the form right away and saves in the
+// background; the lists pick up the result when the request is done.
 func (m Model) handleFormCompletion() (tea.Model, tea.Cmd) {
-	var returnMode ViewMode = QuestListView
-	var message string
+	s := m.storage
 
 	switch m.mode {
 	case QuestFormView:
+		m.mode = QuestListView
+		if m.selectedJourney != nil {
+			m.mode = JourneyDetailView
+		}
 		if m.questFormData.Title == "" {
-			message = "Quest title cannot be empty"
-			m.mode = returnMode
-			m.message = message
+			m.message = "Quest title cannot be empty"
 			return m, nil
 		}
 
@@ -452,287 +525,411 @@ func (m Model) handleFormCompletion() (tea.Model, tea.Cmd) {
 			journeyID = &m.selectedJourney.ID
 		}
 
-		quest, err := m.storage.GetAPIClient().CreateQuest(
-			m.questFormData.Title,
-			m.questFormData.Note,
-			m.questFormData.Difficulty,
-			journeyID,
-		)
-
-		if err != nil {
-			message = fmt.Sprintf("Failed to create quest: %v", err)
-			m.mode = returnMode
-			m.message = message
-			return m, nil
-		}
-
-		message = fmt.Sprintf("✓ Quest created: %s", quest.Title)
+		form := *m.questFormData
+		m.message = "Creating quest..."
+		return m.mutate(pendingKey{kind: "quest"}, func() func(Model) (Model, tea.Cmd) {
+			quest, err := s.CreateQuest(form.Title, form.Note, form.Difficulty, journeyID)
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					m.message = fmt.Sprintf("Failed to create quest: %v", err)
+					return m, nil
+				}
+				putQuest(m.data, *quest)
+				m.undo.record(change{
+					desc: fmt.Sprintf("created quest %q", quest.Title),
+					undo: deleteStep("quest", quest.ID),
+					redo: createQuestStep(*quest),
+				})
+				return m.saved(createdMessage("Quest", quest.Title, quest.ID))
+			}
+		})
 
+	case JourneyFormView:
+		m.mode = QuestListView
 		if m.selectedJourney != nil {
-			returnMode = JourneyDetailView
+			m.mode = JourneyDetailView
 		}
-
-	case JourneyFormView:
 		if m.journeyFormData.Name == "" {
-			message = "Journey name cannot be empty"
-			m.mode = returnMode
-			return m, nil
-		}
-
-		journey, err := m.storage.GetAPIClient().CreateJourney(m.journeyFormData.Name)
-		if err != nil {
-			message = fmt.Sprintf("Failed to create journey: %v", err)
-			m.mode = returnMode
-			m.message = message
+			m.message = "Journey name cannot be empty"
 			return m, nil
 		}
 
-		message = fmt.Sprintf("✓ Journey created: %s", journey.Name)
+		name := m.journeyFormData.Name
 		m.currentSection = "journeys"
-
-		if m.selectedJourney != nil {
-			returnMode = JourneyDetailView
-		}
+		m.message = "Creating journey..."
+		return m.mutate(pendingKey{kind: "journey"}, func() func(Model) (Model, tea.Cmd) {
+			journey, err := s.CreateJourney(name)
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					m.message = fmt.Sprintf("Failed to create journey: %v", err)
+					return m, nil
+				}
+				putJourney(m.data, *journey)
+				m.undo.record(change{
+					desc: fmt.Sprintf("created journey %q", journey.Name),
+					undo: deleteStep("journey", journey.ID),
+					redo: createJourneyStep(*journey),
+				})
+				return m.saved(createdMessage("Journey", journey.Name, journey.ID))
+			}
+		})
 
 	case HabitFormView:
+		m.mode = QuestListView
 		if m.habitFormData.Name == "" {
-			message = "Habit name cannot be empty"
-			m.mode = returnMode
+			m.message = "Habit name cannot be empty"
 			return m, nil
 		}
 
-		habit, err := m.storage.GetAPIClient().CreateHabit(
-			m.habitFormData.Name,
-			m.habitFormData.CycleType,
-			m.habitFormData.CycleConfig,
-		)
-
-		if err != nil {
-			message = fmt.Sprintf("Failed to create habit: %v", err)
-			m.mode = returnMode
-			m.message = message
-			return m, nil
-		}
-
-		message = fmt.Sprintf("✓ Habit created: %s", habit.Name)
+		form := *m.habitFormData
+		m.message = "Creating habit..."
+		return m.mutate(pendingKey{kind: "habit"}, func() func(Model) (Model, tea.Cmd) {
+			habit, err := s.CreateHabit(form.Name, form.CycleType, form.CycleConfig)
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					m.message = fmt.Sprintf("Failed to create habit: %v", err)
+					return m, nil
+				}
+				putHabit(m.data, *habit)
+				m.undo.record(change{
+					desc: fmt.Sprintf("created habit %q", habit.Name),
+					undo: deleteStep("habit", habit.ID),
+					redo: createHabitStep(*habit),
+				})
+				return m.saved(createdMessage("Habit", habit.Name, habit.ID))
+			}
+		})
 
 	case EventFormView:
+		m.mode = QuestListView
+		m.currentSection = "calendar"
 		if m.eventFormData.Title == "" {
-			message = "Event title cannot be empty"
-			m.mode = returnMode
-			m.currentSection = "calendar"
+			m.message = "Event title cannot be empty"
 			return m, nil
 		}
 
-		var timePtr, endTimePtr, locationPtr, descriptionPtr *string
-		if m.eventFormData.Time != "" {
-			timePtr = &m.eventFormData.Time
-		}
-		if m.eventFormData.EndTime != "" {
-			endTimePtr = &m.eventFormData.EndTime
-		}
-		if m.eventFormData.Location != "" {
-			locationPtr = &m.eventFormData.Location
-		}
-		if m.eventFormData.Description != "" {
-			descriptionPtr = &m.eventFormData.Description
-		}
-
-		event, err := m.storage.GetAPIClient().CreateEvent(api.CreateEventRequest{
-			Title:       m.eventFormData.Title,
-			Date:        m.eventFormData.Date,
-			Time:        timePtr,
-			EndTime:     endTimePtr,
-			Location:    locationPtr,
-			Description: descriptionPtr,
+		form := *m.eventFormData
+		timePtr, endTimePtr, locationPtr, descriptionPtr := form.optionalFields()
+		m.message = "Creating event..."
+		return m.mutate(pendingKey{kind: "event"}, func() func(Model) (Model, tea.Cmd) {
+			event, err := s.CreateEvent(api.CreateEventRequest{
+				Title:       form.Title,
+				Date:        form.Date,
+				Time:        timePtr,
+				EndTime:     endTimePtr,
+				Location:    locationPtr,
+				Description: descriptionPtr,
+			})
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					m.message = fmt.Sprintf("Failed to create event: %v", err)
+					return m, nil
+				}
+				putEvent(m.data, *event)
+				m.undo.record(change{
+					desc: fmt.Sprintf("created event %q", event.Title),
+					undo: deleteStep("event", event.ID),
+					redo: createEventStep(*event),
+				})
+				return m.saved(createdMessage("Event", event.Title, event.ID))
+			}
 		})
 
-		if err != nil {
-			message = fmt.Sprintf("Failed to create event: %v", err)
-			m.mode = returnMode
-			m.currentSection = "calendar"
-			m.message = message
-			return m, nil
-		}
-
-		message = fmt.Sprintf("✓ Event created: %s", event.Title)
-
-		m.currentSection = "calendar"
-		returnMode = QuestListView
-
 	case QuestEditFormView:
-		if m.editingQuest == nil {
-			message = "No quest being edited"
-			m.mode = QuestListView
-			m.message = message
+		base := m.editingQuest
+		m.editingQuest = nil
+		m.mode = QuestListView
+		if m.selectedJourney != nil {
+			m.mode = JourneyDetailView
+		}
+		if base == nil {
+			m.message = "No quest being edited"
 			return m, nil
 		}
-
 		if m.questFormData.Title == "" {
-			message = "Quest title cannot be empty"
-			m.mode = QuestListView
-			m.message = message
+			m.message = "Quest title cannot be empty"
 			return m, nil
 		}
-
-		quest, err := m.storage.GetAPIClient().UpdateQuest(m.editingQuest.ID, api.UpdateQuestRequest{
-			Title:      &m.questFormData.Title,
-			Note:       &m.questFormData.Note,
-			Difficulty: &m.questFormData.Difficulty,
-		})
-
-		if err != nil {
-			message = fmt.Sprintf("Failed to update quest: %v", err)
-			m.mode = QuestListView
-			m.message = message
-			m.editingQuest = nil
+		if m, busy := m.busy("quest", base.ID); busy {
 			return m, nil
 		}
 
-		message = fmt.Sprintf("✓ Quest updated: %s", quest.Title)
-		m.editingQuest = nil
-
-		if m.selectedJourney != nil {
-			returnMode = JourneyDetailView
-		}
+		form := *m.questFormData
+		restore := keepQuest(m.data, base.ID)
+		edited := *base
+		edited.Title, edited.Note, edited.Difficulty = form.Title, form.Note, form.Difficulty
+		putQuest(m.data, edited)
+		m.message = fmt.Sprintf("✓ Quest updated: %s", form.Title)
+		clearCmd := clearMessageAfter(m.message, 1*time.Second)
+
+		m, cmd := m.mutate(pendingKey{"quest", base.ID}, func() func(Model) (Model, tea.Cmd) {
+			quest, err := s.UpdateQuestIfUnchanged(*base, api.UpdateQuestRequest{
+				Title:      &form.Title,
+				Note:       &form.Note,
+				Difficulty: &form.Difficulty,
+			})
+			return func(m Model) (Model, tea.Cmd) {
+				var conflictErr *api.QuestConflictError
+				if errors.As(err, &conflictErr) {
+					restore(m.data)
+					return m.openConflict(conflictErr, form), nil
+				}
+				if err != nil {
+					return m.rollBack(restore, fmt.Sprintf("Failed to update quest: %v", err))
+				}
+				putQuest(m.data, *quest)
+				m.undo.record(change{
+					desc: fmt.Sprintf("edited quest %q", quest.Title),
+					undo: questFieldsStep(base.ID, *base),
+					redo: questFieldsStep(base.ID, edited),
+				})
+				return m.syncAfterSave()
+			}
+		})
+		return m, tea.Batch(cmd, clearCmd)
 
 	case HabitEditFormView:
-		if m.editingHabit == nil {
-			message = "No habit being edited"
-			m.mode = QuestListView
-			m.message = message
+		base := m.editingHabit
+		m.editingHabit = nil
+		m.mode = QuestListView
+		if base == nil {
+			m.message = "No habit being edited"
 			return m, nil
 		}
-
 		if m.habitFormData.Name == "" {
-			message = "Habit name cannot be empty"
-			m.mode = QuestListView
-			m.message = message
+			m.message = "Habit name cannot be empty"
 			return m, nil
 		}
-
-		habit, err := m.storage.GetAPIClient().UpdateHabit(m.editingHabit.ID, api.UpdateHabitRequest{
-			Name:        &m.habitFormData.Name,
-			CycleType:   &m.habitFormData.CycleType,
-			CycleConfig: m.habitFormData.CycleConfig,
-		})
-
-		if err != nil {
-			message = fmt.Sprintf("Failed to update habit: %v", err)
-			m.mode = QuestListView
-			m.message = message
-			m.editingHabit = nil
+		if m, busy := m.busy("habit", base.ID); busy {
 			return m, nil
 		}
 
-		message = fmt.Sprintf("✓ Habit updated: %s", habit.Name)
-		m.editingHabit = nil
+		form := *m.habitFormData
+		restore := keepHabit(m.data, base.ID)
+		edited := *base
+		edited.Name, edited.CycleType, edited.CycleConfig = form.Name, form.CycleType, form.CycleConfig
+		putHabit(m.data, edited)
+		m.message = fmt.Sprintf("✓ Habit updated: %s", form.Name)
+		clearCmd := clearMessageAfter(m.message, 1*time.Second)
+
+		m, cmd := m.mutate(pendingKey{"habit", base.ID}, func() func(Model) (Model, tea.Cmd) {
+			habit, err := s.UpdateHabit(base.ID, api.UpdateHabitRequest{
+				Name:        &form.Name,
+				CycleType:   &form.CycleType,
+				CycleConfig: form.CycleConfig,
+			})
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					return m.rollBack(restore, fmt.Sprintf("Failed to update habit: %v", err))
+				}
+				putHabit(m.data, *habit)
+				m.undo.record(change{
+					desc: fmt.Sprintf("edited habit %q", habit.Name),
+					undo: habitFieldsStep(base.ID, *base),
+					redo: habitFieldsStep(base.ID, edited),
+				})
+				return m.syncAfterSave()
+			}
+		})
+		return m, tea.Batch(cmd, clearCmd)
 
 	case JourneyEditFormView:
-		if m.editingJourney == nil {
-			message = "No journey being edited"
-			m.mode = QuestListView
-			m.message = message
+		base := m.editingJourney
+		m.editingJourney = nil
+		m.mode = QuestListView
+		if base == nil {
+			m.message = "No journey being edited"
 			return m, nil
 		}
-
 		if m.journeyFormData.Name == "" {
-			message = "Journey name cannot be empty"
-			m.mode = QuestListView
-			m.message = message
+			m.message = "Journey name cannot be empty"
 			return m, nil
 		}
-
-		journey, err := m.storage.GetAPIClient().UpdateJourney(m.editingJourney.ID, api.UpdateJourneyRequest{
-			Name: &m.journeyFormData.Name,
-		})
-
-		if err != nil {
-			message = fmt.Sprintf("Failed to update journey: %v", err)
-			m.mode = QuestListView
-			m.message = message
-			m.editingJourney = nil
+		if m, busy := m.busy("journey", base.ID); busy {
 			return m, nil
 		}
 
-		message = fmt.Sprintf("✓ Journey updated: %s", journey.Name)
+		name := m.journeyFormData.Name
 		m.currentSection = "journeys"
-		m.editingJourney = nil
+		restore := keepJourney(m.data, base.ID)
+		edited := *base
+		edited.Name = name
+		putJourney(m.data, edited)
+		m.message = fmt.Sprintf("✓ Journey updated: %s", name)
+		clearCmd := clearMessageAfter(m.message, 1*time.Second)
+
+		m, cmd := m.mutate(pendingKey{"journey", base.ID}, func() func(Model) (Model, tea.Cmd) {
+			journey, err := s.UpdateJourney(base.ID, api.UpdateJourneyRequest{Name: &name})
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					return m.rollBack(restore, fmt.Sprintf("Failed to update journey: %v", err))
+				}
+				putJourney(m.data, *journey)
+				m.undo.record(change{
+					desc: fmt.Sprintf("renamed journey %q", journey.Name),
+					undo: journeyNameStep(base.ID, base.Name),
+					redo: journeyNameStep(base.ID, name),
+				})
+				return m.syncAfterSave()
+			}
+		})
+		return m, tea.Batch(cmd, clearCmd)
 
 	case EventEditFormView:
-		if m.editingEvent == nil {
-			message = "No event being edited"
-			m.mode = QuestListView
-			m.currentSection = "calendar"
-			m.message = message
+		base := m.editingEvent
+		m.editingEvent = nil
+		m.mode = QuestListView
+		m.currentSection = "calendar"
+		if base == nil {
+			m.message = "No event being edited"
 			return m, nil
 		}
-
 		if m.eventFormData.Title == "" {
-			message = "Event title cannot be empty"
-			m.mode = QuestListView
-			m.currentSection = "calendar"
-			m.message = message
+			m.message = "Event title cannot be empty"
 			return m, nil
 		}
-
-		var timePtr, endTimePtr, locationPtr, descriptionPtr *string
-		if m.eventFormData.Time != "" {
-			timePtr = &m.eventFormData.Time
-		}
-		if m.eventFormData.EndTime != "" {
-			endTimePtr = &m.eventFormData.EndTime
-		}
-		if m.eventFormData.Location != "" {
-			locationPtr = &m.eventFormData.Location
-		}
-		if m.eventFormData.Description != "" {
-			descriptionPtr = &m.eventFormData.Description
+		if m, busy := m.busy("event", base.ID); busy {
+			return m, nil
 		}
 
-		event, err := m.storage.GetAPIClient().UpdateEvent(m.editingEvent.ID, api.UpdateEventRequest{
-			Title:       &m.eventFormData.Title,
-			Date:        &m.eventFormData.Date,
-			Time:        timePtr,
-			EndTime:     endTimePtr,
-			Location:    locationPtr,
-			Description: descriptionPtr,
+		form := *m.eventFormData
+		timePtr, endTimePtr, locationPtr, descriptionPtr := form.optionalFields()
+		restore := keepEvent(m.data, base.ID)
+		edited := *base
+		edited.Title, edited.Time, edited.EndTime, edited.Location, edited.Description = form.Title, timePtr, endTimePtr, locationPtr, descriptionPtr
+		if date, err := time.ParseInLocation("2006-01-02", form.Date, time.Local); err == nil {
+			edited.Date = date
+		}
+		putEvent(m.data, edited)
+		m.message = fmt.Sprintf("✓ Event updated: %s", form.Title)
+		clearCmd := clearMessageAfter(m.message, 1*time.Second)
+
+		m, cmd := m.mutate(pendingKey{"event", base.ID}, func() func(Model) (Model, tea.Cmd) {
+			event, err := s.UpdateEvent(base.ID, api.UpdateEventRequest{
+				Title:       &form.Title,
+				Date:        &form.Date,
+				Time:        timePtr,
+				EndTime:     endTimePtr,
+				Location:    locationPtr,
+				Description: descriptionPtr,
+			})
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					return m.rollBack(restore, fmt.Sprintf("Failed to update event: %v", err))
+				}
+				putEvent(m.data, *event)
+				m.undo.record(change{
+					desc: fmt.Sprintf("edited event %q", event.Title),
+					undo: eventFieldsStep(base.ID, *base),
+					redo: eventFieldsStep(base.ID, edited),
+				})
+				return m.syncAfterSave()
+			}
 		})
+		return m, tea.Batch(cmd, clearCmd)
 
-		if err != nil {
-			message = fmt.Sprintf("Failed to update event: %v", err)
-			m.mode = QuestListView
-			m.currentSection = "calendar"
-			m.message = message
-			m.editingEvent = nil
-			return m, nil
-		}
+	case BulkEditFormView:
+		return m.applyBulkForm()
+	}
 
-		message = fmt.Sprintf("✓ Event updated: %s", event.Title)
-		m.editingEvent = nil
-		m.currentSection = "calendar"
-		returnMode = QuestListView
+	m.mode = QuestListView
+	return m, nil
+}
+
+func createdMessage(kind, name string, id int) string {
+	message := fmt.Sprintf("✓ %s created: %s", kind, name)
+	if storage.IsTempID(id) {
+		message += " (offline, will sync later)"
 	}
+	return message
+}
+
+// saved reports a finished create or update and syncs in the background.
+func (m Model) saved(message string) (Model, tea.Cmd) {
+	m.message = message
+	m, cmd := m.syncAfterSave()
+	return m, tea.Batch(cmd, clearMessageAfter(m.message, 1*time.Second))
+}
 
-	m = m.refreshData()
+// openConflict shows the fields of a quest that changed on the server while
+// it was being edited. The save finished in the background, so the user may
+// be in another form or dialog by now; that is not taken over.
+func (m Model) openConflict(err *api.QuestConflictError, mine QuestForm) Model {
+	if m.mode != QuestListView && m.mode != JourneyDetailView {
+		m.message = fmt.Sprintf("Failed to update quest: %q changed on the server, edit it again", mine.Title)
+		return m
+	}
+	m.conflict = newQuestConflict(err, mine, m.mode)
+	m.mode = ConflictView
+	return m
+}
 
-	if m.mode == ErrorView {
+func (m Model) resolveConflict() (Model, tea.Cmd) {
+	if m.conflict == nil {
+		m.mode = QuestListView
 		return m, nil
 	}
 
-	if m.selectedJourney != nil && returnMode == JourneyDetailView {
-		for _, j := range m.data.Journeys {
-			if j.ID == m.selectedJourney.ID {
-				m.selectedJourney = &j
-				m.journeyQuestList = newJourneyQuestList(&j, m.width-4, m.height-10)
-				break
-			}
-		}
+	c := m.conflict
+	m.conflict = nil
+	m.mode = c.returnTo
+
+	if c.keepsRemote() {
+		putQuest(m.data, c.remote)
+		m = m.rebuildLists()
+		return m.saved("Kept remote version")
+	}
+	if m, busy := m.busy("quest", c.remote.ID); busy {
+		return m, nil
 	}
 
-	m.mode = returnMode
-	m.message = message
-	m.needsRedraw = true
+	s := m.storage
+	merged := c.mergedRequest()
+	restore := keepQuest(m.data, c.remote.ID)
+	edited := c.remote
+	edited.Title, edited.Note, edited.Difficulty = *merged.Title, *merged.Note, *merged.Difficulty
+	putQuest(m.data, edited)
+	m.message = fmt.Sprintf("✓ Quest updated: %s", edited.Title)
+	clearCmd := clearMessageAfter(m.message, 1*time.Second)
+
+	m, cmd := m.mutate(pendingKey{"quest", c.remote.ID}, func() func(Model) (Model, tea.Cmd) {
+		quest, err := s.UpdateQuestIfUnchanged(c.remote, merged)
+		return func(m Model) (Model, tea.Cmd) {
+			var conflictErr *api.QuestConflictError
+			if errors.As(err, &conflictErr) {
+				restore(m.data)
+				m = m.openConflict(conflictErr, QuestForm{
+					Title:      *merged.Title,
+					Note:       *merged.Note,
+					Difficulty: *merged.Difficulty,
+				})
+				if m.mode == ConflictView {
+					m.message = "Quest changed again while resolving"
+				}
+				return m, nil
+			}
+			if err != nil {
+				return m.rollBack(restore, fmt.Sprintf("Failed to update quest: %v", err))
+			}
+			putQuest(m.data, *quest)
+			m.undo.record(change{
+				desc: fmt.Sprintf("edited quest %q", quest.Title),
+				undo: questFieldsStep(c.remote.ID, c.remote),
+				redo: questFieldsStep(c.remote.ID, edited),
+			})
+			return m.syncAfterSave()
+		}
+	})
+	return m, tea.Batch(cmd, clearCmd)
+}
 
-	return m, clearMessageAfter(1 * time.Second)
+func (m Model) cancelConflict() Model {
+	if m.conflict != nil {
+		m.mode = m.conflict.returnTo
+	} else {
+		m.mode = QuestListView
+	}
+	m.conflict = nil
+	m.message = "Edit discarded"
+	return m
 }
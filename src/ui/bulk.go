@@ -0,0 +1,349 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"marcel-cli/models"
+	"marcel-cli/ui/colors"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// marks holds the items marked for a bulk action. Only one list has marks
+// at a time: "quests", "habits" or "journey" for the open journey's quests.
+// Marking in another list starts over.
+type marks struct {
+	list string
+	ids  map[int]bool
+}
+
+func (s *marks) has(list string, id int) bool {
+	return s.list == list && s.ids[id]
+}
+
+func (s *marks) any(list string) bool {
+	return s.list == list && len(s.ids) > 0
+}
+
+func (s *marks) set(list string, id int, marked bool) {
+	if s.list != list || s.ids == nil {
+		s.list = list
+		s.ids = map[int]bool{}
+	}
+	if marked {
+		s.ids[id] = true
+	} else {
+		delete(s.ids, id)
+	}
+}
+
+func (s *marks) clear() {
+	s.list = ""
+	s.ids = nil
+}
+
+// prefix starts a row of a list with marks, so marked rows stand out and
+// the others stay aligned with them.
+func (s *marks) prefix(list string, id int) string {
+	switch {
+	case s.has(list, id):
+		return lipgloss.NewStyle().Foreground(colors.Accent).Bold(true).Render("● ")
+	case s.any(list):
+		return "  "
+	}
+	return ""
+}
+
+// markItems handles the mark keys in l. Marking upwards or downwards marks
+// the item under the cursor and the one it moves to, so holding shift marks
+// a range.
+func (m Model) markItems(l *list.Model, name string, msg tea.KeyMsg) {
+	mark := func(marked bool) {
+		if id, ok := itemID(l.SelectedItem()); ok {
+			m.marks.set(name, id, marked)
+		}
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Mark):
+		id, ok := itemID(l.SelectedItem())
+		mark(ok && !m.marks.has(name, id))
+	case key.Matches(msg, m.keys.MarkUp):
+		mark(true)
+		l.CursorUp()
+		skipHeaders(l, -1)
+		mark(true)
+	case key.Matches(msg, m.keys.MarkDown):
+		mark(true)
+		l.CursorDown()
+		skipHeaders(l, 1)
+		mark(true)
+	}
+}
+
+// selectionLabel is added to the header while items in l are marked.
+func (m Model) selectionLabel(l list.Model, name string) string {
+	count := 0
+	for _, item := range l.Items() {
+		if id, ok := itemID(item); ok && m.marks.has(name, id) {
+			count++
+		}
+	}
+	if count == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" · %d selected", count)
+}
+
+func markedQuests(l list.Model, marks *marks, name string) []models.Quest {
+	var quests []models.Quest
+	for _, item := range l.Items() {
+		if i, ok := item.(questItem); ok && marks.has(name, i.quest.ID) {
+			quests = append(quests, i.quest)
+		}
+	}
+	return quests
+}
+
+// questTargets is what a bulk action applies to: the marked quests, or the
+// one under the cursor when none are marked.
+func questTargets(l list.Model, marks *marks, name string) []models.Quest {
+	if quests := markedQuests(l, marks, name); len(quests) > 0 {
+		return quests
+	}
+	if i, ok := l.SelectedItem().(questItem); ok {
+		return []models.Quest{i.quest}
+	}
+	return nil
+}
+
+func markedHabits(l list.Model, marks *marks) []models.Habit {
+	var habits []models.Habit
+	for _, item := range l.Items() {
+		if i, ok := item.(habitItem); ok && marks.has("habits", i.habit.ID) {
+			habits = append(habits, i.habit)
+		}
+	}
+	return habits
+}
+
+func countNoun(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// bulkStep is one item's part in a bulk action: the step that makes the
+// change and the one that takes it back, nil if there is none.
+type bulkStep struct {
+	key  pendingKey
+	do   undoStep
+	undo undoStep
+}
+
+// runBulk makes one change to several items. Each item gets its own
+// request, so items the server refuses are rolled back on their own; the
+// ones that went through become a single entry on the undo stack.
+func (m Model) runBulk(desc, noun string, steps []bulkStep) (Model, tea.Cmd) {
+	for _, s := range steps {
+		if m, busy := m.busy(s.key.kind, s.key.id); busy {
+			return m, nil
+		}
+	}
+	m.marks.clear()
+	if len(steps) == 0 {
+		m.message = "Nothing to change"
+		return m, clearMessageAfter(m.message, 2*time.Second)
+	}
+
+	m.message = "✓ " + capitalize(desc)
+	clearCmd := clearMessageAfter(m.message, 1*time.Second)
+
+	do := make([]undoStep, len(steps))
+	for i, s := range steps {
+		do[i] = s.do
+	}
+	m, cmd := m.runAll(do, func(m Model, errs []error) (Model, tea.Cmd) {
+		var undo, redo []undoStep
+		var first error
+		failed := 0
+		for i, err := range errs {
+			if err != nil {
+				failed++
+				if first == nil {
+					first = err
+				}
+				continue
+			}
+			if steps[i].undo == nil {
+				continue
+			}
+			undo = append(undo, steps[i].undo)
+			redo = append(redo, steps[i].do)
+		}
+		if len(undo) > 0 {
+			m.undo.record(change{desc: desc, undo: allSteps(undo), redo: allSteps(redo)})
+		}
+		if first == nil {
+			return m, nil
+		}
+		m.message = fmt.Sprintf("Failed to save %d of %s: %v (those changes were undone)", failed, countNoun(len(steps), noun), first)
+		return m, clearMessageAfter(m.message, 10*time.Second)
+	})
+	return m, tea.Batch(cmd, clearCmd)
+}
+
+// toggleQuests completes the quests, or reopens them when all of them are
+// done already.
+func (m Model) toggleQuests(quests []models.Quest) (Model, tea.Cmd) {
+	done := slices.ContainsFunc(quests, func(q models.Quest) bool { return !q.Done })
+
+	var steps []bulkStep
+	for _, q := range quests {
+		if q.Done != done {
+			steps = append(steps, bulkStep{pendingKey{"quest", q.ID}, questDoneStep(q.ID, done), questDoneStep(q.ID, !done)})
+		}
+	}
+	return m.runBulk(fmt.Sprintf("%s %s", doneVerb(done, "completed", "reopened"), countNoun(len(steps), "quest")), "quest", steps)
+}
+
+// toggleHabits checks the habits off for today, or unchecks them when all
+// of them are checked off already.
+func (m Model) toggleHabits(habits []models.Habit) (Model, tea.Cmd) {
+	done := slices.ContainsFunc(habits, func(h models.Habit) bool { return !completedToday(h) })
+
+	var steps []bulkStep
+	for _, h := range habits {
+		if completedToday(h) != done {
+			steps = append(steps, bulkStep{pendingKey{"habit", h.ID}, habitDoneStep(h.ID, done), habitDoneStep(h.ID, !done)})
+		}
+	}
+	return m.runBulk(fmt.Sprintf("%s %s", doneVerb(done, "checked off", "unchecked"), countNoun(len(steps), "habit")), "habit", steps)
+}
+
+func (m Model) showDeleteConfirmQuests(quests []models.Quest) Model {
+	m.mode = ConfirmDeleteView
+	m.confirmQuests = quests
+	m.confirmSelected = false
+	return m
+}
+
+func (m Model) showDeleteConfirmHabits(habits []models.Habit) Model {
+	m.mode = ConfirmDeleteView
+	m.confirmHabits = habits
+	m.confirmSelected = false
+	return m
+}
+
+func (m Model) confirmDeleteQuests() (Model, tea.Cmd) {
+	quests := m.confirmQuests
+	m.confirmQuests = nil
+	m = m.backToList()
+
+	var steps []bulkStep
+	for _, q := range quests {
+		steps = append(steps, bulkStep{pendingKey{"quest", q.ID}, deleteStep("quest", q.ID), createQuestStep(q)})
+	}
+	return m.runBulk("deleted "+countNoun(len(steps), "quest"), "quest", steps)
+}
+
+func (m Model) confirmDeleteHabits() (Model, tea.Cmd) {
+	habits := m.confirmHabits
+	m.confirmHabits = nil
+	m = m.backToList()
+
+	var steps []bulkStep
+	for _, h := range habits {
+		steps = append(steps, bulkStep{pendingKey{"habit", h.ID}, deleteStep("habit", h.ID), createHabitStep(h)})
+	}
+	return m.runBulk("deleted "+countNoun(len(steps), "habit"), "habit", steps)
+}
+
+// confirmNames lists the items a bulk delete is about, up to a handful.
+func confirmNames(names []string) string {
+	const shown = 5
+	if len(names) <= shown {
+		return strings.Join(names, "\n")
+	}
+	return strings.Join(names[:shown], "\n") + fmt.Sprintf("\n…and %d more", len(names)-shown)
+}
+
+func (m Model) pickDifficulty(quests []models.Quest) (Model, tea.Cmd) {
+	if len(quests) == 0 {
+		return m, nil
+	}
+	m.bulkQuests = quests
+	m.bulkFormData = &BulkForm{Field: "difficulty", Difficulty: quests[0].Difficulty}
+	m.bulkForm = BuildDifficultyForm(m.bulkFormData, len(quests))
+	m.mode = BulkEditFormView
+	return m, m.bulkForm.Init()
+}
+
+func (m Model) pickJourney(quests []models.Quest) (Model, tea.Cmd) {
+	if len(quests) == 0 {
+		return m, nil
+	}
+	// Quests can only move into a journey, not back to My Quests.
+	target := questJourneyID(quests[0])
+	if target == 0 {
+		index := slices.IndexFunc(m.data.Journeys, func(j models.Journey) bool { return j.ID != 0 })
+		if index < 0 {
+			m.message = "There is no journey to move quests to"
+			return m, clearMessageAfter(m.message, 2*time.Second)
+		}
+		target = m.data.Journeys[index].ID
+	}
+	m.bulkQuests = quests
+	m.bulkFormData = &BulkForm{Field: "journey", JourneyID: target}
+	m.bulkForm = BuildMoveForm(m.bulkFormData, m.data.Journeys, len(quests))
+	m.mode = BulkEditFormView
+	return m, m.bulkForm.Init()
+}
+
+// applyBulkForm changes the difficulty or journey picked in the bulk form
+// for every quest it was opened for that still exists.
+func (m Model) applyBulkForm() (Model, tea.Cmd) {
+	form, quests := m.bulkFormData, m.bulkQuests
+	m.bulkForm, m.bulkFormData, m.bulkQuests = nil, nil, nil
+	m = m.backToList()
+
+	var steps []bulkStep
+	var desc string
+	switch form.Field {
+	case "difficulty":
+		for _, q := range quests {
+			current, ok := findQuest(m.data, q.ID)
+			if !ok || current.Difficulty == form.Difficulty {
+				continue
+			}
+			changed := current
+			changed.Difficulty = form.Difficulty
+			steps = append(steps, bulkStep{pendingKey{"quest", q.ID}, questFieldsStep(q.ID, changed), questFieldsStep(q.ID, current)})
+		}
+		desc = fmt.Sprintf("made %s %s", countNoun(len(steps), "quest"), form.Difficulty)
+
+	case "journey":
+		for _, q := range quests {
+			current, ok := findQuest(m.data, q.ID)
+			if !ok || questJourneyID(current) == form.JourneyID {
+				continue
+			}
+			// A quest moved out of My Quests cannot go back there.
+			var undo undoStep
+			if from := questJourneyID(current); from != 0 {
+				undo = questJourneyStep(q.ID, from)
+			}
+			steps = append(steps, bulkStep{pendingKey{"quest", q.ID}, questJourneyStep(q.ID, form.JourneyID), undo})
+		}
+		journey, _ := findJourney(m.data, form.JourneyID)
+		desc = fmt.Sprintf("moved %s to %q", countNoun(len(steps), "quest"), journey.Name)
+	}
+	return m.runBulk(desc, "quest", steps)
+}
@@ -1,51 +1,183 @@
 package colors
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/muesli/termenv"
 )
 
+// The colours in use. They start out as the default theme's dark palette
+// and are replaced by Apply.
 var (
-	isDark = detectDarkBackground()
-
-	BrandOrange         = chooseColor("#E85D00", "#FF9600")
-	PrimaryText         = chooseColor("#1a1a1a", "#FFFFFF")
-	SecondaryText       = chooseColor("#4a4a4a", "#888888")
-	MutedText           = chooseColor("#666666", "#aaaaaa")
-	BorderColor         = chooseColor("#cccccc", "#333333")
-	BackgroundPrimary   = chooseColor("#ffffff", "#1a1a1a")
-	BackgroundSecondary = chooseColor("#f5f5f5", "#2a2a2a")
-	Green               = chooseColor("#2d9f5d", "#34C759")
-	Red                 = chooseColor("#d63030", "#FF3B30")
-	AccentPeach         = chooseColor("#e67e22", "#fab387")
-	AccentBlue          = chooseColor("#2563eb", "#89b4fa")
-	DifficultyEasy      = chooseColor("#0d9668", "#10b981")
-	DifficultyMedium    = chooseColor("#2563eb", "#3b82f6")
-	DifficultyHard      = chooseColor("#7c3aed", "#a855f7")
-	DifficultyEpic      = chooseColor("#dc2626", "#ef4444")
-	DifficultyLegendary = chooseColor("#d97706", "#f59e0b")
+	Brand               lipgloss.TerminalColor
+	PrimaryText         lipgloss.TerminalColor
+	SecondaryText       lipgloss.TerminalColor
+	MutedText           lipgloss.TerminalColor
+	BorderColor         lipgloss.TerminalColor
+	BackgroundPrimary   lipgloss.TerminalColor
+	BackgroundSecondary lipgloss.TerminalColor
+	Green               lipgloss.TerminalColor
+	Red                 lipgloss.TerminalColor
+	Accent              lipgloss.TerminalColor
+	AccentAlt           lipgloss.TerminalColor
+	DifficultyEasy      lipgloss.TerminalColor
+	DifficultyMedium    lipgloss.TerminalColor
+	DifficultyHard      lipgloss.TerminalColor
+	DifficultyEpic      lipgloss.TerminalColor
+	DifficultyLegendary lipgloss.TerminalColor
+
+	// NoColor is set when the NO_COLOR environment variable asks for output
+	// without colour. Bold, strikethrough and reverse video still apply, and
+	// highlights use reverse video instead of a background.
+	NoColor = os.Getenv("NO_COLOR") != ""
 )
 
-func detectDarkBackground() bool {
-	if colorMode := os.Getenv("MARCEL_COLOR_MODE"); colorMode != "" {
-		return strings.ToLower(colorMode) == "dark"
+func init() {
+	if NoColor {
+		// lipgloss drops every attribute under NO_COLOR, not just colours.
+		lipgloss.SetColorProfile(termenv.NewOutput(os.Stdout).ColorProfile())
 	}
+	use(Themes["default"].Dark)
+}
 
-	defer func() {
-		if r := recover(); r != nil {
-			return
+// ThemeNames lists the built-in themes.
+func ThemeNames() []string {
+	names := make([]string, 0, len(Themes))
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ColorNames lists the colours a theme can override.
+func ColorNames() []string {
+	var p Palette
+	var names []string
+	for _, c := range p.colors() {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// Apply switches to a theme, in its light or dark variant, and applies
+// per-colour overrides on top. mode is light, dark or auto, which asks the
+// terminal for its background.
+func Apply(theme, mode string, overrides map[string]string) error {
+	t, ok := Themes[theme]
+	if !ok {
+		return fmt.Errorf("unknown theme %q (expected one of %s)", theme, strings.Join(ThemeNames(), ", "))
+	}
+
+	palette := t.Dark
+	if mode == "light" || (mode != "dark" && !hasDarkBackground()) {
+		palette = t.Light
+	}
+	if err := CheckOverrides(overrides); err != nil {
+		return err
+	}
+	for _, c := range palette.colors() {
+		if value := overrides[c.name]; value != "" {
+			*c.value = value
 		}
-	}()
+	}
 
-	return termenv.HasDarkBackground()
+	use(palette)
+	return nil
+}
+
+// CheckOverrides reports colour overrides with an unknown name or a value
+// that is not a colour. Empty values are left to the theme.
+func CheckOverrides(overrides map[string]string) error {
+	names := ColorNames()
+	keys := make([]string, 0, len(overrides))
+	for name := range overrides {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, name := range keys {
+		if !slices.Contains(names, name) {
+			errs = append(errs, fmt.Errorf("colors.%s: unknown colour (expected one of %s)", name, strings.Join(names, ", ")))
+			continue
+		}
+		if overrides[name] == "" {
+			continue
+		}
+		if err := CheckColor(overrides[name]); err != nil {
+			errs = append(errs, fmt.Errorf("colors.%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
-func chooseColor(light, dark string) lipgloss.TerminalColor {
-	if isDark {
-		return lipgloss.Color(dark)
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// CheckColor reports whether value is a hex colour such as #ff9600 or an
+// ANSI colour number from 0 to 255.
+func CheckColor(value string) error {
+	if hexColor.MatchString(value) {
+		return nil
+	}
+	if n, err := strconv.Atoi(value); err == nil && n >= 0 && n <= 255 {
+		return nil
 	}
-	return lipgloss.Color(light)
+	return fmt.Errorf("invalid colour %q (use a hex colour such as #ff9600 or an ANSI number from 0 to 255)", value)
 }
+
+// Highlight gives style a coloured background for selections, or reverse
+// video when colours are off.
+func Highlight(style lipgloss.Style, background lipgloss.TerminalColor) lipgloss.Style {
+	if NoColor {
+		return style.Reverse(true)
+	}
+	return style.Background(background).Foreground(BackgroundPrimary)
+}
+
+func use(p Palette) {
+	color := func(value string) lipgloss.TerminalColor {
+		if NoColor {
+			return lipgloss.NoColor{}
+		}
+		return lipgloss.Color(value)
+	}
+
+	Brand = color(p.Brand)
+	PrimaryText = color(p.Text)
+	SecondaryText = color(p.TextSecondary)
+	MutedText = color(p.TextMuted)
+	BorderColor = color(p.Border)
+	BackgroundPrimary = color(p.Background)
+	BackgroundSecondary = color(p.BackgroundSecondary)
+	Green = color(p.Green)
+	Red = color(p.Red)
+	Accent = color(p.Accent)
+	AccentAlt = color(p.AccentAlt)
+	DifficultyEasy = color(p.DifficultyEasy)
+	DifficultyMedium = color(p.DifficultyMedium)
+	DifficultyHard = color(p.DifficultyHard)
+	DifficultyEpic = color(p.DifficultyEpic)
+	DifficultyLegendary = color(p.DifficultyLegendary)
+}
+
+// hasDarkBackground asks the terminal once; asking again while Bubble Tea
+// reads the input would race it for the reply.
+var hasDarkBackground = sync.OnceValue(func() (dark bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			dark = true
+		}
+	}()
+
+	return termenv.HasDarkBackground()
+})
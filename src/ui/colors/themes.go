@@ -0,0 +1,155 @@
+package colors
+
+// Palette is every colour the TUI draws with, as hex codes or ANSI numbers.
+type Palette struct {
+	Brand               string
+	Text                string
+	TextSecondary       string
+	TextMuted           string
+	Border              string
+	Background          string
+	BackgroundSecondary string
+	Green               string
+	Red                 string
+	Accent              string
+	AccentAlt           string
+	DifficultyEasy      string
+	DifficultyMedium    string
+	DifficultyHard      string
+	DifficultyEpic      string
+	DifficultyLegendary string
+}
+
+type paletteColor struct {
+	name  string
+	value *string
+}
+
+func (p *Palette) colors() []paletteColor {
+	return []paletteColor{
+		{"brand", &p.Brand},
+		{"text", &p.Text},
+		{"text_secondary", &p.TextSecondary},
+		{"text_muted", &p.TextMuted},
+		{"border", &p.Border},
+		{"background", &p.Background},
+		{"background_secondary", &p.BackgroundSecondary},
+		{"green", &p.Green},
+		{"red", &p.Red},
+		{"accent", &p.Accent},
+		{"accent_alt", &p.AccentAlt},
+		{"difficulty_easy", &p.DifficultyEasy},
+		{"difficulty_medium", &p.DifficultyMedium},
+		{"difficulty_hard", &p.DifficultyHard},
+		{"difficulty_epic", &p.DifficultyEpic},
+		{"difficulty_legendary", &p.DifficultyLegendary},
+	}
+}
+
+// Theme pairs a palette for light terminals with one for dark terminals.
+type Theme struct {
+	Light Palette
+	Dark  Palette
+}
+
+var Themes = map[string]Theme{
+	"default": {
+		Light: Palette{
+			Brand: "#E85D00", Text: "#1a1a1a", TextSecondary: "#4a4a4a", TextMuted: "#666666",
+			Border: "#cccccc", Background: "#ffffff", BackgroundSecondary: "#f5f5f5",
+			Green: "#2d9f5d", Red: "#d63030", Accent: "#e67e22", AccentAlt: "#2563eb",
+			DifficultyEasy: "#0d9668", DifficultyMedium: "#2563eb", DifficultyHard: "#7c3aed",
+			DifficultyEpic: "#dc2626", DifficultyLegendary: "#d97706",
+		},
+		Dark: Palette{
+			Brand: "#FF9600", Text: "#FFFFFF", TextSecondary: "#888888", TextMuted: "#aaaaaa",
+			Border: "#333333", Background: "#1a1a1a", BackgroundSecondary: "#2a2a2a",
+			Green: "#34C759", Red: "#FF3B30", Accent: "#fab387", AccentAlt: "#89b4fa",
+			DifficultyEasy: "#10b981", DifficultyMedium: "#3b82f6", DifficultyHard: "#a855f7",
+			DifficultyEpic: "#ef4444", DifficultyLegendary: "#f59e0b",
+		},
+	},
+	// Latte and Mocha.
+	"catppuccin": {
+		Light: Palette{
+			Brand: "#fe640b", Text: "#4c4f69", TextSecondary: "#5c5f77", TextMuted: "#8c8fa1",
+			Border: "#ccd0da", Background: "#eff1f5", BackgroundSecondary: "#e6e9ef",
+			Green: "#40a02b", Red: "#d20f39", Accent: "#fe640b", AccentAlt: "#1e66f5",
+			DifficultyEasy: "#40a02b", DifficultyMedium: "#1e66f5", DifficultyHard: "#8839ef",
+			DifficultyEpic: "#d20f39", DifficultyLegendary: "#df8e1d",
+		},
+		Dark: Palette{
+			Brand: "#fab387", Text: "#cdd6f4", TextSecondary: "#a6adc8", TextMuted: "#7f849c",
+			Border: "#313244", Background: "#1e1e2e", BackgroundSecondary: "#181825",
+			Green: "#a6e3a1", Red: "#f38ba8", Accent: "#fab387", AccentAlt: "#89b4fa",
+			DifficultyEasy: "#a6e3a1", DifficultyMedium: "#89b4fa", DifficultyHard: "#cba6f7",
+			DifficultyEpic: "#f38ba8", DifficultyLegendary: "#f9e2af",
+		},
+	},
+	"gruvbox": {
+		Light: Palette{
+			Brand: "#af3a03", Text: "#3c3836", TextSecondary: "#665c54", TextMuted: "#7c6f64",
+			Border: "#d5c4a1", Background: "#fbf1c7", BackgroundSecondary: "#ebdbb2",
+			Green: "#79740e", Red: "#9d0006", Accent: "#b57614", AccentAlt: "#076678",
+			DifficultyEasy: "#79740e", DifficultyMedium: "#076678", DifficultyHard: "#8f3f71",
+			DifficultyEpic: "#9d0006", DifficultyLegendary: "#b57614",
+		},
+		Dark: Palette{
+			Brand: "#fe8019", Text: "#ebdbb2", TextSecondary: "#bdae93", TextMuted: "#928374",
+			Border: "#504945", Background: "#282828", BackgroundSecondary: "#3c3836",
+			Green: "#b8bb26", Red: "#fb4934", Accent: "#fabd2f", AccentAlt: "#83a598",
+			DifficultyEasy: "#b8bb26", DifficultyMedium: "#83a598", DifficultyHard: "#d3869b",
+			DifficultyEpic: "#fb4934", DifficultyLegendary: "#fabd2f",
+		},
+	},
+	"solarized": {
+		Light: Palette{
+			Brand: "#cb4b16", Text: "#586e75", TextSecondary: "#657b83", TextMuted: "#93a1a1",
+			Border: "#eee8d5", Background: "#fdf6e3", BackgroundSecondary: "#eee8d5",
+			Green: "#859900", Red: "#dc322f", Accent: "#b58900", AccentAlt: "#268bd2",
+			DifficultyEasy: "#859900", DifficultyMedium: "#268bd2", DifficultyHard: "#6c71c4",
+			DifficultyEpic: "#dc322f", DifficultyLegendary: "#b58900",
+		},
+		Dark: Palette{
+			Brand: "#cb4b16", Text: "#93a1a1", TextSecondary: "#839496", TextMuted: "#586e75",
+			Border: "#073642", Background: "#002b36", BackgroundSecondary: "#073642",
+			Green: "#859900", Red: "#dc322f", Accent: "#b58900", AccentAlt: "#268bd2",
+			DifficultyEasy: "#859900", DifficultyMedium: "#268bd2", DifficultyHard: "#6c71c4",
+			DifficultyEpic: "#dc322f", DifficultyLegendary: "#b58900",
+		},
+	},
+	"high-contrast": {
+		Light: Palette{
+			Brand: "#0000cc", Text: "#000000", TextSecondary: "#000000", TextMuted: "#303030",
+			Border: "#000000", Background: "#ffffff", BackgroundSecondary: "#ffffff",
+			Green: "#006400", Red: "#b00000", Accent: "#8b4500", AccentAlt: "#0000cc",
+			DifficultyEasy: "#006400", DifficultyMedium: "#0000cc", DifficultyHard: "#6a00a8",
+			DifficultyEpic: "#b00000", DifficultyLegendary: "#7a4a00",
+		},
+		Dark: Palette{
+			Brand: "#ffff00", Text: "#ffffff", TextSecondary: "#ffffff", TextMuted: "#d0d0d0",
+			Border: "#ffffff", Background: "#000000", BackgroundSecondary: "#000000",
+			Green: "#00ff00", Red: "#ff5555", Accent: "#ffff00", AccentAlt: "#00ffff",
+			DifficultyEasy: "#00ff00", DifficultyMedium: "#00ffff", DifficultyHard: "#ff80ff",
+			DifficultyEpic: "#ff5555", DifficultyLegendary: "#ffff00",
+		},
+	},
+	// The Okabe-Ito palette, which stays distinguishable with the common
+	// forms of colour blindness.
+	"colour-blind-safe": {
+		Light: Palette{
+			Brand: "#0072B2", Text: "#1a1a1a", TextSecondary: "#4a4a4a", TextMuted: "#666666",
+			Border: "#cccccc", Background: "#ffffff", BackgroundSecondary: "#f5f5f5",
+			Green: "#009E73", Red: "#D55E00", Accent: "#E69F00", AccentAlt: "#CC79A7",
+			DifficultyEasy: "#0072B2", DifficultyMedium: "#009E73", DifficultyHard: "#CC79A7",
+			DifficultyEpic: "#D55E00", DifficultyLegendary: "#9E6B00",
+		},
+		Dark: Palette{
+			Brand: "#E69F00", Text: "#FFFFFF", TextSecondary: "#888888", TextMuted: "#aaaaaa",
+			Border: "#333333", Background: "#1a1a1a", BackgroundSecondary: "#2a2a2a",
+			Green: "#009E73", Red: "#D55E00", Accent: "#F0E442", AccentAlt: "#56B4E9",
+			DifficultyEasy: "#56B4E9", DifficultyMedium: "#009E73", DifficultyHard: "#CC79A7",
+			DifficultyEpic: "#D55E00", DifficultyLegendary: "#F0E442",
+		},
+	},
+}
@@ -19,6 +19,7 @@ type Calendar struct {
 	height         int
 	weekStartDay   string
 	focusEventList bool
+	pending        func(eventID int) bool
 }
 
 func NewCalendar() *Calendar {
@@ -47,6 +48,12 @@ func (c *Calendar) SetEvents(events []models.Event) {
 	c.events = events
 }
 
+// SetPending tells the calendar which events still have a change on its way
+// to the server, so it can mark them.
+func (c *Calendar) SetPending(pending func(eventID int) bool) {
+	c.pending = pending
+}
+
 func (c *Calendar) GetSelectedDate() time.Time {
 	return c.selectedDate
 }
@@ -222,7 +229,7 @@ func (c *Calendar) renderHeader() string {
 
 	headerStyle := lipgloss.NewStyle().
 		Bold(true).
-		Foreground(colors.AccentPeach)
+		Foreground(colors.Accent)
 
 	return headerStyle.Render(title)
 }
@@ -241,9 +248,9 @@ func (c *Calendar) renderMonthCell(date time.Time) string {
 	style := lipgloss.NewStyle()
 
 	if c.isSameDate(date, c.selectedDate) {
-		style = style.Background(colors.BrandOrange).Foreground(colors.BackgroundPrimary).Bold(true)
+		style = colors.Highlight(style, colors.Brand).Bold(true)
 	} else if c.isToday(date) {
-		style = style.Background(colors.AccentBlue).Foreground(colors.BackgroundPrimary).Bold(true)
+		style = colors.Highlight(style, colors.AccentAlt).Bold(true)
 	} else if date.Month() != c.currentDate.Month() {
 		style = style.Foreground(colors.MutedText)
 	}
@@ -273,7 +280,7 @@ func (c *Calendar) renderSelectedDateEvents() string {
 			eventStyle := lipgloss.NewStyle().Padding(0, 1).Foreground(colors.PrimaryText)
 
 			if c.focusEventList && i == c.selectedEvent {
-				eventStyle = eventStyle.Background(colors.AccentPeach).Foreground(colors.BackgroundPrimary)
+				eventStyle = colors.Highlight(eventStyle, colors.Accent)
 			}
 
 			timeStr := ""
@@ -292,6 +299,9 @@ func (c *Calendar) renderSelectedDateEvents() string {
 			}
 
 			sb.WriteString(eventStyle.Render(eventText))
+			if c.pending != nil && c.pending(event.ID) {
+				sb.WriteString(lipgloss.NewStyle().Foreground(colors.MutedText).Render(" ⋯ saving"))
+			}
 			sb.WriteString("\n")
 		}
 	}
@@ -0,0 +1,108 @@
+package ui
+
+import (
+	"marcel-cli/api"
+	"marcel-cli/models"
+)
+
+type conflictSide int
+
+const (
+	keepMine conflictSide = iota
+	keepTheirs
+)
+
+type conflictField struct {
+	name   string
+	base   string
+	mine   string
+	theirs string
+	choice conflictSide
+}
+
+func (f conflictField) changedLocally() bool {
+	return f.mine != f.base
+}
+
+func (f conflictField) changedRemotely() bool {
+	return f.theirs != f.base
+}
+
+func (f conflictField) clashes() bool {
+	return f.changedLocally() && f.changedRemotely() && f.mine != f.theirs
+}
+
+func (f conflictField) resolved() string {
+	if f.choice == keepTheirs {
+		return f.theirs
+	}
+	return f.mine
+}
+
+type questConflict struct {
+	base     models.Quest
+	remote   models.Quest
+	fields   []conflictField
+	cursor   int
+	returnTo ViewMode
+}
+
+func newQuestConflict(err *api.QuestConflictError, local QuestForm, returnTo ViewMode) *questConflict {
+	base := err.Base
+	remote := err.Remote
+
+	fields := []conflictField{
+		{name: "Title", base: base.Title, mine: local.Title, theirs: remote.Title},
+		{name: "Note", base: base.Note, mine: local.Note, theirs: remote.Note},
+		{name: "Difficulty", base: base.Difficulty, mine: local.Difficulty, theirs: remote.Difficulty},
+	}
+
+	for i := range fields {
+		if fields[i].changedRemotely() && !fields[i].changedLocally() {
+			fields[i].choice = keepTheirs
+		}
+	}
+
+	return &questConflict{
+		base:     base,
+		remote:   remote,
+		fields:   fields,
+		returnTo: returnTo,
+	}
+}
+
+func (c *questConflict) chooseAll(side conflictSide) {
+	for i := range c.fields {
+		c.fields[i].choice = side
+	}
+}
+
+func (c *questConflict) toggleCurrent() {
+	f := &c.fields[c.cursor]
+	if f.choice == keepMine {
+		f.choice = keepTheirs
+	} else {
+		f.choice = keepMine
+	}
+}
+
+func (c *questConflict) mergedRequest() api.UpdateQuestRequest {
+	title := c.fields[0].resolved()
+	note := c.fields[1].resolved()
+	difficulty := c.fields[2].resolved()
+
+	return api.UpdateQuestRequest{
+		Title:      &title,
+		Note:       &note,
+		Difficulty: &difficulty,
+	}
+}
+
+func (c *questConflict) keepsRemote() bool {
+	for _, f := range c.fields {
+		if f.resolved() != f.theirs {
+			return false
+		}
+	}
+	return true
+}
@@ -19,6 +19,47 @@ func getFormKeyMap() *huh.KeyMap {
 	return keyMap
 }
 
+// formTheme is the huh theme for every form, drawn from the current
+// colours with accent for titles and the selected option.
+func formTheme(accent lipgloss.TerminalColor) *huh.Theme {
+	t := huh.ThemeBase()
+
+	t.Focused.Base = lipgloss.NewStyle().BorderForeground(accent)
+	t.Focused.Card = t.Focused.Base
+	t.Focused.Title = lipgloss.NewStyle().Foreground(accent).Bold(true)
+	t.Focused.NoteTitle = t.Focused.Title.MarginBottom(1)
+	t.Focused.Description = t.Focused.Description.Foreground(colors.SecondaryText)
+	t.Focused.ErrorIndicator = t.Focused.ErrorIndicator.Foreground(colors.Red)
+	t.Focused.ErrorMessage = t.Focused.ErrorMessage.Foreground(colors.Red)
+	t.Focused.SelectSelector = lipgloss.NewStyle().Foreground(accent).SetString(">")
+	t.Focused.NextIndicator = t.Focused.NextIndicator.Foreground(accent)
+	t.Focused.PrevIndicator = t.Focused.PrevIndicator.Foreground(accent)
+	t.Focused.Option = t.Focused.Option.Foreground(colors.PrimaryText)
+	t.Focused.MultiSelectSelector = t.Focused.MultiSelectSelector.Foreground(accent)
+	t.Focused.SelectedOption = lipgloss.NewStyle().Foreground(accent)
+	t.Focused.SelectedPrefix = lipgloss.NewStyle().Foreground(colors.Green).SetString("✓ ")
+	t.Focused.UnselectedPrefix = lipgloss.NewStyle().Foreground(colors.MutedText).SetString("• ")
+	t.Focused.UnselectedOption = t.Focused.UnselectedOption.Foreground(colors.PrimaryText)
+	t.Focused.FocusedButton = colors.Highlight(t.Focused.FocusedButton, accent)
+	t.Focused.Next = t.Focused.FocusedButton
+	t.Focused.BlurredButton = t.Focused.BlurredButton.Foreground(colors.PrimaryText).Background(colors.BackgroundSecondary)
+
+	t.Focused.TextInput.Cursor = lipgloss.NewStyle().Foreground(accent)
+	t.Focused.TextInput.Placeholder = t.Focused.TextInput.Placeholder.Foreground(colors.MutedText)
+	t.Focused.TextInput.Prompt = t.Focused.TextInput.Prompt.Foreground(accent)
+	t.Focused.TextInput.Text = t.Focused.TextInput.Text.Foreground(colors.PrimaryText)
+
+	t.Blurred = t.Focused
+	t.Blurred.Base = t.Focused.Base.BorderStyle(lipgloss.HiddenBorder())
+	t.Blurred.Card = t.Blurred.Base
+	t.Blurred.NextIndicator = lipgloss.NewStyle()
+	t.Blurred.PrevIndicator = lipgloss.NewStyle()
+
+	t.Group.Title = t.Focused.Title
+	t.Group.Description = t.Focused.Description
+	return t
+}
+
 type QuestForm struct {
 	Title      string
 	Note       string
@@ -45,12 +86,7 @@ func BuildQuestForm(formData *QuestForm, journeys []models.Journey) *huh.Form {
 		})
 	}
 
-	theme := huh.ThemeCharm()
-	theme.Focused.Base = lipgloss.NewStyle().BorderForeground(colors.BrandOrange)
-	theme.Focused.Title = lipgloss.NewStyle().Foreground(colors.BrandOrange).Bold(true)
-	theme.Focused.TextInput.Cursor = lipgloss.NewStyle().Foreground(colors.BrandOrange)
-	theme.Focused.SelectSelector = lipgloss.NewStyle().Foreground(colors.BrandOrange).SetString(">")
-	theme.Focused.SelectedOption = lipgloss.NewStyle().Foreground(colors.BrandOrange)
+	theme := formTheme(colors.Brand)
 
 	return huh.NewForm(
 		huh.NewGroup(
@@ -103,12 +139,7 @@ func NewQuestForm(journeys []models.Journey) (*QuestForm, error) {
 		})
 	}
 
-	theme := huh.ThemeCharm()
-	theme.Focused.Base = lipgloss.NewStyle().BorderForeground(colors.BrandOrange)
-	theme.Focused.Title = lipgloss.NewStyle().Foreground(colors.BrandOrange).Bold(true)
-	theme.Focused.TextInput.Cursor = lipgloss.NewStyle().Foreground(colors.BrandOrange)
-	theme.Focused.SelectSelector = lipgloss.NewStyle().Foreground(colors.BrandOrange).SetString(">")
-	theme.Focused.SelectedOption = lipgloss.NewStyle().Foreground(colors.BrandOrange)
+	theme := formTheme(colors.Brand)
 
 	huhForm := huh.NewForm(
 		huh.NewGroup(
@@ -154,11 +185,7 @@ type ConfirmDialog struct {
 func NewConfirmDialog(title, description string) (*ConfirmDialog, error) {
 	dialog := &ConfirmDialog{}
 
-	theme := huh.ThemeCharm()
-	theme.Focused.Base = lipgloss.NewStyle().BorderForeground(colors.Red)
-	theme.Focused.Title = lipgloss.NewStyle().Foreground(colors.Red).Bold(true)
-	theme.Focused.SelectSelector = lipgloss.NewStyle().Foreground(colors.Red).SetString(">")
-	theme.Focused.SelectedOption = lipgloss.NewStyle().Foreground(colors.Red)
+	theme := formTheme(colors.Red)
 
 	huhForm := huh.NewForm(
 		huh.NewGroup(
@@ -196,12 +223,7 @@ func BuildHabitForm(formData *HabitForm) *huh.Form {
 		{Key: "Interval", Value: "interval"},
 	}
 
-	theme := huh.ThemeCharm()
-	theme.Focused.Base = lipgloss.NewStyle().BorderForeground(colors.BrandOrange)
-	theme.Focused.Title = lipgloss.NewStyle().Foreground(colors.BrandOrange).Bold(true)
-	theme.Focused.TextInput.Cursor = lipgloss.NewStyle().Foreground(colors.BrandOrange)
-	theme.Focused.SelectSelector = lipgloss.NewStyle().Foreground(colors.BrandOrange).SetString(">")
-	theme.Focused.SelectedOption = lipgloss.NewStyle().Foreground(colors.BrandOrange)
+	theme := formTheme(colors.Brand)
 
 	return huh.NewForm(
 		huh.NewGroup(
@@ -237,12 +259,7 @@ func NewHabitForm() (*HabitForm, error) {
 		{Key: "Interval", Value: "interval"},
 	}
 
-	theme := huh.ThemeCharm()
-	theme.Focused.Base = lipgloss.NewStyle().BorderForeground(colors.BrandOrange)
-	theme.Focused.Title = lipgloss.NewStyle().Foreground(colors.BrandOrange).Bold(true)
-	theme.Focused.TextInput.Cursor = lipgloss.NewStyle().Foreground(colors.BrandOrange)
-	theme.Focused.SelectSelector = lipgloss.NewStyle().Foreground(colors.BrandOrange).SetString(">")
-	theme.Focused.SelectedOption = lipgloss.NewStyle().Foreground(colors.BrandOrange)
+	theme := formTheme(colors.Brand)
 
 	huhForm := huh.NewForm(
 		huh.NewGroup(
@@ -276,15 +293,40 @@ func NewHabitForm() (*HabitForm, error) {
 	return form, nil
 }
 
+type LoginForm struct {
+	Token string
+}
+
+func BuildLoginForm(formData *LoginForm) *huh.Form {
+	theme := formTheme(colors.Brand)
+
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Marcel CLI Token").
+				Description("Generate one in the Marcel web app settings").
+				EchoMode(huh.EchoModePassword).
+				Value(&formData.Token).
+				Validate(func(s string) error {
+					if len(s) == 0 {
+						return fmt.Errorf("token cannot be empty")
+					}
+					return nil
+				}),
+		),
+	).
+		WithTheme(theme).
+		WithWidth(60).
+		WithHeight(8).
+		WithKeyMap(getFormKeyMap())
+}
+
 type JourneyForm struct {
 	Name string
 }
 
 func BuildJourneyForm(formData *JourneyForm) *huh.Form {
-	theme := huh.ThemeCharm()
-	theme.Focused.Base = lipgloss.NewStyle().BorderForeground(colors.BrandOrange)
-	theme.Focused.Title = lipgloss.NewStyle().Foreground(colors.BrandOrange).Bold(true)
-	theme.Focused.TextInput.Cursor = lipgloss.NewStyle().Foreground(colors.BrandOrange)
+	theme := formTheme(colors.Brand)
 
 	return huh.NewForm(
 		huh.NewGroup(
@@ -309,10 +351,7 @@ func BuildJourneyForm(formData *JourneyForm) *huh.Form {
 func NewJourneyForm() (*JourneyForm, error) {
 	form := &JourneyForm{}
 
-	theme := huh.ThemeCharm()
-	theme.Focused.Base = lipgloss.NewStyle().BorderForeground(colors.BrandOrange)
-	theme.Focused.Title = lipgloss.NewStyle().Foreground(colors.BrandOrange).Bold(true)
-	theme.Focused.TextInput.Cursor = lipgloss.NewStyle().Foreground(colors.BrandOrange)
+	theme := formTheme(colors.Brand)
 
 	huhForm := huh.NewForm(
 		huh.NewGroup(
@@ -352,12 +391,7 @@ func NewQuestFormSimple() (*QuestForm, error) {
 		{Key: "Legendary", Value: "legendary"},
 	}
 
-	theme := huh.ThemeCharm()
-	theme.Focused.Base = lipgloss.NewStyle().BorderForeground(colors.BrandOrange)
-	theme.Focused.Title = lipgloss.NewStyle().Foreground(colors.BrandOrange).Bold(true)
-	theme.Focused.TextInput.Cursor = lipgloss.NewStyle().Foreground(colors.BrandOrange)
-	theme.Focused.SelectSelector = lipgloss.NewStyle().Foreground(colors.BrandOrange).SetString(">")
-	theme.Focused.SelectedOption = lipgloss.NewStyle().Foreground(colors.BrandOrange)
+	theme := formTheme(colors.Brand)
 
 	huhForm := huh.NewForm(
 		huh.NewGroup(
@@ -396,6 +430,66 @@ func NewQuestFormSimple() (*QuestForm, error) {
 	return form, nil
 }
 
+// BulkForm holds the difficulty or journey picked for the marked quests.
+// Field says which of the two the form asks for.
+type BulkForm struct {
+	Field      string
+	Difficulty string
+	JourneyID  int
+}
+
+func BuildDifficultyForm(formData *BulkForm, count int) *huh.Form {
+	difficultyOptions := []huh.Option[string]{
+		{Key: "Easy", Value: "easy"},
+		{Key: "Medium", Value: "medium"},
+		{Key: "Hard", Value: "hard"},
+		{Key: "Epic", Value: "epic"},
+		{Key: "Legendary", Value: "legendary"},
+	}
+
+	theme := formTheme(colors.Brand)
+
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title(fmt.Sprintf("Difficulty for %s", countNoun(count, "quest"))).
+				Options(difficultyOptions...).
+				Value(&formData.Difficulty),
+		),
+	).
+		WithTheme(theme).
+		WithWidth(60).
+		WithHeight(10).
+		WithKeyMap(getFormKeyMap())
+}
+
+func BuildMoveForm(formData *BulkForm, journeys []models.Journey, count int) *huh.Form {
+	var journeyOptions []huh.Option[int]
+	for _, j := range journeys {
+		if j.ID != 0 {
+			journeyOptions = append(journeyOptions, huh.Option[int]{
+				Key:   j.Name,
+				Value: j.ID,
+			})
+		}
+	}
+
+	theme := formTheme(colors.Brand)
+
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[int]().
+				Title(fmt.Sprintf("Move %s to", countNoun(count, "quest"))).
+				Options(journeyOptions...).
+				Value(&formData.JourneyID),
+		),
+	).
+		WithTheme(theme).
+		WithWidth(60).
+		WithHeight(15).
+		WithKeyMap(getFormKeyMap())
+}
+
 type EventForm struct {
 	Title       string
 	Date        string
@@ -405,11 +499,20 @@ type EventForm struct {
 	Description string
 }
 
+// optionalFields returns the fields the API takes as optional, nil when
+// left empty.
+func (f EventForm) optionalFields() (timeStr, endTime, location, description *string) {
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+	return optional(f.Time), optional(f.EndTime), optional(f.Location), optional(f.Description)
+}
+
 func BuildEventForm(formData *EventForm) *huh.Form {
-	theme := huh.ThemeCharm()
-	theme.Focused.Base = lipgloss.NewStyle().BorderForeground(colors.BrandOrange)
-	theme.Focused.Title = lipgloss.NewStyle().Foreground(colors.BrandOrange).Bold(true)
-	theme.Focused.TextInput.Cursor = lipgloss.NewStyle().Foreground(colors.BrandOrange)
+	theme := formTheme(colors.Brand)
 
 	return huh.NewForm(
 		huh.NewGroup(
@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"marcel-cli/history"
+	"marcel-cli/ui/colors"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var historyRanges = []struct {
+	label string
+	since string
+}{
+	{"Today", "today"},
+	{"Since yesterday", "yesterday"},
+	{"Last 7 days", "7d"},
+	{"Last 30 days", "30d"},
+}
+
+type historyBrowser struct {
+	rangeIndex int
+	report     history.Report
+	err        error
+	scroll     int
+	returnTo   ViewMode
+}
+
+func (m Model) openHistory() (tea.Model, tea.Cmd) {
+	m.history = &historyBrowser{rangeIndex: 1, returnTo: m.mode}
+	m.loadHistory()
+	m.mode = HistoryView
+	return m, nil
+}
+
+func (m Model) loadHistory() {
+	h := m.history
+	now := time.Now()
+	since, _ := history.ParseDay(historyRanges[h.rangeIndex].since, now)
+	until, _ := history.ParseDay("today", now)
+
+	h.report, h.err = history.Since(m.storage, since, until)
+	h.scroll = 0
+}
+
+func (m Model) handleHistoryKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.history == nil {
+		m.mode = QuestListView
+		return m, nil
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Quit, m.keys.Back, m.keys.History):
+		m.mode = m.history.returnTo
+		m.history = nil
+	case key.Matches(msg, m.keys.Left):
+		if m.history.rangeIndex > 0 {
+			m.history.rangeIndex--
+			m.loadHistory()
+		}
+	case key.Matches(msg, m.keys.Right):
+		if m.history.rangeIndex < len(historyRanges)-1 {
+			m.history.rangeIndex++
+			m.loadHistory()
+		}
+	case key.Matches(msg, m.keys.Up):
+		if m.history.scroll > 0 {
+			m.history.scroll--
+		}
+	case key.Matches(msg, m.keys.Down):
+		if m.history.scroll < len(m.historyLines())-m.historyHeight() {
+			m.history.scroll++
+		}
+	case key.Matches(msg, m.keys.Top):
+		m.history.scroll = 0
+	}
+	return m, nil
+}
+
+func (m Model) historyHeight() int {
+	return max(m.height-10, 1)
+}
+
+func (m Model) historyLines() []string {
+	h := m.history
+	if h.err != nil {
+		return []string{ErrorStyle.Render(h.err.Error())}
+	}
+	if h.report.Empty() {
+		return []string{MutedStyle.Render("No changes.")}
+	}
+
+	sectionStyle := lipgloss.NewStyle().Foreground(colors.Brand).Bold(true)
+
+	var lines []string
+	for _, section := range h.report.Sections() {
+		lines = append(lines, sectionStyle.Render(fmt.Sprintf("%s (%d)", section.Title, len(section.Entries))))
+		for _, e := range section.Entries {
+			line := "  • " + NormalItemStyle.Render(e.Title)
+			if e.Detail != "" {
+				line += "  " + MutedStyle.Render(e.Detail)
+			}
+			lines = append(lines, line)
+		}
+		lines = append(lines, "")
+	}
+	return lines[:len(lines)-1]
+}
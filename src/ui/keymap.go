@@ -0,0 +1,362 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"marcel-cli/config"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// KeyMap holds the TUI's key bindings by action. Every action can be rebound
+// under keys in the config file, e.g. toggle: [x, space].
+type KeyMap struct {
+	Quit        key.Binding
+	Help        key.Binding
+	History     key.Binding
+	Refresh     key.Binding
+	New         key.Binding
+	Toggle      key.Binding
+	Delete      key.Binding
+	Edit        key.Binding
+	Undo        key.Binding
+	Redo        key.Binding
+	Mark        key.Binding
+	MarkUp      key.Binding
+	MarkDown    key.Binding
+	Difficulty  key.Binding
+	Move        key.Binding
+	Sort        key.Binding
+	Group       key.Binding
+	NextSection key.Binding
+	PrevSection key.Binding
+	Back        key.Binding
+
+	Up     key.Binding
+	Down   key.Binding
+	Left   key.Binding
+	Right  key.Binding
+	Top    key.Binding
+	Bottom key.Binding
+
+	Open      key.Binding
+	PrevMonth key.Binding
+	NextMonth key.Binding
+	Today     key.Binding
+
+	Confirm   key.Binding
+	Switch    key.Binding
+	AllMine   key.Binding
+	AllTheirs key.Binding
+
+	// Filter belongs to the lists themselves and cannot be rebound; it is
+	// here so the help view shows it and bindings cannot take its key.
+	Filter key.Binding
+}
+
+type keyAction struct {
+	name    string
+	binding *key.Binding
+}
+
+func (k *KeyMap) actions() []keyAction {
+	return []keyAction{
+		{"quit", &k.Quit},
+		{"help", &k.Help},
+		{"history", &k.History},
+		{"refresh", &k.Refresh},
+		{"new", &k.New},
+		{"toggle", &k.Toggle},
+		{"delete", &k.Delete},
+		{"edit", &k.Edit},
+		{"undo", &k.Undo},
+		{"redo", &k.Redo},
+		{"mark", &k.Mark},
+		{"mark_up", &k.MarkUp},
+		{"mark_down", &k.MarkDown},
+		{"difficulty", &k.Difficulty},
+		{"move", &k.Move},
+		{"sort", &k.Sort},
+		{"group", &k.Group},
+		{"next_section", &k.NextSection},
+		{"prev_section", &k.PrevSection},
+		{"back", &k.Back},
+		{"up", &k.Up},
+		{"down", &k.Down},
+		{"left", &k.Left},
+		{"right", &k.Right},
+		{"top", &k.Top},
+		{"bottom", &k.Bottom},
+		{"open", &k.Open},
+		{"prev_month", &k.PrevMonth},
+		{"next_month", &k.NextMonth},
+		{"today", &k.Today},
+		{"confirm", &k.Confirm},
+		{"switch", &k.Switch},
+		{"all_mine", &k.AllMine},
+		{"all_theirs", &k.AllTheirs},
+	}
+}
+
+// KeyActions lists the action names the keys section of the config file
+// accepts.
+func KeyActions() []string {
+	var keys KeyMap
+	var names []string
+	for _, a := range keys.actions() {
+		names = append(names, a.name)
+	}
+	return names
+}
+
+func newBinding(description string, keys ...string) key.Binding {
+	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(keysLabel(keys), description))
+}
+
+// DefaultKeyMap is the keymap used when the config file rebinds nothing.
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Quit:        newBinding("quit", "q", "ctrl+c"),
+		Help:        newBinding("show/hide help", "?"),
+		History:     newBinding("show what changed since yesterday", "D"),
+		Refresh:     newBinding("refresh from the server", "r"),
+		New:         newBinding("create a new item", "n"),
+		Toggle:      newBinding("toggle done, or open a journey", " ", "enter"),
+		Delete:      newBinding("delete", "d"),
+		Edit:        newBinding("edit", "e"),
+		Undo:        newBinding("undo the last change", "u"),
+		Redo:        newBinding("redo the last undone change", "ctrl+r"),
+		Mark:        newBinding("mark or unmark for a bulk action", "v"),
+		MarkUp:      newBinding("mark upwards", "shift+up"),
+		MarkDown:    newBinding("mark downwards", "shift+down"),
+		Difficulty:  newBinding("change the difficulty of quests", "c"),
+		Move:        newBinding("move quests to a journey", "m"),
+		Sort:        newBinding("change how quests are sorted", "s"),
+		Group:       newBinding("change how quests are grouped", "S"),
+		NextSection: newBinding("next section", "tab"),
+		PrevSection: newBinding("previous section", "shift+tab"),
+		Back:        newBinding("go back or cancel", "esc"),
+
+		Up:     newBinding("move up", "up", "k"),
+		Down:   newBinding("move down", "down", "j"),
+		Left:   newBinding("move left", "left", "h"),
+		Right:  newBinding("move right", "right", "l"),
+		Top:    newBinding("jump to top", "g", "home"),
+		Bottom: newBinding("jump to bottom", "G", "end"),
+
+		Open:      newBinding("show the day's events", "enter"),
+		PrevMonth: newBinding("previous month", "ctrl+left"),
+		NextMonth: newBinding("next month", "ctrl+right"),
+		Today:     newBinding("jump to today", "t"),
+
+		Confirm:   newBinding("confirm", "enter"),
+		Switch:    newBinding("switch the highlighted choice", " "),
+		AllMine:   newBinding("keep all of my changes", "m"),
+		AllTheirs: newBinding("keep all of the server's changes", "t"),
+
+		Filter: newBinding("filter the list", "/"),
+	}
+}
+
+// keyContexts lists the actions each view listens to. Two actions in the
+// same view cannot share a key.
+var keyContexts = []struct {
+	name    string
+	actions []string
+}{
+	{"lists", []string{"quit", "help", "history", "refresh", "new", "toggle", "delete", "edit", "undo", "redo", "mark", "mark_up", "mark_down", "difficulty", "move", "sort", "group", "next_section", "prev_section", "back", "up", "down", "top", "bottom", "filter"}},
+	{"calendar", []string{"quit", "help", "history", "refresh", "new", "next_section", "prev_section", "open", "back", "delete", "edit", "undo", "redo", "up", "down", "left", "right", "prev_month", "next_month", "today"}},
+	{"sync conflicts", []string{"quit", "back", "up", "down", "left", "right", "switch", "all_mine", "all_theirs", "confirm"}},
+	{"delete confirmation", []string{"quit", "back", "left", "right", "confirm", "switch"}},
+	{"history", []string{"quit", "back", "history", "left", "right", "up", "down", "top"}},
+}
+
+// NewKeyMap applies the config file's keys section to the default keymap.
+// Unknown actions, unknown key names and keys bound twice in one view are
+// errors.
+func NewKeyMap(overrides map[string]config.KeyList) (KeyMap, error) {
+	keys := DefaultKeyMap()
+	byName := map[string]*key.Binding{"filter": &keys.Filter}
+	for _, a := range keys.actions() {
+		byName[a.name] = a.binding
+	}
+
+	var errs []error
+	actions := make([]string, 0, len(overrides))
+	for action := range overrides {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	for _, action := range actions {
+		binding, ok := byName[action]
+		if !ok || action == "filter" {
+			errs = append(errs, fmt.Errorf("keys.%s: unknown action (expected one of %s)", action, strings.Join(KeyActions(), ", ")))
+			continue
+		}
+
+		var bound []string
+		for _, k := range overrides[action] {
+			name, err := parseKey(k)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("keys.%s: %w", action, err))
+				continue
+			}
+			bound = append(bound, name)
+		}
+		*binding = newBinding(binding.Help().Desc, bound...)
+		if len(bound) == 0 {
+			binding.SetEnabled(false)
+		}
+	}
+	if len(errs) > 0 {
+		return keys, errors.Join(errs...)
+	}
+
+	for _, ctx := range keyContexts {
+		owner := map[string]string{}
+		for _, action := range ctx.actions {
+			for _, k := range byName[action].Keys() {
+				if other, taken := owner[k]; taken && other != action {
+					errs = append(errs, fmt.Errorf("keys: %s is bound to both %s and %s in the %s view", keyLabel(k), other, action, ctx.name))
+					continue
+				}
+				owner[k] = action
+			}
+		}
+	}
+	return keys, errors.Join(errs...)
+}
+
+var namedKeys = []string{
+	"enter", "esc", "tab", "shift+tab", "backspace", "delete", "insert",
+	"up", "down", "left", "right", "home", "end", "pgup", "pgdown",
+	"shift+up", "shift+down", "shift+left", "shift+right",
+	"ctrl+up", "ctrl+down", "ctrl+left", "ctrl+right",
+	"f1", "f2", "f3", "f4", "f5", "f6", "f7", "f8", "f9", "f10", "f11", "f12",
+}
+
+// parseKey turns a key as written in the config file into the name Bubble
+// Tea reports for it: a single character, space, ctrl+<letter>, alt+<key>
+// or a named key such as enter or pgdown.
+func parseKey(k string) (string, error) {
+	k = strings.TrimSpace(k)
+	lower := strings.ToLower(k)
+	switch {
+	case lower == "space":
+		return " ", nil
+	case lower == "escape":
+		return "esc", nil
+	case len([]rune(k)) == 1:
+		return k, nil
+	case slices.Contains(namedKeys, lower):
+		return lower, nil
+	case strings.HasPrefix(lower, "ctrl+") && len(lower) == len("ctrl+")+1:
+		return lower, nil
+	case strings.HasPrefix(lower, "alt+"):
+		rest, err := parseKey(k[len("alt+"):])
+		if err != nil {
+			return "", err
+		}
+		return "alt+" + rest, nil
+	}
+	return "", fmt.Errorf("unknown key %q (use a character, space, ctrl+x, alt+x or a name such as enter, esc, tab, up or pgdown)", k)
+}
+
+var keySymbols = map[string]string{
+	" ":     "space",
+	"up":    "↑",
+	"down":  "↓",
+	"left":  "←",
+	"right": "→",
+}
+
+func keyLabel(k string) string {
+	if symbol, ok := keySymbols[k]; ok {
+		return symbol
+	}
+	return k
+}
+
+func keysLabel(keys []string) string {
+	labels := make([]string, len(keys))
+	for i, k := range keys {
+		labels[i] = keyLabel(k)
+	}
+	return strings.Join(labels, "/")
+}
+
+type helpEntry struct {
+	binding key.Binding
+	desc    string
+}
+
+// HelpText lists the bindings by view, one per line. Entries with their own
+// description say what a shared action like left does in that view.
+func (k KeyMap) HelpText() string {
+	sections := []struct {
+		title   string
+		entries []helpEntry
+	}{
+		{"Lists", []helpEntry{{k.Up, ""}, {k.Down, ""}, {k.Top, ""}, {k.Bottom, ""}, {k.Filter, ""}, {k.Toggle, ""}, {k.New, ""}, {k.Edit, ""}, {k.Delete, ""}, {k.Mark, ""}, {k.MarkUp, ""}, {k.MarkDown, ""}, {k.Difficulty, ""}, {k.Move, ""}, {k.Sort, ""}, {k.Group, ""}, {k.NextSection, ""}, {k.PrevSection, ""}, {k.Back, "clear the marks or leave a journey"}}},
+		{"Calendar", []helpEntry{{k.Left, "previous day"}, {k.Right, "next day"}, {k.Up, "previous week"}, {k.Down, "next week"}, {k.PrevMonth, ""}, {k.NextMonth, ""}, {k.Today, ""}, {k.Open, ""}, {k.Back, "back to the month"}}},
+		{"Sync conflicts", []helpEntry{{k.Left, "keep my version"}, {k.Right, "keep the server's version"}, {k.Switch, ""}, {k.AllMine, ""}, {k.AllTheirs, ""}, {k.Confirm, "resolve"}, {k.Back, "cancel"}}},
+		{"Everywhere", []helpEntry{{k.Undo, ""}, {k.Redo, ""}, {k.Refresh, ""}, {k.History, ""}, {k.Help, ""}, {k.Quit, ""}}},
+	}
+
+	var sb strings.Builder
+	for i, section := range sections {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(section.title + ":\n")
+		for _, e := range section.entries {
+			if !e.binding.Enabled() {
+				continue
+			}
+			desc := e.desc
+			if desc == "" {
+				desc = e.binding.Help().Desc
+			}
+			fmt.Fprintf(&sb, "  %-14s %s\n", e.binding.Help().Key, desc)
+		}
+	}
+	return sb.String()
+}
+
+// listKeyMap leaves the lists only the keys the keymap does not cover:
+// filtering and paging. Moving the cursor goes through the keymap so a
+// rebound key does not also move it.
+func listKeyMap() list.KeyMap {
+	km := list.DefaultKeyMap()
+	km.PrevPage = key.NewBinding(key.WithKeys("pgup"))
+	km.NextPage = key.NewBinding(key.WithKeys("pgdown"))
+	for _, b := range []*key.Binding{&km.CursorUp, &km.CursorDown, &km.GoToStart, &km.GoToEnd, &km.ShowFullHelp, &km.CloseFullHelp, &km.Quit, &km.ForceQuit} {
+		b.SetEnabled(false)
+	}
+	return km
+}
+
+// hint describes what a group of bindings does, as in "←/h, →/l: Range".
+// Unbound actions are left out.
+func hint(desc string, bindings ...key.Binding) string {
+	var labels []string
+	for _, b := range bindings {
+		if b.Enabled() {
+			labels = append(labels, b.Help().Key)
+		}
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	return strings.Join(labels, ", ") + ": " + desc
+}
+
+func hints(parts ...string) string {
+	return strings.Join(slices.DeleteFunc(parts, func(p string) bool { return p == "" }), "  ")
+}
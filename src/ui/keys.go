@@ -1,146 +1,255 @@
 package ui
 
 import (
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/huh"
 )
 
+// handleListNavigation moves the cursor of l for the up, down, top and
+// bottom actions, and hands every other key to the list itself. The cursor
+// never rests on a group header.
+func (m Model) handleListNavigation(l *list.Model, msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		l.CursorUp()
+		skipHeaders(l, -1)
+	case key.Matches(msg, m.keys.Down):
+		l.CursorDown()
+		skipHeaders(l, 1)
+	case key.Matches(msg, m.keys.Top):
+		l.Select(0)
+		skipHeaders(l, 1)
+	case key.Matches(msg, m.keys.Bottom):
+		l.Select(len(l.VisibleItems()) - 1)
+		skipHeaders(l, -1)
+	default:
+		var cmd tea.Cmd
+		*l, cmd = l.Update(msg)
+		skipHeaders(l, 1)
+		return cmd
+	}
+	return nil
+}
+
 func (m Model) handleQuestListKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "ctrl+c", "q":
+	if m.questList.SettingFilter() {
+		var cmd tea.Cmd
+		m.questList, cmd = m.questList.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Quit):
 		return m, tea.Quit
 
-	case "tab":
+	case key.Matches(msg, m.keys.NextSection):
 		m.currentSection = "habits"
 		return m, nil
 
-	case "shift+tab":
+	case key.Matches(msg, m.keys.PrevSection):
 		m.currentSection = "calendar"
 		return m, nil
 
-	case "?":
+	case key.Matches(msg, m.keys.Help):
 		m.mode = HelpView
 		return m, nil
 
-	case "r":
-		return m.refreshData(), nil
+	case key.Matches(msg, m.keys.History):
+		return m.openHistory()
+
+	case key.Matches(msg, m.keys.Undo):
+		return m.undoChange()
+
+	case key.Matches(msg, m.keys.Redo):
+		return m.redoChange()
 
-	case "n":
+	case key.Matches(msg, m.keys.Refresh):
+		return m.refreshData()
+
+	case key.Matches(msg, m.keys.New):
 		return m.createNewQuest()
 
-	case " ", "enter":
+	case key.Matches(msg, m.keys.Mark, m.keys.MarkUp, m.keys.MarkDown):
+		m.markItems(&m.questList, "quests", msg)
+		return m, nil
+
+	case key.Matches(msg, m.keys.Back) && m.marks.any("quests"):
+		// Otherwise esc goes to the list, which clears its filter.
+		m.marks.clear()
+		return m, nil
+
+	case key.Matches(msg, m.keys.Toggle):
+		if quests := markedQuests(m.questList, m.marks, "quests"); len(quests) > 0 {
+			return m.toggleQuests(quests)
+		}
 		if item, ok := m.questList.SelectedItem().(questItem); ok {
 			return m.toggleQuest(item.quest)
 		}
 
-	case "d":
+	case key.Matches(msg, m.keys.Delete):
+		if quests := markedQuests(m.questList, m.marks, "quests"); len(quests) > 0 {
+			return m.showDeleteConfirmQuests(quests), nil
+		}
 		if item, ok := m.questList.SelectedItem().(questItem); ok {
 			return m.showDeleteConfirm(item.quest), nil
 		}
 
-	case "e":
+	case key.Matches(msg, m.keys.Difficulty):
+		return m.pickDifficulty(questTargets(m.questList, m.marks, "quests"))
+
+	case key.Matches(msg, m.keys.Move):
+		return m.pickJourney(questTargets(m.questList, m.marks, "quests"))
+
+	case key.Matches(msg, m.keys.Sort):
+		return m.changeView("quests", listView.nextSort)
+
+	case key.Matches(msg, m.keys.Group):
+		return m.changeView("quests", func(v listView) listView { return v.nextGroup("quests") })
+
+	case key.Matches(msg, m.keys.Edit):
 		if item, ok := m.questList.SelectedItem().(questItem); ok {
 			return m.editQuest(item.quest)
 		}
 
 	default:
-		var cmd tea.Cmd
-		m.questList, cmd = m.questList.Update(msg)
-		return m, cmd
+		return m, m.handleListNavigation(&m.questList, msg)
 	}
 
 	return m, nil
 }
 
 func (m Model) handleHabitListKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "ctrl+c", "q":
+	if m.habitList.SettingFilter() {
+		var cmd tea.Cmd
+		m.habitList, cmd = m.habitList.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Quit):
 		return m, tea.Quit
 
-	case "tab":
+	case key.Matches(msg, m.keys.NextSection):
 		m.currentSection = "journeys"
 		return m, nil
 
-	case "shift+tab":
+	case key.Matches(msg, m.keys.PrevSection):
 		m.currentSection = "quests"
 		return m, nil
 
-	case "?":
+	case key.Matches(msg, m.keys.Help):
 		m.mode = HelpView
 		return m, nil
 
-	case "r":
-		return m.refreshData(), nil
+	case key.Matches(msg, m.keys.History):
+		return m.openHistory()
+
+	case key.Matches(msg, m.keys.Undo):
+		return m.undoChange()
+
+	case key.Matches(msg, m.keys.Redo):
+		return m.redoChange()
 
-	case "n":
+	case key.Matches(msg, m.keys.Refresh):
+		return m.refreshData()
+
+	case key.Matches(msg, m.keys.New):
 		return m.createNewHabit()
 
-	case " ", "enter":
+	case key.Matches(msg, m.keys.Mark, m.keys.MarkUp, m.keys.MarkDown):
+		m.markItems(&m.habitList, "habits", msg)
+		return m, nil
+
+	case key.Matches(msg, m.keys.Back) && m.marks.any("habits"):
+		// Otherwise esc goes to the list, which clears its filter.
+		m.marks.clear()
+		return m, nil
+
+	case key.Matches(msg, m.keys.Toggle):
+		if habits := markedHabits(m.habitList, m.marks); len(habits) > 0 {
+			return m.toggleHabits(habits)
+		}
 		if item, ok := m.habitList.SelectedItem().(habitItem); ok {
 			return m.toggleHabit(item.habit)
 		}
 
-	case "d":
+	case key.Matches(msg, m.keys.Delete):
+		if habits := markedHabits(m.habitList, m.marks); len(habits) > 0 {
+			return m.showDeleteConfirmHabits(habits), nil
+		}
 		if item, ok := m.habitList.SelectedItem().(habitItem); ok {
 			return m.showDeleteConfirmHabit(item.habit), nil
 		}
 
-	case "e":
+	case key.Matches(msg, m.keys.Edit):
 		if item, ok := m.habitList.SelectedItem().(habitItem); ok {
 			return m.editHabit(item.habit)
 		}
 
 	default:
-		var cmd tea.Cmd
-		m.habitList, cmd = m.habitList.Update(msg)
-		return m, cmd
+		return m, m.handleListNavigation(&m.habitList, msg)
 	}
 
 	return m, nil
 }
 
 func (m Model) handleJourneyListKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "ctrl+c", "q":
+	if m.journeyList.SettingFilter() {
+		var cmd tea.Cmd
+		m.journeyList, cmd = m.journeyList.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Quit):
 		return m, tea.Quit
 
-	case "tab":
+	case key.Matches(msg, m.keys.NextSection):
 		m.currentSection = "calendar"
 		return m, nil
 
-	case "shift+tab":
+	case key.Matches(msg, m.keys.PrevSection):
 		m.currentSection = "habits"
 		return m, nil
 
-	case "?":
+	case key.Matches(msg, m.keys.Help):
 		m.mode = HelpView
 		return m, nil
 
-	case "r":
-		return m.refreshData(), nil
+	case key.Matches(msg, m.keys.History):
+		return m.openHistory()
 
-	case "n":
+	case key.Matches(msg, m.keys.Undo):
+		return m.undoChange()
+
+	case key.Matches(msg, m.keys.Redo):
+		return m.redoChange()
+
+	case key.Matches(msg, m.keys.Refresh):
+		return m.refreshData()
+
+	case key.Matches(msg, m.keys.New):
 		return m.createNewJourney()
 
-	case " ", "enter":
+	case key.Matches(msg, m.keys.Toggle):
 		if item, ok := m.journeyList.SelectedItem().(journeyItem); ok {
 			return m.enterJourney(item.journey), nil
 		}
 
-	case "d":
+	case key.Matches(msg, m.keys.Delete):
 		if item, ok := m.journeyList.SelectedItem().(journeyItem); ok {
 			return m.showDeleteConfirmJourney(item.journey), nil
 		}
 
-	case "e":
+	case key.Matches(msg, m.keys.Edit):
 		if item, ok := m.journeyList.SelectedItem().(journeyItem); ok {
 			return m.editJourney(item.journey)
 		}
 
 	default:
-		var cmd tea.Cmd
-		m.journeyList, cmd = m.journeyList.Update(msg)
-		return m, cmd
+		return m, m.handleListNavigation(&m.journeyList, msg)
 	}
 
 	return m, nil
@@ -148,30 +257,36 @@ func (m Model) handleJourneyListKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 func (m Model) handleCalendarKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	if m.calendar.IsFocusedOnEventList() {
-		switch msg.String() {
-		case "ctrl+c", "q":
+		switch {
+		case key.Matches(msg, m.keys.Quit):
 			return m, tea.Quit
 
-		case "esc":
+		case key.Matches(msg, m.keys.Back):
 			m.calendar.FocusMonthView()
 			return m, nil
 
-		case "up", "k":
+		case key.Matches(msg, m.keys.Undo):
+			return m.undoChange()
+
+		case key.Matches(msg, m.keys.Redo):
+			return m.redoChange()
+
+		case key.Matches(msg, m.keys.Up):
 			m.calendar.NavigateEventListUp()
 			return m, nil
 
-		case "down", "j":
+		case key.Matches(msg, m.keys.Down):
 			m.calendar.NavigateEventListDown()
 			return m, nil
 
-		case "d":
+		case key.Matches(msg, m.keys.Delete):
 			event := m.calendar.GetSelectedEvent()
 			if event != nil {
 				return m.showDeleteConfirmEvent(event), nil
 			}
 			return m, nil
 
-		case "e":
+		case key.Matches(msg, m.keys.Edit):
 			event := m.calendar.GetSelectedEvent()
 			if event != nil {
 				return m.editEvent(event)
@@ -181,57 +296,66 @@ func (m Model) handleCalendarKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
-	switch msg.String() {
-	case "ctrl+c", "q":
+	switch {
+	case key.Matches(msg, m.keys.Quit):
 		return m, tea.Quit
 
-	case "tab":
+	case key.Matches(msg, m.keys.NextSection):
 		m.currentSection = "quests"
 		return m, nil
 
-	case "shift+tab":
+	case key.Matches(msg, m.keys.PrevSection):
 		m.currentSection = "journeys"
 		return m, nil
 
-	case "?":
+	case key.Matches(msg, m.keys.Help):
 		m.mode = HelpView
 		return m, nil
 
-	case "r":
-		return m.refreshData(), nil
+	case key.Matches(msg, m.keys.History):
+		return m.openHistory()
+
+	case key.Matches(msg, m.keys.Undo):
+		return m.undoChange()
 
-	case "n":
+	case key.Matches(msg, m.keys.Redo):
+		return m.redoChange()
+
+	case key.Matches(msg, m.keys.Refresh):
+		return m.refreshData()
+
+	case key.Matches(msg, m.keys.New):
 		return m.createNewEvent()
 
-	case "enter":
+	case key.Matches(msg, m.keys.Open):
 		m.calendar.FocusEventList()
 		return m, nil
 
-	case "left", "h":
+	case key.Matches(msg, m.keys.Left):
 		m.calendar.NavigateLeft()
 		return m, nil
 
-	case "right", "l":
+	case key.Matches(msg, m.keys.Right):
 		m.calendar.NavigateRight()
 		return m, nil
 
-	case "up", "k":
+	case key.Matches(msg, m.keys.Up):
 		m.calendar.NavigateUp()
 		return m, nil
 
-	case "down", "j":
+	case key.Matches(msg, m.keys.Down):
 		m.calendar.NavigateDown()
 		return m, nil
 
-	case "ctrl+left":
+	case key.Matches(msg, m.keys.PrevMonth):
 		m.calendar.NavigatePrevMonth()
 		return m, nil
 
-	case "ctrl+right":
+	case key.Matches(msg, m.keys.NextMonth):
 		m.calendar.NavigateNextMonth()
 		return m, nil
 
-	case "t":
+	case key.Matches(msg, m.keys.Today):
 		m.calendar.GoToToday()
 		return m, nil
 	}
@@ -240,77 +364,115 @@ func (m Model) handleCalendarKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func (m Model) handleJourneyDetailKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "ctrl+c", "q":
+	if m.journeyQuestList.SettingFilter() {
+		var cmd tea.Cmd
+		m.journeyQuestList, cmd = m.journeyQuestList.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Quit):
 		return m, tea.Quit
 
-	case "esc":
+	case key.Matches(msg, m.keys.Back):
+		if m.marks.any("journey") {
+			m.marks.clear()
+			return m, nil
+		}
 		m.mode = QuestListView
 		m.currentSection = "journeys"
 		m.selectedJourney = nil
 		return m, nil
 
-	case "?":
+	case key.Matches(msg, m.keys.Help):
 		m.mode = HelpView
 		return m, nil
 
-	case "r":
-		return m.refreshData(), nil
+	case key.Matches(msg, m.keys.History):
+		return m.openHistory()
 
-	case "n":
+	case key.Matches(msg, m.keys.Undo):
+		return m.undoChange()
+
+	case key.Matches(msg, m.keys.Redo):
+		return m.redoChange()
+
+	case key.Matches(msg, m.keys.Refresh):
+		return m.refreshData()
+
+	case key.Matches(msg, m.keys.New):
 		return m.createNewQuestInJourney()
 
-	case " ", "enter":
+	case key.Matches(msg, m.keys.Mark, m.keys.MarkUp, m.keys.MarkDown):
+		m.markItems(&m.journeyQuestList, "journey", msg)
+		return m, nil
+
+	case key.Matches(msg, m.keys.Toggle):
+		if quests := markedQuests(m.journeyQuestList, m.marks, "journey"); len(quests) > 0 {
+			return m.toggleQuests(quests)
+		}
 		if item, ok := m.journeyQuestList.SelectedItem().(questItem); ok {
 			return m.toggleQuest(item.quest)
 		}
 
-	case "d":
+	case key.Matches(msg, m.keys.Delete):
+		if quests := markedQuests(m.journeyQuestList, m.marks, "journey"); len(quests) > 0 {
+			return m.showDeleteConfirmQuests(quests), nil
+		}
 		if item, ok := m.journeyQuestList.SelectedItem().(questItem); ok {
 			return m.showDeleteConfirm(item.quest), nil
 		}
 
-	case "e":
+	case key.Matches(msg, m.keys.Difficulty):
+		return m.pickDifficulty(questTargets(m.journeyQuestList, m.marks, "journey"))
+
+	case key.Matches(msg, m.keys.Move):
+		return m.pickJourney(questTargets(m.journeyQuestList, m.marks, "journey"))
+
+	case key.Matches(msg, m.keys.Sort):
+		return m.changeView("journey", listView.nextSort)
+
+	case key.Matches(msg, m.keys.Group):
+		return m.changeView("journey", func(v listView) listView { return v.nextGroup("journey") })
+
+	case key.Matches(msg, m.keys.Edit):
 		if item, ok := m.journeyQuestList.SelectedItem().(questItem); ok {
 			return m.editQuest(item.quest)
 		}
 
 	default:
-		var cmd tea.Cmd
-		m.journeyQuestList, cmd = m.journeyQuestList.Update(msg)
-		return m, cmd
+		return m, m.handleListNavigation(&m.journeyQuestList, msg)
 	}
 
 	return m, nil
 }
 
 func (m Model) handleErrorKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "ctrl+c", "q":
+	switch {
+	case key.Matches(msg, m.keys.Quit):
 		return m, tea.Quit
-	case "r":
-		return m.refreshData(), nil
+	case key.Matches(msg, m.keys.Refresh):
+		return m.refreshData()
 	}
 	return m, nil
 }
 
 func (m Model) handleHelpKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "ctrl+c", "q", "esc", "?":
+	if key.Matches(msg, m.keys.Quit, m.keys.Back, m.keys.Help) {
 		m.mode = QuestListView
 	}
 	return m, nil
 }
 
 func (m Model) handleConfirmDeleteKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "ctrl+c", "q", "esc":
+	switch {
+	case key.Matches(msg, m.keys.Quit, m.keys.Back):
 		return m.cancelDelete(), nil
-	case "left", "h":
+	case key.Matches(msg, m.keys.Left):
 		m.confirmSelected = false
-	case "right", "l":
+	case key.Matches(msg, m.keys.Right):
 		m.confirmSelected = true
-	case "enter", " ":
+	case key.Matches(msg, m.keys.Confirm, m.keys.Switch):
 		if m.confirmSelected {
 			if m.confirmQuest != nil {
 				return m.confirmDeleteQuest()
@@ -320,6 +482,10 @@ func (m Model) handleConfirmDeleteKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				return m.confirmDeleteJourney()
 			} else if m.confirmEvent != nil {
 				return m.confirmDeleteEvent()
+			} else if len(m.confirmQuests) > 0 {
+				return m.confirmDeleteQuests()
+			} else if len(m.confirmHabits) > 0 {
+				return m.confirmDeleteHabits()
 			}
 		}
 		return m.cancelDelete(), nil
@@ -327,6 +493,41 @@ func (m Model) handleConfirmDeleteKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+func (m Model) handleConflictKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.conflict == nil {
+		m.mode = QuestListView
+		return m, nil
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Quit, m.keys.Back):
+		return m.cancelConflict(), nil
+	case key.Matches(msg, m.keys.Up):
+		if m.conflict.cursor > 0 {
+			m.conflict.cursor--
+		}
+	case key.Matches(msg, m.keys.Down):
+		if m.conflict.cursor < len(m.conflict.fields)-1 {
+			m.conflict.cursor++
+		}
+	case key.Matches(msg, m.keys.Left):
+		m.conflict.fields[m.conflict.cursor].choice = keepMine
+	case key.Matches(msg, m.keys.Right):
+		m.conflict.fields[m.conflict.cursor].choice = keepTheirs
+	case key.Matches(msg, m.keys.Switch):
+		m.conflict.toggleCurrent()
+	case key.Matches(msg, m.keys.AllMine):
+		m.conflict.chooseAll(keepMine)
+		return m.resolveConflict()
+	case key.Matches(msg, m.keys.AllTheirs):
+		m.conflict.chooseAll(keepTheirs)
+		return m.resolveConflict()
+	case key.Matches(msg, m.keys.Confirm):
+		return m.resolveConflict()
+	}
+	return m, nil
+}
+
 func (m Model) handleFormUpdate(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var form *huh.Form
 	var returnMode ViewMode = QuestListView
@@ -366,6 +567,13 @@ func (m Model) handleFormUpdate(msg tea.Msg) (tea.Model, tea.Cmd) {
 		form = m.eventForm
 		returnMode = QuestListView
 		m.currentSection = "calendar"
+	case BulkEditFormView:
+		form = m.bulkForm
+		if m.selectedJourney != nil {
+			returnMode = JourneyDetailView
+		} else {
+			returnMode = QuestListView
+		}
 	}
 
 	if form == nil {
@@ -392,6 +600,8 @@ func (m Model) handleFormUpdate(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.habitForm = f
 		case EventEditFormView:
 			m.eventForm = f
+		case BulkEditFormView:
+			m.bulkForm = f
 		}
 
 		if f.State == huh.StateCompleted {
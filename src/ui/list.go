@@ -37,7 +37,11 @@ func (i questItem) FilterValue() string {
 	return i.quest.Title
 }
 
-type questDelegate struct{}
+type questDelegate struct {
+	pending pendingSet
+	marks   *marks
+	list    string
+}
 
 func (d questDelegate) Height() int { return 1 }
 
@@ -48,6 +52,10 @@ func (d questDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd {
 }
 
 func (d questDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	if header, ok := listItem.(headerItem); ok {
+		renderHeader(w, header)
+		return
+	}
 	i, ok := listItem.(questItem)
 	if !ok {
 		return
@@ -78,9 +86,7 @@ func (d questDelegate) Render(w io.Writer, m list.Model, index int, listItem lis
 			Render(fmt.Sprintf(" %s%s", journey, reward))
 
 		if isSelected {
-			str = lipgloss.NewStyle().
-				Background(colors.BrandOrange).
-				Foreground(colors.BackgroundPrimary).
+			str = colors.Highlight(lipgloss.NewStyle(), colors.Brand).
 				Render(title + meta)
 		} else {
 			str = title + meta
@@ -119,39 +125,44 @@ func (d questDelegate) Render(w io.Writer, m list.Model, index int, listItem lis
 		}
 	}
 
-	fmt.Fprint(w, str)
+	if d.pending.has("quest", i.quest.ID) {
+		str += pendingMarker()
+	}
+	fmt.Fprint(w, d.marks.prefix(d.list, i.quest.ID)+str)
 }
 
-func newQuestList(data *models.AppData, width, height int) list.Model {
-	incompleteItems := []list.Item{}
-	completedItems := []list.Item{}
+// pendingMarker follows an item whose change is still being saved.
+func pendingMarker() string {
+	return MutedStyle.Render(" ⋯ saving")
+}
+
+func newQuestList(data *models.AppData, pending pendingSet, marks *marks, view listView, width, height int) list.Model {
+	quests := []questItem{}
 
 	for _, journey := range data.Journeys {
 		for _, quest := range journey.Quests {
-			item := questItem{
+			quests = append(quests, questItem{
 				quest:   quest,
 				journey: journey.Name,
-			}
-			if quest.Done {
-				completedItems = append(completedItems, item)
-			} else {
-				incompleteItems = append(incompleteItems, item)
-			}
+			})
 		}
 	}
 
-	items := append(incompleteItems, completedItems...)
+	items := arrangeQuests(quests, data.Journeys, view)
 
-	delegate := questDelegate{}
+	delegate := questDelegate{pending: pending, marks: marks, list: "quests"}
 
 	l := list.New(items, delegate, width, height)
 	l.Title = ""
 	l.SetShowTitle(false)
 	l.SetShowStatusBar(false)
+	l.SetStatusBarItemName("quest", "quests")
 	l.SetShowHelp(false)
+	l.KeyMap = listKeyMap()
 	l.SetFilteringEnabled(true)
-	l.Styles.FilterPrompt = lipgloss.NewStyle().Foreground(colors.BrandOrange)
-	l.Styles.FilterCursor = lipgloss.NewStyle().Foreground(colors.BrandOrange)
+	l.Styles.FilterPrompt = lipgloss.NewStyle().Foreground(colors.Brand)
+	l.Styles.FilterCursor = lipgloss.NewStyle().Foreground(colors.Brand)
+	skipHeaders(&l, 1)
 
 	return l
 }
@@ -185,7 +196,10 @@ func (i habitItem) FilterValue() string {
 	return i.habit.Name
 }
 
-type habitDelegate struct{}
+type habitDelegate struct {
+	pending pendingSet
+	marks   *marks
+}
 
 func (d habitDelegate) Height() int { return 1 }
 
@@ -226,9 +240,7 @@ func (d habitDelegate) Render(w io.Writer, m list.Model, index int, listItem lis
 			Render(fmt.Sprintf("%s %s", checkbox, i.habit.Name))
 
 		if isSelected {
-			str = lipgloss.NewStyle().
-				Background(colors.BrandOrange).
-				Foreground(colors.BackgroundPrimary).
+			str = colors.Highlight(lipgloss.NewStyle(), colors.Brand).
 				Render(title + streak)
 		} else {
 			str = title + streak
@@ -241,10 +253,13 @@ func (d habitDelegate) Render(w io.Writer, m list.Model, index int, listItem lis
 		}
 	}
 
-	fmt.Fprint(w, str)
+	if d.pending.has("habit", i.habit.ID) {
+		str += pendingMarker()
+	}
+	fmt.Fprint(w, d.marks.prefix("habits", i.habit.ID)+str)
 }
 
-func newHabitList(data *models.AppData, width, height int) list.Model {
+func newHabitList(data *models.AppData, pending pendingSet, marks *marks, width, height int) list.Model {
 	items := []list.Item{}
 
 	for _, habit := range data.Habits {
@@ -253,16 +268,17 @@ func newHabitList(data *models.AppData, width, height int) list.Model {
 		})
 	}
 
-	delegate := habitDelegate{}
+	delegate := habitDelegate{pending: pending, marks: marks}
 
 	l := list.New(items, delegate, width, height)
 	l.Title = ""
 	l.SetShowTitle(false)
 	l.SetShowStatusBar(false)
 	l.SetShowHelp(false)
+	l.KeyMap = listKeyMap()
 	l.SetFilteringEnabled(true)
-	l.Styles.FilterPrompt = lipgloss.NewStyle().Foreground(colors.BrandOrange)
-	l.Styles.FilterCursor = lipgloss.NewStyle().Foreground(colors.BrandOrange)
+	l.Styles.FilterPrompt = lipgloss.NewStyle().Foreground(colors.Brand)
+	l.Styles.FilterCursor = lipgloss.NewStyle().Foreground(colors.Brand)
 
 	return l
 }
@@ -283,7 +299,9 @@ func (i journeyItem) FilterValue() string {
 	return i.journey.Name
 }
 
-type journeyDelegate struct{}
+type journeyDelegate struct {
+	pending pendingSet
+}
 
 func (d journeyDelegate) Height() int { return 1 }
 
@@ -312,10 +330,13 @@ func (d journeyDelegate) Render(w io.Writer, m list.Model, index int, listItem l
 		str = NormalItemStyle.Render(i.journey.Name) + questCount
 	}
 
+	if d.pending.has("journey", i.journey.ID) {
+		str += pendingMarker()
+	}
 	fmt.Fprint(w, str)
 }
 
-func newJourneyList(data *models.AppData, width, height int) list.Model {
+func newJourneyList(data *models.AppData, pending pendingSet, width, height int) list.Model {
 	items := []list.Item{}
 
 	for _, journey := range data.Journeys {
@@ -326,48 +347,108 @@ func newJourneyList(data *models.AppData, width, height int) list.Model {
 		}
 	}
 
-	delegate := journeyDelegate{}
+	delegate := journeyDelegate{pending: pending}
 
 	l := list.New(items, delegate, width, height)
 	l.Title = ""
 	l.SetShowTitle(false)
 	l.SetShowStatusBar(false)
 	l.SetShowHelp(false)
+	l.KeyMap = listKeyMap()
 	l.SetFilteringEnabled(true)
-	l.Styles.FilterPrompt = lipgloss.NewStyle().Foreground(colors.BrandOrange)
-	l.Styles.FilterCursor = lipgloss.NewStyle().Foreground(colors.BrandOrange)
+	l.Styles.FilterPrompt = lipgloss.NewStyle().Foreground(colors.Brand)
+	l.Styles.FilterCursor = lipgloss.NewStyle().Foreground(colors.Brand)
 
 	return l
 }
 
-func newJourneyQuestList(journey *models.Journey, width, height int) list.Model {
-	incompleteItems := []list.Item{}
-	completedItems := []list.Item{}
+func newJourneyQuestList(journey *models.Journey, pending pendingSet, marks *marks, view listView, width, height int) list.Model {
+	quests := []questItem{}
 
 	for _, quest := range journey.Quests {
-		item := questItem{
+		quests = append(quests, questItem{
 			quest:   quest,
 			journey: journey.Name,
-		}
-		if quest.Done {
-			completedItems = append(completedItems, item)
-		} else {
-			incompleteItems = append(incompleteItems, item)
-		}
+		})
 	}
 
-	items := append(incompleteItems, completedItems...)
+	items := arrangeQuests(quests, []models.Journey{*journey}, view)
 
-	delegate := questDelegate{}
+	delegate := questDelegate{pending: pending, marks: marks, list: "journey"}
 
 	l := list.New(items, delegate, width, height)
 	l.Title = ""
 	l.SetShowTitle(false)
 	l.SetShowStatusBar(false)
+	l.SetStatusBarItemName("quest", "quests")
 	l.SetShowHelp(false)
+	l.KeyMap = listKeyMap()
 	l.SetFilteringEnabled(true)
-	l.Styles.FilterPrompt = lipgloss.NewStyle().Foreground(colors.BrandOrange)
-	l.Styles.FilterCursor = lipgloss.NewStyle().Foreground(colors.BrandOrange)
+	l.Styles.FilterPrompt = lipgloss.NewStyle().Foreground(colors.Brand)
+	l.Styles.FilterCursor = lipgloss.NewStyle().Foreground(colors.Brand)
+	skipHeaders(&l, 1)
 
 	return l
 }
+
+// rebuildLists recreates every list from m.data while keeping each cursor
+// on the item it was on, for refreshes the user did not ask for.
+func (m Model) rebuildLists() Model {
+	quest, questIndex := m.questList.SelectedItem(), m.questList.Index()
+	habit, habitIndex := m.habitList.SelectedItem(), m.habitList.Index()
+	journey, journeyIndex := m.journeyList.SelectedItem(), m.journeyList.Index()
+	journeyQuest, journeyQuestIndex := m.journeyQuestList.SelectedItem(), m.journeyQuestList.Index()
+
+	m.questList = newQuestList(m.data, m.pending, m.marks, m.views["quests"], m.width-4, m.height-10)
+	m.habitList = newHabitList(m.data, m.pending, m.marks, m.width-4, m.height-10)
+	m.journeyList = newJourneyList(m.data, m.pending, m.width-4, m.height-10)
+	m.calendar.SetEvents(m.data.Events)
+
+	selectSame(&m.questList, quest, questIndex)
+	skipHeaders(&m.questList, 1)
+	selectSame(&m.habitList, habit, habitIndex)
+	selectSame(&m.journeyList, journey, journeyIndex)
+
+	if m.selectedJourney != nil {
+		for _, j := range m.data.Journeys {
+			if j.ID == m.selectedJourney.ID {
+				m.selectedJourney = &j
+				m.journeyQuestList = newJourneyQuestList(&j, m.pending, m.marks, m.views["journey"], m.width-4, m.height-10)
+				selectSame(&m.journeyQuestList, journeyQuest, journeyQuestIndex)
+				skipHeaders(&m.journeyQuestList, 1)
+				break
+			}
+		}
+	}
+
+	return m
+}
+
+// selectSame puts the cursor back on the item that was selected before the
+// list was rebuilt, wherever it moved to. When that item is gone, the cursor
+// stays at the same position.
+func selectSame(l *list.Model, before list.Item, index int) {
+	if id, ok := itemID(before); ok {
+		for i, item := range l.Items() {
+			if other, ok := itemID(item); ok && other == id {
+				l.Select(i)
+				return
+			}
+		}
+	}
+	l.Select(min(index, max(len(l.Items())-1, 0)))
+}
+
+// itemID is the ID of the quest, habit or journey behind a list item.
+// Group headers have none.
+func itemID(item list.Item) (int, bool) {
+	switch i := item.(type) {
+	case questItem:
+		return i.quest.ID, true
+	case habitItem:
+		return i.habit.ID, true
+	case journeyItem:
+		return i.journey.ID, true
+	}
+	return 0, false
+}
@@ -0,0 +1,290 @@
+package ui
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"marcel-cli/fsutil"
+	"marcel-cli/models"
+	"marcel-cli/ui/colors"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// listView is how a quest list is sorted and grouped. The zero value is
+// server order with open quests before done ones.
+type listView struct {
+	Sort  string `json:"sort,omitempty"`
+	Group string `json:"group,omitempty"`
+}
+
+// listViews holds the view of each quest list by section: "quests" for the
+// quests tab and "journey" for the quests of an open journey. They are kept
+// in views.json in the state directory.
+type listViews map[string]listView
+
+func listViewsPath(stateDir string) string {
+	return filepath.Join(stateDir, "views.json")
+}
+
+// loadListViews reads the saved views. A missing or unreadable file leaves
+// every list as it comes.
+func loadListViews(stateDir string) listViews {
+	views := listViews{}
+	if data, err := os.ReadFile(listViewsPath(stateDir)); err == nil {
+		_ = json.Unmarshal(data, &views)
+	}
+	return views
+}
+
+func (v listViews) save(stateDir string) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(listViewsPath(stateDir), data, 0600)
+}
+
+type questSort struct {
+	name    string
+	label   string
+	compare func(a, b models.Quest) int
+}
+
+var difficulties = []string{"easy", "medium", "hard", "epic", "legendary"}
+
+// questSorts are the orders the sort key cycles through. The first keeps
+// the server's order.
+var questSorts = []questSort{
+	{"", "server order", nil},
+	{"difficulty", "by difficulty", func(a, b models.Quest) int {
+		return cmp.Compare(slices.Index(difficulties, b.Difficulty), slices.Index(difficulties, a.Difficulty))
+	}},
+	{"reward", "by reward", func(a, b models.Quest) int {
+		return cmp.Or(cmp.Compare(b.XPReward, a.XPReward), cmp.Compare(b.GoldReward, a.GoldReward))
+	}},
+	{"created", "newest first", func(a, b models.Quest) int { return b.CreatedAt.Compare(a.CreatedAt) }},
+	{"updated", "recently updated first", func(a, b models.Quest) int { return b.UpdatedAt.Compare(a.UpdatedAt) }},
+	{"due", "by due date", func(a, b models.Quest) int {
+		// Quests without a date go last.
+		if a.Date == nil || b.Date == nil {
+			return cmp.Compare(boolRank(a.Date == nil), boolRank(b.Date == nil))
+		}
+		return cmp.Or(strings.Compare(*a.Date, *b.Date), strings.Compare(deref(a.Time), deref(b.Time)))
+	}},
+	{"title", "by title", func(a, b models.Quest) int {
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	}},
+}
+
+type groupOption struct {
+	name  string
+	label string
+}
+
+// questGroups are the groupings the group key cycles through. The first
+// only puts done quests last, without headers.
+var questGroups = []groupOption{
+	{"", "open quests first"},
+	{"journey", "grouped by journey"},
+	{"difficulty", "grouped by difficulty"},
+	{"status", "grouped by status"},
+	{"none", "not grouped"},
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func findSort(name string) questSort {
+	for _, s := range questSorts {
+		if s.name == name {
+			return s
+		}
+	}
+	return questSorts[0]
+}
+
+// nextSort and nextGroup cycle through the options. The open journey's
+// quests all belong to it, so that list skips grouping by journey.
+func (v listView) nextSort() listView {
+	i := slices.IndexFunc(questSorts, func(s questSort) bool { return s.name == v.Sort })
+	v.Sort = questSorts[(i+1)%len(questSorts)].name
+	return v
+}
+
+func (v listView) nextGroup(section string) listView {
+	i := slices.IndexFunc(questGroups, func(g groupOption) bool { return g.name == v.Group })
+	for {
+		i = (i + 1) % len(questGroups)
+		if section != "journey" || questGroups[i].name != "journey" {
+			break
+		}
+	}
+	v.Group = questGroups[i].name
+	return v
+}
+
+func (v listView) groupLabel() string {
+	for _, g := range questGroups {
+		if g.name == v.Group {
+			return g.label
+		}
+	}
+	return questGroups[0].label
+}
+
+// label describes a view other than the default for the header.
+func (v listView) label() string {
+	var parts []string
+	if v.Sort != "" {
+		parts = append(parts, findSort(v.Sort).label)
+	}
+	if v.Group != "" {
+		parts = append(parts, v.groupLabel())
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " · " + strings.Join(parts, ", ")
+}
+
+// questGroup is one group of a grouped quest list, under its header.
+type questGroup struct {
+	title string
+	in    func(q models.Quest) bool
+}
+
+// headerItem starts a group in a grouped quest list. The cursor skips it.
+type headerItem struct {
+	title string
+	count int
+}
+
+func (i headerItem) FilterValue() string { return "" }
+
+func renderHeader(w io.Writer, i headerItem) {
+	title := lipgloss.NewStyle().Foreground(colors.Brand).Bold(true).Render(i.title)
+	fmt.Fprint(w, title+MutedStyle.Render(fmt.Sprintf(" (%d)", i.count)))
+}
+
+// arrangeQuests sorts and groups items for a quest list. Within groups,
+// open quests come before done ones.
+func arrangeQuests(items []questItem, journeys []models.Journey, view listView) []list.Item {
+	if s := findSort(view.Sort); s.compare != nil {
+		slices.SortStableFunc(items, func(a, b questItem) int { return s.compare(a.quest, b.quest) })
+	}
+	if view.Group != "none" {
+		slices.SortStableFunc(items, func(a, b questItem) int {
+			return cmp.Compare(boolRank(a.quest.Done), boolRank(b.quest.Done))
+		})
+	}
+
+	var groups []questGroup
+	switch view.Group {
+	case "journey":
+		for _, j := range journeys {
+			id := j.ID
+			groups = append(groups, questGroup{j.Name, func(q models.Quest) bool { return questJourneyID(q) == id }})
+		}
+	case "difficulty":
+		for i := len(difficulties) - 1; i >= 0; i-- {
+			d := difficulties[i]
+			groups = append(groups, questGroup{capitalize(d), func(q models.Quest) bool { return q.Difficulty == d }})
+		}
+		groups = append(groups, questGroup{"Other", func(q models.Quest) bool { return !slices.Contains(difficulties, q.Difficulty) }})
+	case "status":
+		groups = append(groups,
+			questGroup{"Open", func(q models.Quest) bool { return !q.Done }},
+			questGroup{"Done", func(q models.Quest) bool { return q.Done }},
+		)
+	default:
+		result := make([]list.Item, len(items))
+		for i, item := range items {
+			result[i] = item
+		}
+		return result
+	}
+
+	var result []list.Item
+	for _, g := range groups {
+		var members []list.Item
+		for _, item := range items {
+			if g.in(item.quest) {
+				members = append(members, item)
+			}
+		}
+		if len(members) > 0 {
+			result = append(result, headerItem{title: g.title, count: len(members)})
+			result = append(result, members...)
+		}
+	}
+	return result
+}
+
+// questCount is how many quests l shows, or matches its filter, leaving out
+// the group headers that sit among them.
+func questCount(l list.Model) int {
+	count := 0
+	for _, item := range l.VisibleItems() {
+		if _, header := item.(headerItem); !header {
+			count++
+		}
+	}
+	return count
+}
+
+// skipHeaders moves the cursor off a group header in direction dir (1 or
+// -1), or the other way when there is no quest further on.
+func skipHeaders(l *list.Model, dir int) {
+	items := l.VisibleItems()
+	for _, d := range []int{dir, -dir} {
+		for i := l.Index(); i >= 0 && i < len(items); i += d {
+			if _, header := items[i].(headerItem); !header {
+				l.Select(i)
+				return
+			}
+		}
+	}
+}
+
+// changeView switches how the quest list of section is sorted or grouped
+// and remembers it for the next start.
+func (m Model) changeView(section string, change func(listView) listView) (Model, tea.Cmd) {
+	before, after := m.views[section], change(m.views[section])
+	m.views[section] = after
+	m = m.rebuildLists()
+
+	if after.Sort != before.Sort {
+		m.message = "Sorted: " + findSort(after.Sort).label
+	} else {
+		m.message = "Quests: " + after.groupLabel()
+	}
+	if err := m.views.save(m.storage.GetConfig().Paths.StateDir); err != nil {
+		m.message = fmt.Sprintf("Failed to save the list view: %v", err)
+		return m, clearMessageAfter(m.message, 10*time.Second)
+	}
+	return m, clearMessageAfter(m.message, 2*time.Second)
+}
@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"marcel-cli/models"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+func testJourneys() []models.Journey {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 9, 0, 0, 0, time.UTC) }
+	date := func(s string) *string { return &s }
+	mine, work := 1, 2
+	return []models.Journey{
+		{ID: mine, Name: "My Quests", Quests: []models.Quest{
+			{ID: 1, Title: "walk", Difficulty: "easy", XPReward: 10, CreatedAt: day(1), Date: date("2024-02-03"), JourneyID: &mine},
+			{ID: 2, Title: "Bake", Difficulty: "hard", XPReward: 30, CreatedAt: day(3), Done: true, JourneyID: &mine},
+		}},
+		{ID: work, Name: "Work", Quests: []models.Quest{
+			{ID: 3, Title: "report", Difficulty: "medium", XPReward: 20, CreatedAt: day(2), Date: date("2024-02-01"), JourneyID: &work},
+			{ID: 4, Title: "archive", Difficulty: "odd", XPReward: 20, GoldReward: 5, CreatedAt: day(4), JourneyID: &work},
+		}},
+	}
+}
+
+// arranged lists the quest titles of items, with headers as "# title (n)".
+func arranged(items []list.Item) []string {
+	var rows []string
+	for _, item := range items {
+		switch i := item.(type) {
+		case headerItem:
+			rows = append(rows, fmt.Sprintf("# %s (%d)", i.title, i.count))
+		case questItem:
+			rows = append(rows, i.quest.Title)
+		}
+	}
+	return rows
+}
+
+func TestArrangeQuests(t *testing.T) {
+	tests := []struct {
+		name string
+		view listView
+		want []string
+	}{
+		{"server order, done last", listView{}, []string{"walk", "report", "archive", "Bake"}},
+		{"not grouped keeps done in place", listView{Group: "none"}, []string{"walk", "Bake", "report", "archive"}},
+		{"by difficulty", listView{Sort: "difficulty", Group: "none"}, []string{"Bake", "report", "walk", "archive"}},
+		{"by reward", listView{Sort: "reward", Group: "none"}, []string{"Bake", "archive", "report", "walk"}},
+		{"newest first", listView{Sort: "created", Group: "none"}, []string{"archive", "Bake", "report", "walk"}},
+		{"by due date", listView{Sort: "due", Group: "none"}, []string{"report", "walk", "Bake", "archive"}},
+		{"by title", listView{Sort: "title", Group: "none"}, []string{"archive", "Bake", "report", "walk"}},
+		{"grouped by journey", listView{Group: "journey"}, []string{
+			"# My Quests (2)", "walk", "Bake",
+			"# Work (2)", "report", "archive",
+		}},
+		{"grouped by difficulty", listView{Group: "difficulty"}, []string{
+			"# Hard (1)", "Bake",
+			"# Medium (1)", "report",
+			"# Easy (1)", "walk",
+			"# Other (1)", "archive",
+		}},
+		{"grouped by status", listView{Sort: "title", Group: "status"}, []string{
+			"# Open (3)", "archive", "report", "walk",
+			"# Done (1)", "Bake",
+		}},
+		{"open first within a group", listView{Sort: "title", Group: "journey"}, []string{
+			"# My Quests (2)", "walk", "Bake",
+			"# Work (2)", "archive", "report",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var items []questItem
+			journeys := testJourneys()
+			for _, j := range journeys {
+				for _, q := range j.Quests {
+					items = append(items, questItem{quest: q, journey: j.Name})
+				}
+			}
+			if got := arranged(arrangeQuests(items, journeys, tt.view)); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuestCountSkipsHeaders(t *testing.T) {
+	data := &models.AppData{Journeys: testJourneys()}
+	tests := []struct {
+		group string
+		want  int
+	}{
+		{"", 4},
+		{"journey", 4},
+		{"difficulty", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.group, func(t *testing.T) {
+			l := newQuestList(data, pendingSet{}, &marks{}, listView{Group: tt.group}, 80, 40)
+			if got := questCount(l); got != tt.want {
+				t.Errorf("questCount = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
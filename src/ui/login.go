@@ -0,0 +1,84 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"marcel-cli/models"
+	"marcel-cli/storage"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+)
+
+type loginResultMsg struct {
+	user  *models.User
+	where string
+	err   error
+}
+
+func loginCmd(auth storage.Authenticator, token string) tea.Cmd {
+	return func() tea.Msg {
+		user, where, err := auth.Login(token)
+		return loginResultMsg{user: user, where: where, err: err}
+	}
+}
+
+func (m Model) showLogin(reason string) (Model, tea.Cmd) {
+	m.loginFormData = &LoginForm{}
+	m.loginForm = BuildLoginForm(m.loginFormData)
+	m.loginError = reason
+	m.loggingIn = false
+	m.mode = LoginView
+	return m, m.loginForm.Init()
+}
+
+func (m Model) handleLoginUpdate(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if result, ok := msg.(loginResultMsg); ok {
+		if result.err != nil {
+			return m.showLogin(result.err.Error())
+		}
+		m.loggingIn = false
+		m.loginForm = nil
+		m.mode = LoadingView
+		m.message = fmt.Sprintf("Logged in as %s", result.user.DisplayName())
+		return m, tea.Batch(
+			m.spinner.Tick,
+			m.syncSpinner.Tick,
+			tickSyncClock(),
+			loadFromAPICmd(m.storage),
+			m.scheduleAutoSync(),
+			clearMessageAfter(m.message, 5*time.Second),
+		)
+	}
+
+	if m.loggingIn || m.loginForm == nil {
+		if key, ok := msg.(tea.KeyMsg); ok && key.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+
+	newForm, cmd := m.loginForm.Update(msg)
+	if f, ok := newForm.(*huh.Form); ok {
+		m.loginForm = f
+
+		switch f.State {
+		case huh.StateAborted:
+			return m, tea.Quit
+		case huh.StateCompleted:
+			auth, ok := m.storage.(storage.Authenticator)
+			if !ok {
+				return m.showLogin("this backend does not use an account")
+			}
+			m.loggingIn = true
+			m.loginError = ""
+			return m, tea.Batch(m.spinner.Tick, loginCmd(auth, strings.TrimSpace(m.loginFormData.Token)))
+		}
+	}
+
+	return m, cmd
+}
@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"fmt"
+	"marcel-cli/config"
 	"marcel-cli/models"
 	"marcel-cli/storage"
 	"marcel-cli/ui/components"
@@ -29,57 +31,110 @@ const (
 	JourneyEditFormView
 	HabitEditFormView
 	EventEditFormView
+	BulkEditFormView
+	ConflictView
+	HistoryView
+	LoginView
 )
 
-type clearMessageMsg struct{}
+// clearMessageMsg clears the status message if it is still the one the
+// timer was started for, so an early timer cannot cut a later message short.
+type clearMessageMsg struct {
+	message string
+}
 
 type clearSyncStatusMsg struct{}
 
+// dataLoadedMsg carries the first load, or a reload the user asked for when
+// refresh is set.
 type dataLoadedMsg struct {
-	data *models.AppData
-	err  error
+	data    *models.AppData
+	err     error
+	refresh bool
 }
 
 type backgroundSyncMsg struct {
 	data *models.AppData
 	err  error
+	auto bool
 }
 
+type autoSyncMsg struct{}
+
+const maxSyncBackoff = 30 * time.Minute
+
 type authCheckMsg struct {
 	err error
 }
 
-func loadDataCmd(s *storage.Storage) tea.Cmd {
+type cacheChangedMsg struct{}
+
+type syncClockMsg struct{}
+
+func loadDataCmd(s storage.Repository) tea.Cmd {
 	return func() tea.Msg {
 		data, err := s.LoadFromCache()
 		return dataLoadedMsg{data: data, err: err}
 	}
 }
 
-func checkAuthCmd(s *storage.Storage) tea.Cmd {
+func checkAuthCmd(s storage.Repository) tea.Cmd {
 	return func() tea.Msg {
-		err := s.GetAPIClient().CheckAuth()
+		err := s.CheckAuth()
 		return authCheckMsg{err: err}
 	}
 }
 
-func loadFromAPICmd(s *storage.Storage) tea.Cmd {
+func loadFromAPICmd(s storage.Repository) tea.Cmd {
 	return func() tea.Msg {
 		data, err := s.Load()
 		return dataLoadedMsg{data: data, err: err}
 	}
 }
 
-func backgroundSyncCmd(s *storage.Storage) tea.Cmd {
+func backgroundSyncCmd(s storage.Repository) tea.Cmd {
 	return func() tea.Msg {
 		data, err := s.LoadAll()
 		return backgroundSyncMsg{data: data, err: err}
 	}
 }
 
-func clearMessageAfter(d time.Duration) tea.Cmd {
+func autoSyncCmd(s storage.Repository) tea.Cmd {
+	return func() tea.Msg {
+		data, err := s.LoadAll()
+		return backgroundSyncMsg{data: data, err: err, auto: true}
+	}
+}
+
+// scheduleAutoSync waits sync_interval before the next background sync,
+// doubling the wait after each consecutive offline failure up to 30 minutes.
+func (m Model) scheduleAutoSync() tea.Cmd {
+	cfg := m.storage.GetConfig()
+	interval := cfg.SyncInterval.Duration
+	if interval <= 0 || m.cacheOnly || cfg.Backend == config.BackendLocal {
+		return nil
+	}
+
+	delay := interval
+	for i := 0; i < m.syncFailures && delay < maxSyncBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, max(maxSyncBackoff, interval))
+
+	return tea.Tick(delay, func(t time.Time) tea.Msg {
+		return autoSyncMsg{}
+	})
+}
+
+func clearMessageAfter(message string, d time.Duration) tea.Cmd {
 	return tea.Tick(d, func(t time.Time) tea.Msg {
-		return clearMessageMsg{}
+		return clearMessageMsg{message: message}
+	})
+}
+
+func tickSyncClock() tea.Cmd {
+	return tea.Tick(30*time.Second, func(t time.Time) tea.Msg {
+		return syncClockMsg{}
 	})
 }
 
@@ -99,7 +154,8 @@ const (
 )
 
 type Model struct {
-	storage          *storage.Storage
+	storage          storage.Repository
+	keys             KeyMap
 	data             *models.AppData
 	mode             ViewMode
 	currentSection   string
@@ -119,6 +175,8 @@ type Model struct {
 	confirmHabit     *models.Habit
 	confirmJourney   *models.Journey
 	confirmEvent     *models.Event
+	confirmQuests    []models.Quest
+	confirmHabits    []models.Habit
 	confirmSelected  bool
 	selectedJourney  *models.Journey
 	questForm        *huh.Form
@@ -129,18 +187,51 @@ type Model struct {
 	journeyFormData  *JourneyForm
 	habitFormData    *HabitForm
 	eventFormData    *EventForm
+	bulkForm         *huh.Form
+	bulkFormData     *BulkForm
+	bulkQuests       []models.Quest
+	loginForm        *huh.Form
+	loginFormData    *LoginForm
+	loginError       string
+	loggingIn        bool
 	editingQuest     *models.Quest
 	editingHabit     *models.Habit
 	editingJourney   *models.Journey
 	editingEvent     *models.Event
+	conflict         *questConflict
+	history          *historyBrowser
+	pending          pendingSet
+	marks            *marks
+	views            listViews
+	saving           int
+	staleData        bool
+	undo             *undoStack
 	syncStatus       SyncStatus
 	syncSpinner      spinner.Model
+	lastSynced       time.Time
+	syncFailures     int
+	cacheOnly        bool
+}
+
+// Options control how the TUI uses the local cache at startup.
+type Options struct {
+	// NoCache ignores cached data and blocks on a full load from the server.
+	NoCache bool
+	// CacheOnly never contacts the server and shows cached data as is.
+	CacheOnly bool
 }
 
-func NewModel() (*Model, error) {
-	s, err := storage.New()
+func NewModel(s storage.Repository, opts Options) (*Model, error) {
+	if opts.NoCache && opts.CacheOnly {
+		return nil, fmt.Errorf("--no-cache and --cache-only cannot be used together")
+	}
+
+	keys, err := NewKeyMap(s.GetConfig().Keys)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+	if err := ApplyTheme(s.GetConfig()); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
 	}
 
 	sp := spinner.New()
@@ -154,19 +245,47 @@ func NewModel() (*Model, error) {
 	cal := components.NewCalendar()
 	cal.SetWeekStartDay(s.GetConfig().WeekStartDay)
 
-	cachedData, cacheErr := s.LoadFromCache()
+	var cachedData *models.AppData
+	cacheErr := fmt.Errorf("cache disabled with --no-cache")
+	if !opts.NoCache {
+		cachedData, cacheErr = s.LoadFromCache()
+	}
+
+	if opts.CacheOnly && cacheErr != nil {
+		return nil, fmt.Errorf("no cached data available for --cache-only: %w", cacheErr)
+	}
+
+	var lastSynced time.Time
+	if cacheErr == nil {
+		lastSynced, _ = s.CacheTimestamp()
+	}
 
 	mode := QuestListView
 	data := &models.AppData{}
 	if cacheErr == nil && cachedData != nil {
 		data = cachedData
 		mode = QuestListView
+
+		maxAge := s.GetConfig().MaxCacheAge.Duration
+		if !opts.CacheOnly && maxAge > 0 && time.Since(lastSynced) > maxAge {
+			mode = LoadingView
+		}
 	} else {
 		mode = LoadingView
 	}
 
+	pending := pendingSet{}
+	cal.SetPending(func(eventID int) bool {
+		return pending.has("event", eventID)
+	})
+
 	m := &Model{
 		storage:        s,
+		pending:        pending,
+		marks:          &marks{},
+		views:          loadListViews(s.GetConfig().Paths.StateDir),
+		undo:           newUndoStack(),
+		keys:           keys,
 		mode:           mode,
 		spinner:        sp,
 		syncSpinner:    syncSp,
@@ -174,17 +293,48 @@ func NewModel() (*Model, error) {
 		currentSection: data.CurrentSection,
 		calendar:       cal,
 		syncStatus:     SyncStatusNone,
+		lastSynced:     lastSynced,
+		cacheOnly:      opts.CacheOnly,
 	}
 
 	if data.CurrentSection == "" {
 		m.currentSection = "quests"
 	}
 
+	if cfg := s.GetConfig(); cfg.Backend == config.BackendAPI && cfg.AuthToken == "" && !opts.CacheOnly {
+		m.mode = LoginView
+		m.loginFormData = &LoginForm{}
+		m.loginForm = BuildLoginForm(m.loginFormData)
+	}
+
+	if warnings := s.GetConfig().Warnings; len(warnings) > 0 {
+		m.message = "⚠ " + warnings[0]
+	}
+
 	return m, nil
 }
 
+// WatchCache pushes a message into the program whenever another marcel
+// instance writes to the shared cache, so this one can refresh its lists.
+func (m *Model) WatchCache(send func(tea.Msg)) (func() error, error) {
+	return m.storage.WatchCache(func() {
+		send(cacheChangedMsg{})
+	})
+}
+
 func (m Model) Init() tea.Cmd {
-	cmds := []tea.Cmd{m.syncSpinner.Tick}
+	if m.mode == LoginView {
+		return m.loginForm.Init()
+	}
+
+	cmds := []tea.Cmd{m.syncSpinner.Tick, tickSyncClock(), m.scheduleAutoSync()}
+	if m.message != "" {
+		cmds = append(cmds, clearMessageAfter(m.message, 10*time.Second))
+	}
+
+	if m.cacheOnly {
+		return tea.Batch(cmds...)
+	}
 
 	if m.mode == LoadingView {
 		cmds = append(cmds, m.spinner.Tick, loadFromAPICmd(m.storage))
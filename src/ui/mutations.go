@@ -0,0 +1,265 @@
+package ui
+
+import (
+	"slices"
+	"time"
+
+	"marcel-cli/config"
+	"marcel-cli/models"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pendingKey names an item with a request in flight: a quest, habit,
+// journey or event by ID.
+type pendingKey struct {
+	kind string
+	id   int
+}
+
+// pendingSet holds the items whose changes are still on their way to the
+// server. The lists and the calendar share it, so they mark an item as soon
+// as its request starts.
+type pendingSet map[pendingKey]bool
+
+func (p pendingSet) has(kind string, id int) bool {
+	return p[pendingKey{kind, id}]
+}
+
+// mutationDoneMsg brings a finished request back into Update. The request
+// runs in the background; apply runs in Update and is the only part that
+// touches the model.
+type mutationDoneMsg struct {
+	key   pendingKey
+	apply func(m Model) (Model, tea.Cmd)
+}
+
+// mutate marks the item behind key as pending and runs request in the
+// background, keeping the UI responsive on a slow connection. Callers change
+// m.data first, so the lists show the change right away; request returns
+// what to do with the model once the server has answered. Creates have no ID
+// yet and pass a key with ID 0, which marks nothing.
+func (m Model) mutate(key pendingKey, request func() func(m Model) (Model, tea.Cmd)) (Model, tea.Cmd) {
+	if key.id != 0 {
+		m.pending[key] = true
+	}
+	m.saving++
+	if m.ready {
+		m = m.rebuildLists()
+	}
+	return m, func() tea.Msg {
+		return mutationDoneMsg{key: key, apply: request()}
+	}
+}
+
+// busy reports whether an item still has a request in flight, and says so
+// in the status bar. A second change could reach the server before the
+// first one.
+func (m Model) busy(kind string, id int) (Model, bool) {
+	if !m.pending.has(kind, id) {
+		return m, false
+	}
+	m.message = "Still saving the last change to this " + kind
+	return m, true
+}
+
+func (m Model) finishMutation(msg mutationDoneMsg) (Model, tea.Cmd) {
+	delete(m.pending, msg.key)
+	m.saving--
+	m, cmd := msg.apply(m)
+	if m.ready {
+		m = m.rebuildLists()
+	}
+	if m.saving == 0 && m.staleData {
+		m.staleData = false
+		cmd = tea.Batch(cmd, func() tea.Msg { return cacheChangedMsg{} })
+	}
+	return m, cmd
+}
+
+// syncAfterSave fetches everything again after a change, so values only the
+// backend computes, such as rewards, show up. The request runs in the
+// background like any other sync.
+func (m Model) syncAfterSave() (Model, tea.Cmd) {
+	if m.cacheOnly || m.storage.GetConfig().Backend == config.BackendLocal {
+		return m, func() tea.Msg { return cacheChangedMsg{} }
+	}
+	if m.syncStatus == SyncStatusSyncing {
+		return m, nil
+	}
+	m.syncStatus = SyncStatusSyncing
+	return m, tea.Batch(backgroundSyncCmd(m.storage), m.syncSpinner.Tick)
+}
+
+// rollBack restores an item an optimistic change touched, after the server
+// refused the change, and keeps the error up long enough to read.
+func (m Model) rollBack(restore func(data *models.AppData), message string) (Model, tea.Cmd) {
+	restore(m.data)
+	m.message = message + " (change undone)"
+	return m, clearMessageAfter(m.message, 10*time.Second)
+}
+
+// insertAt inserts v at index i of s, or appends it when i is out of range.
+func insertAt[T any](s []T, i int, v T) []T {
+	if i < 0 || i > len(s) {
+		i = len(s)
+	}
+	return slices.Insert(s, i, v)
+}
+
+// putQuest replaces the quest with the same ID, moving it when its journey
+// changed, or adds it to its journey.
+func putQuest(data *models.AppData, quest models.Quest) {
+	for i := range data.Journeys {
+		j := &data.Journeys[i]
+		for k := range j.Quests {
+			if j.Quests[k].ID != quest.ID {
+				continue
+			}
+			if j.ID == questJourneyID(quest) {
+				j.Quests[k] = quest
+				return
+			}
+			j.Quests = slices.Delete(j.Quests, k, k+1)
+			break
+		}
+	}
+	insertQuest(data, quest, -1)
+}
+
+// insertQuest adds a quest to its journey at index, or at the end when
+// index is out of range.
+func insertQuest(data *models.AppData, quest models.Quest, index int) {
+	journeyID := questJourneyID(quest)
+	for i := range data.Journeys {
+		if data.Journeys[i].ID == journeyID {
+			data.Journeys[i].Quests = insertAt(data.Journeys[i].Quests, index, quest)
+			return
+		}
+	}
+	if journeyID == 0 {
+		data.Journeys = append([]models.Journey{{Name: "My Quests", Quests: []models.Quest{quest}}}, data.Journeys...)
+	}
+}
+
+func questJourneyID(quest models.Quest) int {
+	if quest.JourneyID == nil {
+		return 0
+	}
+	return *quest.JourneyID
+}
+
+// keepQuest remembers a quest and its place before an optimistic change.
+// The returned function puts it back as it was.
+func keepQuest(data *models.AppData, id int) func(data *models.AppData) {
+	for _, j := range data.Journeys {
+		for index, quest := range j.Quests {
+			if quest.ID == id {
+				return func(data *models.AppData) {
+					removeQuest(data, id)
+					insertQuest(data, quest, index)
+				}
+			}
+		}
+	}
+	return func(*models.AppData) {}
+}
+
+func removeQuest(data *models.AppData, id int) {
+	for i := range data.Journeys {
+		data.Journeys[i].Quests = slices.DeleteFunc(data.Journeys[i].Quests, func(q models.Quest) bool {
+			return q.ID == id
+		})
+	}
+}
+
+func putHabit(data *models.AppData, habit models.Habit) {
+	for i := range data.Habits {
+		if data.Habits[i].ID == habit.ID {
+			data.Habits[i] = habit
+			return
+		}
+	}
+	data.Habits = append(data.Habits, habit)
+}
+
+func keepHabit(data *models.AppData, id int) func(data *models.AppData) {
+	index := slices.IndexFunc(data.Habits, func(h models.Habit) bool { return h.ID == id })
+	if index < 0 {
+		return func(*models.AppData) {}
+	}
+	habit := data.Habits[index]
+	habit.Completed = slices.Clone(habit.Completed)
+	return func(data *models.AppData) {
+		removeHabit(data, id)
+		data.Habits = insertAt(data.Habits, index, habit)
+	}
+}
+
+func removeHabit(data *models.AppData, id int) {
+	data.Habits = slices.DeleteFunc(data.Habits, func(h models.Habit) bool {
+		return h.ID == id
+	})
+}
+
+// putJourney replaces the journey with the same ID, keeping its quests, or
+// adds it.
+func putJourney(data *models.AppData, journey models.Journey) {
+	for i := range data.Journeys {
+		if data.Journeys[i].ID == journey.ID {
+			journey.Quests = data.Journeys[i].Quests
+			data.Journeys[i] = journey
+			return
+		}
+	}
+	data.Journeys = append(data.Journeys, journey)
+}
+
+// keepJourney remembers a journey with its quests; putting it back brings
+// the quests back too.
+func keepJourney(data *models.AppData, id int) func(data *models.AppData) {
+	index := slices.IndexFunc(data.Journeys, func(j models.Journey) bool { return j.ID == id })
+	if index < 0 {
+		return func(*models.AppData) {}
+	}
+	journey := data.Journeys[index]
+	journey.Quests = slices.Clone(journey.Quests)
+	return func(data *models.AppData) {
+		removeJourney(data, id)
+		data.Journeys = insertAt(data.Journeys, index, journey)
+	}
+}
+
+func removeJourney(data *models.AppData, id int) {
+	data.Journeys = slices.DeleteFunc(data.Journeys, func(j models.Journey) bool {
+		return j.ID == id
+	})
+}
+
+func putEvent(data *models.AppData, event models.Event) {
+	for i := range data.Events {
+		if data.Events[i].ID == event.ID {
+			data.Events[i] = event
+			return
+		}
+	}
+	data.Events = append(data.Events, event)
+}
+
+func keepEvent(data *models.AppData, id int) func(data *models.AppData) {
+	index := slices.IndexFunc(data.Events, func(e models.Event) bool { return e.ID == id })
+	if index < 0 {
+		return func(*models.AppData) {}
+	}
+	event := data.Events[index]
+	return func(data *models.AppData) {
+		removeEvent(data, id)
+		data.Events = insertAt(data.Events, index, event)
+	}
+}
+
+func removeEvent(data *models.AppData, id int) {
+	data.Events = slices.DeleteFunc(data.Events, func(e models.Event) bool {
+		return e.ID == id
+	})
+}
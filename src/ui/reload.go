@@ -0,0 +1,64 @@
+package ui
+
+import (
+	"strings"
+	"time"
+
+	"marcel-cli/config"
+	"marcel-cli/ui/colors"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type configChangedMsg struct{}
+
+// WatchConfig pushes a message into the program whenever the config file
+// changes, so the TUI can pick up the new settings without a restart.
+func (m *Model) WatchConfig(send func(tea.Msg)) (func() error, error) {
+	return config.Watch(m.storage.GetConfig().Paths.ConfigFile, func() {
+		send(configChangedMsg{})
+	})
+}
+
+// reloadConfig validates the changed config file and applies the week
+// start, theme and key bindings. Nothing changes if any of it is invalid.
+func (m Model) reloadConfig() (Model, tea.Cmd) {
+	cfg := m.storage.GetConfig()
+
+	next, err := cfg.Reload()
+	var keys KeyMap
+	if err == nil {
+		keys, err = NewKeyMap(next.Keys)
+	}
+	if err == nil {
+		err = colors.CheckOverrides(next.Colors)
+	}
+	if err != nil {
+		m.message = "⚠ Config not reloaded: " + firstProblem(err)
+		return m, clearMessageAfter(m.message, 10*time.Second)
+	}
+
+	restart := cfg.Update(next)
+	m.keys = keys
+	ApplyTheme(cfg)
+	m.calendar.SetWeekStartDay(cfg.WeekStartDay)
+	if m.ready {
+		m = m.rebuildLists()
+	}
+
+	m.message = "✓ Config reloaded"
+	if len(restart) > 0 {
+		m.message += "; restart marcel to apply " + strings.Join(restart, ", ")
+	}
+	return m, clearMessageAfter(m.message, 5*time.Second)
+}
+
+// firstProblem keeps a validation error to its first line, dropping the
+// "invalid config:" heading.
+func firstProblem(err error) string {
+	lines := strings.Split(strings.TrimPrefix(err.Error(), "invalid config:\n"), "\n")
+	if len(lines) > 1 {
+		return lines[0] + " (and more; run marcel config validate)"
+	}
+	return lines[0]
+}
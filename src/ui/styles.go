@@ -2,79 +2,109 @@ package ui
 
 import (
 	"fmt"
+	"marcel-cli/config"
 	"marcel-cli/ui/colors"
 
 	"github.com/charmbracelet/lipgloss"
 )
 
 var (
+	BaseStyle          lipgloss.Style
+	TitleStyle         lipgloss.Style
+	HeaderStyle        lipgloss.Style
+	SelectedItemStyle  lipgloss.Style
+	NormalItemStyle    lipgloss.Style
+	CompletedItemStyle lipgloss.Style
+	MutedStyle         lipgloss.Style
+	ErrorStyle         lipgloss.Style
+	SuccessStyle       lipgloss.Style
+	BoxStyle           lipgloss.Style
+	HelpStyle          lipgloss.Style
+	StatusBarStyle     lipgloss.Style
+	BadgeStyle         lipgloss.Style
+	SpinnerStyle       lipgloss.Style
+	DividerStyle       lipgloss.Style
+)
+
+func init() {
+	buildStyles()
+}
+
+// ApplyTheme switches the TUI to the theme, colour mode and colour
+// overrides from the config.
+func ApplyTheme(cfg *config.Config) error {
+	if err := colors.Apply(cfg.Theme, cfg.ColorMode, cfg.Colors); err != nil {
+		return err
+	}
+	buildStyles()
+	return nil
+}
+
+// buildStyles derives the shared styles from the current colours.
+func buildStyles() {
 	BaseStyle = lipgloss.NewStyle().
-			Foreground(colors.PrimaryText).
-			Background(colors.BackgroundPrimary)
+		Foreground(colors.PrimaryText).
+		Background(colors.BackgroundPrimary)
 
 	TitleStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(colors.BrandOrange).
-			MarginBottom(1).
-			Padding(0, 2)
+		Bold(true).
+		Foreground(colors.Brand).
+		MarginBottom(1).
+		Padding(0, 2)
 
 	HeaderStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(colors.BrandOrange).
-			Background(colors.BackgroundSecondary).
-			Padding(0, 1).
-			MarginBottom(1)
+		Bold(true).
+		Foreground(colors.Brand).
+		Background(colors.BackgroundSecondary).
+		Padding(0, 1).
+		MarginBottom(1)
 
-	SelectedItemStyle = lipgloss.NewStyle().
-				Foreground(colors.BackgroundPrimary).
-				Background(colors.BrandOrange).
-				Bold(true)
+	SelectedItemStyle = colors.Highlight(lipgloss.NewStyle(), colors.Brand).
+		Bold(true)
 
 	NormalItemStyle = lipgloss.NewStyle().
-			Foreground(colors.PrimaryText)
+		Foreground(colors.PrimaryText)
 
 	CompletedItemStyle = lipgloss.NewStyle().
-				Foreground(colors.MutedText).
-				Strikethrough(true).
-				Padding(0, 1)
+		Foreground(colors.MutedText).
+		Strikethrough(true).
+		Padding(0, 1)
 
 	MutedStyle = lipgloss.NewStyle().
-			Foreground(colors.SecondaryText)
+		Foreground(colors.SecondaryText)
 
 	ErrorStyle = lipgloss.NewStyle().
-			Foreground(colors.Red).
-			Bold(true)
+		Foreground(colors.Red).
+		Bold(true)
 
 	SuccessStyle = lipgloss.NewStyle().
-			Foreground(colors.Green).
-			Bold(true)
+		Foreground(colors.Green).
+		Bold(true)
 
 	BoxStyle = lipgloss.NewStyle().
-			Padding(1, 2)
+		Padding(1, 2)
 
 	HelpStyle = lipgloss.NewStyle().
-			Foreground(colors.SecondaryText).
-			MarginTop(1)
+		Foreground(colors.SecondaryText).
+		MarginTop(1)
 
 	StatusBarStyle = lipgloss.NewStyle().
-			Foreground(colors.PrimaryText).
-			Background(colors.BackgroundSecondary).
-			Padding(0, 1)
+		Foreground(colors.PrimaryText).
+		Background(colors.BackgroundSecondary).
+		Padding(0, 1)
 
-	BadgeStyle = lipgloss.NewStyle().
-			Foreground(colors.BackgroundPrimary).
-			Background(colors.BrandOrange).
-			Bold(true).
-			Padding(0, 1).
-			MarginRight(1)
+	BadgeStyle = colors.Highlight(lipgloss.NewStyle(), colors.Brand).
+		Bold(true).
+		Padding(0, 1).
+		MarginRight(1)
 
 	SpinnerStyle = lipgloss.NewStyle().
-			Foreground(colors.BrandOrange)
+		Foreground(colors.Brand)
 
 	DividerStyle = lipgloss.NewStyle().
-			Foreground(colors.BorderColor).
-			Bold(true)
-)
+		Foreground(colors.BorderColor).
+		Bold(true)
+}
 
 func RenderDivider(width int) string {
 	if width <= 0 {
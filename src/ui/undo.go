@@ -0,0 +1,626 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"marcel-cli/api"
+	"marcel-cli/models"
+	"marcel-cli/storage"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// undoStep replays one change against the backend. Like any other change it
+// shows in m.data right away; finish runs once the server has answered,
+// after a failed step has been rolled back.
+type undoStep func(m Model, finish func(m Model, err error) (Model, tea.Cmd)) (Model, tea.Cmd)
+
+// change is a finished change the user can take back: what it did, in
+// words, and the steps that undo and redo it.
+type change struct {
+	desc string
+	undo undoStep
+	redo undoStep
+}
+
+// undoStack holds the changes that undo and redo walk through. Undoing a
+// delete creates the item again under a new ID; renamed maps old IDs to new
+// ones so older changes still find the item.
+type undoStack struct {
+	done    []change
+	undone  []change
+	renamed map[pendingKey]int
+}
+
+func newUndoStack() *undoStack {
+	return &undoStack{renamed: map[pendingKey]int{}}
+}
+
+// record adds a change the user just made. It makes the changes that were
+// undone before it impossible to redo.
+func (u *undoStack) record(c change) {
+	u.done = append(u.done, c)
+	u.undone = nil
+}
+
+func (u *undoStack) resolve(kind string, id int) int {
+	for {
+		next, ok := u.renamed[pendingKey{kind, id}]
+		if !ok {
+			return id
+		}
+		id = next
+	}
+}
+
+func (u *undoStack) rename(kind string, from, to int) {
+	if from != to {
+		u.renamed[pendingKey{kind, from}] = to
+	}
+}
+
+func (m Model) undoChange() (Model, tea.Cmd) {
+	return m.replay(&m.undo.done, &m.undo.undone, "undo", "Undid")
+}
+
+func (m Model) redoChange() (Model, tea.Cmd) {
+	return m.replay(&m.undo.undone, &m.undo.done, "redo", "Redid")
+}
+
+// replay takes the latest change off one stack, runs its undo or redo step
+// and, once that worked, puts it on the other. A change that failed goes
+// back for another try, unless trying again cannot help. Changes still
+// being saved have to finish first, so the order on the server matches the
+// stack.
+func (m Model) replay(from, to *[]change, verb, past string) (Model, tea.Cmd) {
+	if m.saving > 0 {
+		m.message = fmt.Sprintf("Still saving; %s once it is done", verb)
+		return m, nil
+	}
+	if len(*from) == 0 {
+		m.message = "Nothing to " + verb
+		return m, clearMessageAfter(m.message, 2*time.Second)
+	}
+
+	c := (*from)[len(*from)-1]
+	*from = (*from)[:len(*from)-1]
+
+	step := c.undo
+	if verb == "redo" {
+		step = c.redo
+	}
+	m.message = fmt.Sprintf("%s: %s...", past, c.desc)
+	return step(m, func(m Model, err error) (Model, tea.Cmd) {
+		if err != nil && isFinal(err) {
+			m.message = fmt.Sprintf("Cannot %s %s: %v", verb, c.desc, err)
+			return m, clearMessageAfter(m.message, 10*time.Second)
+		}
+		if err != nil {
+			*from = append(*from, c)
+			m.message = fmt.Sprintf("Failed to %s %s: %v", verb, c.desc, err)
+			return m, clearMessageAfter(m.message, 10*time.Second)
+		}
+		*to = append(*to, c)
+		m.message = fmt.Sprintf("✓ %s: %s", past, c.desc)
+		return m, clearMessageAfter(m.message, 3*time.Second)
+	})
+}
+
+func findQuest(data *models.AppData, id int) (models.Quest, bool) {
+	for _, j := range data.Journeys {
+		for _, q := range j.Quests {
+			if q.ID == id {
+				return q, true
+			}
+		}
+	}
+	return models.Quest{}, false
+}
+
+func findHabit(data *models.AppData, id int) (models.Habit, bool) {
+	for _, h := range data.Habits {
+		if h.ID == id {
+			return h, true
+		}
+	}
+	return models.Habit{}, false
+}
+
+func findJourney(data *models.AppData, id int) (models.Journey, bool) {
+	for _, j := range data.Journeys {
+		if j.ID == id {
+			return j, true
+		}
+	}
+	return models.Journey{}, false
+}
+
+func findEvent(data *models.AppData, id int) (models.Event, bool) {
+	for _, e := range data.Events {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return models.Event{}, false
+}
+
+// finalError is a step error that trying again cannot fix.
+type finalError struct {
+	error
+}
+
+func isFinal(err error) bool {
+	var final finalError
+	return errors.As(err, &final)
+}
+
+// errGone is what a step reports when its item is no longer there, say
+// because a sync removed it.
+func errGone(kind string) error {
+	return finalError{fmt.Errorf("the %s no longer exists", kind)}
+}
+
+// runAll starts steps side by side. finish runs once every one of them has,
+// with each step's error at its index.
+func (m Model) runAll(steps []undoStep, finish func(m Model, errs []error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+	errs := make([]error, len(steps))
+	left := len(steps)
+	if left == 0 {
+		return finish(m, errs)
+	}
+
+	var cmds []tea.Cmd
+	for i, step := range steps {
+		var cmd tea.Cmd
+		m, cmd = step(m, func(m Model, err error) (Model, tea.Cmd) {
+			errs[i] = err
+			left--
+			if left > 0 {
+				return m, nil
+			}
+			return finish(m, errs)
+		})
+		cmds = append(cmds, cmd)
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// allSteps makes one step of several, as for a bulk action. It fails if any
+// of them did; the others stay done, and running it again only retries the
+// ones that can still work. Once all are through, the next run, the other
+// way round and back, starts over.
+func allSteps(steps []undoStep) undoStep {
+	done := make([]bool, len(steps))
+	return func(m Model, finish func(Model, error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+		var left []undoStep
+		var at []int
+		for i, step := range steps {
+			if !done[i] {
+				left = append(left, step)
+				at = append(at, i)
+			}
+		}
+		return m.runAll(left, func(m Model, errs []error) (Model, tea.Cmd) {
+			for j, err := range errs {
+				done[at[j]] = err == nil || isFinal(err)
+			}
+			err := stepsError(errs)
+			if !slices.Contains(done, false) {
+				clear(done)
+			}
+			return finish(m, err)
+		})
+	}
+}
+
+// stepsError sums up the errors of several steps in one line. It is final
+// only if every failed step was.
+func stepsError(errs []error) error {
+	var first error
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+			if first == nil || isFinal(first) && !isFinal(err) {
+				first = err
+			}
+		}
+	}
+	if failed == 0 || len(errs) == 1 {
+		return first
+	}
+	err := fmt.Errorf("%d of %d failed: %w", failed, len(errs), first)
+	if isFinal(first) {
+		return finalError{err}
+	}
+	return err
+}
+
+func questDoneStep(id int, done bool) undoStep {
+	return func(m Model, finish func(Model, error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+		id := m.undo.resolve("quest", id)
+		quest, ok := findQuest(m.data, id)
+		if !ok {
+			return finish(m, errGone("quest"))
+		}
+		restore := keepQuest(m.data, id)
+		quest.Done = done
+		putQuest(m.data, quest)
+
+		s := m.storage
+		return m.mutate(pendingKey{"quest", id}, func() func(Model) (Model, tea.Cmd) {
+			updated, err := s.ToggleQuest(id, done)
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					restore(m.data)
+				} else {
+					putQuest(m.data, *updated)
+				}
+				return finish(m, err)
+			}
+		})
+	}
+}
+
+func habitDoneStep(id int, done bool) undoStep {
+	return func(m Model, finish func(Model, error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+		id := m.undo.resolve("habit", id)
+		if _, ok := findHabit(m.data, id); !ok {
+			return finish(m, errGone("habit"))
+		}
+
+		s := m.storage
+		return m.mutate(pendingKey{"habit", id}, func() func(Model) (Model, tea.Cmd) {
+			updated, err := s.ToggleHabit(id, done)
+			return func(m Model) (Model, tea.Cmd) {
+				if err == nil {
+					putHabit(m.data, *updated)
+				}
+				return finish(m, err)
+			}
+		})
+	}
+}
+
+// questFieldsStep sets a quest's title, note and difficulty to the ones in
+// fields.
+func questFieldsStep(id int, fields models.Quest) undoStep {
+	return func(m Model, finish func(Model, error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+		id := m.undo.resolve("quest", id)
+		quest, ok := findQuest(m.data, id)
+		if !ok {
+			return finish(m, errGone("quest"))
+		}
+		restore := keepQuest(m.data, id)
+		quest.Title, quest.Note, quest.Difficulty = fields.Title, fields.Note, fields.Difficulty
+		putQuest(m.data, quest)
+
+		s := m.storage
+		return m.mutate(pendingKey{"quest", id}, func() func(Model) (Model, tea.Cmd) {
+			updated, err := s.UpdateQuest(id, api.UpdateQuestRequest{
+				Title:      &fields.Title,
+				Note:       &fields.Note,
+				Difficulty: &fields.Difficulty,
+			})
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					restore(m.data)
+				} else {
+					putQuest(m.data, *updated)
+				}
+				return finish(m, err)
+			}
+		})
+	}
+}
+
+// questJourneyStep moves a quest to a journey. The API has no way to take
+// a quest out of its journey, so there is no step back to My Quests.
+func questJourneyStep(id, journeyID int) undoStep {
+	return func(m Model, finish func(Model, error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+		id := m.undo.resolve("quest", id)
+		quest, ok := findQuest(m.data, id)
+		if !ok {
+			return finish(m, errGone("quest"))
+		}
+		journeyID = m.undo.resolve("journey", journeyID)
+		if _, ok := findJourney(m.data, journeyID); !ok {
+			return finish(m, errGone("journey"))
+		}
+		quest.JourneyID = &journeyID
+		restore := keepQuest(m.data, id)
+		putQuest(m.data, quest)
+
+		s := m.storage
+		return m.mutate(pendingKey{"quest", id}, func() func(Model) (Model, tea.Cmd) {
+			updated, err := s.UpdateQuest(id, api.UpdateQuestRequest{JourneyID: &journeyID})
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					restore(m.data)
+				} else {
+					putQuest(m.data, *updated)
+				}
+				return finish(m, err)
+			}
+		})
+	}
+}
+
+func habitFieldsStep(id int, fields models.Habit) undoStep {
+	return func(m Model, finish func(Model, error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+		id := m.undo.resolve("habit", id)
+		habit, ok := findHabit(m.data, id)
+		if !ok {
+			return finish(m, errGone("habit"))
+		}
+		restore := keepHabit(m.data, id)
+		habit.Name, habit.CycleType, habit.CycleConfig = fields.Name, fields.CycleType, fields.CycleConfig
+		putHabit(m.data, habit)
+
+		s := m.storage
+		return m.mutate(pendingKey{"habit", id}, func() func(Model) (Model, tea.Cmd) {
+			updated, err := s.UpdateHabit(id, api.UpdateHabitRequest{
+				Name:        &fields.Name,
+				CycleType:   &fields.CycleType,
+				CycleConfig: fields.CycleConfig,
+			})
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					restore(m.data)
+				} else {
+					putHabit(m.data, *updated)
+				}
+				return finish(m, err)
+			}
+		})
+	}
+}
+
+func journeyNameStep(id int, name string) undoStep {
+	return func(m Model, finish func(Model, error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+		id := m.undo.resolve("journey", id)
+		journey, ok := findJourney(m.data, id)
+		if !ok {
+			return finish(m, errGone("journey"))
+		}
+		restore := keepJourney(m.data, id)
+		journey.Name = name
+		putJourney(m.data, journey)
+
+		s := m.storage
+		return m.mutate(pendingKey{"journey", id}, func() func(Model) (Model, tea.Cmd) {
+			updated, err := s.UpdateJourney(id, api.UpdateJourneyRequest{Name: &name})
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					restore(m.data)
+				} else {
+					putJourney(m.data, *updated)
+				}
+				return finish(m, err)
+			}
+		})
+	}
+}
+
+func eventFieldsStep(id int, fields models.Event) undoStep {
+	return func(m Model, finish func(Model, error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+		id := m.undo.resolve("event", id)
+		if _, ok := findEvent(m.data, id); !ok {
+			return finish(m, errGone("event"))
+		}
+		restore := keepEvent(m.data, id)
+		fields.ID = id
+		putEvent(m.data, fields)
+
+		req := eventRequest(fields)
+		s := m.storage
+		return m.mutate(pendingKey{"event", id}, func() func(Model) (Model, tea.Cmd) {
+			updated, err := s.UpdateEvent(id, api.UpdateEventRequest{
+				Title:       &req.Title,
+				Date:        &req.Date,
+				EndDate:     req.EndDate,
+				Time:        req.Time,
+				EndTime:     req.EndTime,
+				Location:    req.Location,
+				Description: req.Description,
+			})
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					restore(m.data)
+				} else {
+					putEvent(m.data, *updated)
+				}
+				return finish(m, err)
+			}
+		})
+	}
+}
+
+func eventRequest(e models.Event) api.CreateEventRequest {
+	req := api.CreateEventRequest{
+		Title:       e.Title,
+		Date:        e.Date.Format("2006-01-02"),
+		Time:        e.Time,
+		EndTime:     e.EndTime,
+		Location:    e.Location,
+		Description: e.Description,
+	}
+	if e.EndDate != nil {
+		endDate := e.EndDate.Format("2006-01-02")
+		req.EndDate = &endDate
+	}
+	return req
+}
+
+// deleteStep deletes a quest, habit, journey or event.
+func deleteStep(kind string, id int) undoStep {
+	return func(m Model, finish func(Model, error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+		id := m.undo.resolve(kind, id)
+
+		var found bool
+		var restore func(*models.AppData)
+		var request func() error
+		s := m.storage
+		switch kind {
+		case "quest":
+			_, found = findQuest(m.data, id)
+			restore = keepQuest(m.data, id)
+			removeQuest(m.data, id)
+			request = func() error { return s.DeleteQuest(id) }
+		case "habit":
+			_, found = findHabit(m.data, id)
+			restore = keepHabit(m.data, id)
+			removeHabit(m.data, id)
+			request = func() error { return s.DeleteHabit(id) }
+		case "journey":
+			_, found = findJourney(m.data, id)
+			restore = keepJourney(m.data, id)
+			removeJourney(m.data, id)
+			request = func() error { return s.DeleteJourney(id) }
+		case "event":
+			_, found = findEvent(m.data, id)
+			restore = keepEvent(m.data, id)
+			removeEvent(m.data, id)
+			request = func() error { return s.DeleteEvent(id) }
+		}
+		if !found {
+			return finish(m, errGone(kind))
+		}
+
+		return m.mutate(pendingKey{kind, id}, func() func(Model) (Model, tea.Cmd) {
+			err := request()
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					restore(m.data)
+				}
+				return finish(m, err)
+			}
+		})
+	}
+}
+
+// createQuestStep creates a quest again with its note, difficulty, journey
+// and done state.
+func createQuestStep(quest models.Quest) undoStep {
+	return func(m Model, finish func(Model, error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+		journeyID := quest.JourneyID
+		if journeyID != nil {
+			resolved := m.undo.resolve("journey", *journeyID)
+			journeyID = &resolved
+		}
+
+		s := m.storage
+		return m.mutate(pendingKey{kind: "quest"}, func() func(Model) (Model, tea.Cmd) {
+			created, err := recreateQuest(s, quest, journeyID)
+			return func(m Model) (Model, tea.Cmd) {
+				if err == nil {
+					m.undo.rename("quest", quest.ID, created.ID)
+					putQuest(m.data, *created)
+				}
+				return finish(m, err)
+			}
+		})
+	}
+}
+
+func recreateQuest(s storage.QuestStore, quest models.Quest, journeyID *int) (*models.Quest, error) {
+	created, err := s.CreateQuest(quest.Title, quest.Note, quest.Difficulty, journeyID)
+	if err != nil || !quest.Done {
+		return created, err
+	}
+	if done, err := s.ToggleQuest(created.ID, true); err == nil {
+		return done, nil
+	}
+	created.Done = false
+	return created, nil
+}
+
+func createHabitStep(habit models.Habit) undoStep {
+	return func(m Model, finish func(Model, error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+		s := m.storage
+		return m.mutate(pendingKey{kind: "habit"}, func() func(Model) (Model, tea.Cmd) {
+			created, err := s.CreateHabit(habit.Name, habit.CycleType, habit.CycleConfig)
+			return func(m Model) (Model, tea.Cmd) {
+				if err == nil {
+					m.undo.rename("habit", habit.ID, created.ID)
+					putHabit(m.data, *created)
+				}
+				return finish(m, err)
+			}
+		})
+	}
+}
+
+// createJourneyStep creates a journey again together with the quests that
+// went with it. Quests the backend kept when the journey was deleted, as
+// the local backend does, are still in m.data and are moved back rather
+// than duplicated. The journey counts as restored even if some of its
+// quests could not be.
+func createJourneyStep(journey models.Journey) undoStep {
+	return func(m Model, finish func(Model, error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+		kept := map[int]bool{}
+		for _, quest := range journey.Quests {
+			_, kept[quest.ID] = findQuest(m.data, quest.ID)
+		}
+
+		s := m.storage
+		return m.mutate(pendingKey{kind: "journey"}, func() func(Model) (Model, tea.Cmd) {
+			created, err := s.CreateJourney(journey.Name)
+			recreated := map[int]models.Quest{}
+			failed := 0
+			if err == nil {
+				for _, quest := range journey.Quests {
+					var q *models.Quest
+					var err error
+					if kept[quest.ID] {
+						q, err = s.UpdateQuest(quest.ID, api.UpdateQuestRequest{JourneyID: &created.ID})
+					} else {
+						q, err = recreateQuest(s, quest, &created.ID)
+					}
+					if err != nil {
+						failed++
+						continue
+					}
+					recreated[quest.ID] = *q
+				}
+			}
+			return func(m Model) (Model, tea.Cmd) {
+				if err != nil {
+					return finish(m, err)
+				}
+				m.undo.rename("journey", journey.ID, created.ID)
+				putJourney(m.data, *created)
+				for id, q := range recreated {
+					m.undo.rename("quest", id, q.ID)
+					putQuest(m.data, q)
+				}
+
+				m, cmd := finish(m, nil)
+				if failed > 0 {
+					m.message += fmt.Sprintf(" (%d of its quests could not be restored)", failed)
+					cmd = clearMessageAfter(m.message, 10*time.Second)
+				}
+				return m, cmd
+			}
+		})
+	}
+}
+
+func createEventStep(event models.Event) undoStep {
+	return func(m Model, finish func(Model, error) (Model, tea.Cmd)) (Model, tea.Cmd) {
+		s := m.storage
+		return m.mutate(pendingKey{kind: "event"}, func() func(Model) (Model, tea.Cmd) {
+			created, err := s.CreateEvent(eventRequest(event))
+			return func(m Model) (Model, tea.Cmd) {
+				if err == nil {
+					m.undo.rename("event", event.ID, created.ID)
+					putEvent(m.data, *created)
+				}
+				return finish(m, err)
+			}
+		})
+	}
+}
@@ -1,9 +1,14 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
-	"marcel-cli/models"
 	"time"
+	"unicode"
+
+	"marcel-cli/api"
+	"marcel-cli/models"
+	"marcel-cli/storage"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
@@ -17,9 +22,19 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		cmds = append(cmds, tea.ClearScreen)
 	}
 
-	if m.mode == QuestFormView || m.mode == JourneyFormView || m.mode == HabitFormView || m.mode == EventFormView ||
-		m.mode == QuestEditFormView || m.mode == JourneyEditFormView || m.mode == HabitEditFormView || m.mode == EventEditFormView {
-		return m.handleFormUpdate(msg)
+	switch msg.(type) {
+	case autoSyncMsg, backgroundSyncMsg, cacheChangedMsg, configChangedMsg, mutationDoneMsg, syncClockMsg:
+		// Syncing, saves and config reloads carry on underneath open forms;
+		// only the lists and styles change.
+	default:
+		if m.mode == QuestFormView || m.mode == JourneyFormView || m.mode == HabitFormView || m.mode == EventFormView ||
+			m.mode == QuestEditFormView || m.mode == JourneyEditFormView || m.mode == HabitEditFormView || m.mode == EventEditFormView ||
+			m.mode == BulkEditFormView {
+			return m.handleFormUpdate(msg)
+		}
+		if _, resize := msg.(tea.WindowSizeMsg); m.mode == LoginView && !resize {
+			return m.handleLoginUpdate(msg)
+		}
 	}
 
 	switch msg := msg.(type) {
@@ -28,9 +43,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 
 		if !m.ready {
-			m.questList = newQuestList(m.data, m.width-4, m.height-10)
-			m.habitList = newHabitList(m.data, m.width-4, m.height-10)
-			m.journeyList = newJourneyList(m.data, m.width-4, m.height-10)
+			m.questList = newQuestList(m.data, m.pending, m.marks, m.views["quests"], m.width-4, m.height-10)
+			m.habitList = newHabitList(m.data, m.pending, m.marks, m.width-4, m.height-10)
+			m.journeyList = newJourneyList(m.data, m.pending, m.width-4, m.height-10)
 			m.calendar.SetSize(m.width-4, m.height-10)
 			m.calendar.SetEvents(m.data.Events)
 			m.ready = true
@@ -62,6 +77,10 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.handleHelpKeys(msg)
 		case ConfirmDeleteView:
 			return m.handleConfirmDeleteKeys(msg)
+		case ConflictView:
+			return m.handleConflictKeys(msg)
+		case HistoryView:
+			return m.handleHistoryKeys(msg)
 		}
 
 	case spinner.TickMsg:
@@ -76,58 +95,108 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 	case dataLoadedMsg:
-		if msg.err != nil {
+		var cmd tea.Cmd
+		m, cmd, msg.err = m.reportRejected(msg.err)
+		cmds = append(cmds, cmd)
+		if msg.refresh {
+			m = m.finishRefresh(msg)
+		} else if msg.err != nil {
 			cmds = append(cmds, checkAuthCmd(m.storage))
 		} else {
 			m.data = msg.data
 			m.mode = QuestListView
 			m.currentSection = msg.data.CurrentSection
-			m.questList = newQuestList(m.data, m.width-4, m.height-10)
-			m.habitList = newHabitList(m.data, m.width-4, m.height-10)
-			m.journeyList = newJourneyList(m.data, m.width-4, m.height-10)
+			m.questList = newQuestList(m.data, m.pending, m.marks, m.views["quests"], m.width-4, m.height-10)
+			m.habitList = newHabitList(m.data, m.pending, m.marks, m.width-4, m.height-10)
+			m.journeyList = newJourneyList(m.data, m.pending, m.width-4, m.height-10)
 			m.calendar.SetEvents(m.data.Events)
+			if synced, err := m.storage.CacheTimestamp(); err == nil {
+				m.lastSynced = synced
+			}
 			m.syncStatus = SyncStatusSyncing
 			cmds = append(cmds, backgroundSyncCmd(m.storage), m.syncSpinner.Tick)
 		}
 
 	case authCheckMsg:
-		if msg.err != nil {
-			m.mode = ErrorView
-			m.errorMessage = fmt.Sprintf("Authentication failed: %v\n\nSet your token in ~/.marcel.token or MARCEL_TOKEN environment variable", msg.err)
+		if errors.Is(msg.err, api.ErrOffline) {
+			// Keep showing the cache; auto sync retries once the server is
+			// back. Without one there is nothing to show.
+			m.syncStatus = SyncStatusError
+			if m.mode == LoadingView {
+				m.mode = ErrorView
+				m.errorMessage = fmt.Sprintf("Failed to load data: %v", msg.err)
+			}
+		} else if msg.err != nil {
+			return m.showLogin(fmt.Sprintf("Authentication failed: %v", msg.err))
 		} else {
 			m.syncStatus = SyncStatusSyncing
 			cmds = append(cmds, backgroundSyncCmd(m.storage), m.syncSpinner.Tick)
 		}
 
+	case autoSyncMsg:
+		if m.syncStatus == SyncStatusSyncing || m.mode == LoadingView {
+			cmds = append(cmds, m.scheduleAutoSync())
+		} else {
+			cmds = append(cmds, autoSyncCmd(m.storage))
+		}
+
 	case backgroundSyncMsg:
+		var cmd tea.Cmd
+		m, cmd, msg.err = m.reportRejected(msg.err)
+		cmds = append(cmds, cmd)
 		if msg.err != nil {
+			m.syncFailures++
 			m.syncStatus = SyncStatusError
 			if m.mode == LoadingView {
 				m.mode = ErrorView
 				m.errorMessage = fmt.Sprintf("Failed to load data: %v", msg.err)
 			}
 		} else {
-			m.data = msg.data
-			m.syncStatus = SyncStatusSynced
+			m.syncFailures = 0
+			m.lastSynced = time.Now()
 			if m.mode == LoadingView {
 				m.mode = QuestListView
 				m.currentSection = msg.data.CurrentSection
+				m.data = msg.data
+				m = m.rebuildLists()
+			} else {
+				m = m.replaceData(msg.data)
 			}
-			m.questList = newQuestList(m.data, m.width-4, m.height-10)
-			m.habitList = newHabitList(m.data, m.width-4, m.height-10)
-			m.journeyList = newJourneyList(m.data, m.width-4, m.height-10)
-			m.calendar.SetEvents(m.data.Events)
-
-			var allQuests []models.Quest
-			for _, journey := range m.data.Journeys {
-				allQuests = append(allQuests, journey.Quests...)
+			if msg.auto {
+				if m.syncStatus == SyncStatusError {
+					m.syncStatus = SyncStatusNone
+				}
+			} else {
+				m.syncStatus = SyncStatusSynced
+				cmds = append(cmds, clearSyncStatusAfter(3*time.Second))
 			}
-			m.storage.SaveToCache(m.data.Journeys, allQuests, m.data.Habits, m.data.Events)
-			cmds = append(cmds, clearSyncStatusAfter(3*time.Second))
 		}
+		if msg.auto {
+			cmds = append(cmds, m.scheduleAutoSync())
+		}
+
+	case cacheChangedMsg:
+		if data, err := m.storage.LoadFromCache(); err == nil && m.mode != LoadingView {
+			m = m.replaceData(data)
+		}
+
+	case mutationDoneMsg:
+		var cmd tea.Cmd
+		m, cmd = m.finishMutation(msg)
+		cmds = append(cmds, cmd)
+
+	case configChangedMsg:
+		var cmd tea.Cmd
+		m, cmd = m.reloadConfig()
+		cmds = append(cmds, cmd)
+
+	case syncClockMsg:
+		cmds = append(cmds, tickSyncClock())
 
 	case clearMessageMsg:
-		m.message = ""
+		if m.message == msg.message {
+			m.message = ""
+		}
 
 	case clearSyncStatusMsg:
 		m.syncStatus = SyncStatusNone
@@ -135,3 +204,34 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	return m, tea.Batch(cmds...)
 }
+
+// replaceData shows data from a sync or another process. While changes are
+// still saving it may predate them and would wipe their optimistic values,
+// so it waits until the last one is done and the cache has them.
+func (m Model) replaceData(data *models.AppData) Model {
+	if m.saving > 0 {
+		m.staleData = true
+		return m
+	}
+	m.data = data
+	return m.rebuildLists()
+}
+
+// reportRejected shows offline changes the server refused. A sync reports
+// them next to data that is still good, so only other errors are returned.
+func (m Model) reportRejected(err error) (Model, tea.Cmd, error) {
+	var rejected *storage.RejectedError
+	if !errors.As(err, &rejected) {
+		return m, nil, err
+	}
+	m.message = capitalize(rejected.Error()) + " (marcel cache inspect lists it)"
+	return m, clearMessageAfter(m.message, 10*time.Second), nil
+}
+
+func capitalize(s string) string {
+	r := []rune(s)
+	if len(r) > 0 {
+		r[0] = unicode.ToUpper(r[0])
+	}
+	return string(r)
+}
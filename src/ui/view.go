@@ -2,15 +2,17 @@ package ui
 
 import (
 	"fmt"
+	"marcel-cli/config"
 	"marcel-cli/ui/colors"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/lipgloss"
 )
 
 func (m Model) View() string {
-	if !m.ready && m.mode != ErrorView {
+	if !m.ready && m.mode != ErrorView && m.mode != LoginView {
 		return m.renderLoadingView()
 	}
 
@@ -43,6 +45,14 @@ func (m Model) View() string {
 		return m.renderFormView(m.habitForm)
 	case EventEditFormView:
 		return m.renderFormView(m.eventForm)
+	case BulkEditFormView:
+		return m.renderFormView(m.bulkForm)
+	case ConflictView:
+		return m.renderConflictView()
+	case HistoryView:
+		return m.renderHistoryView()
+	case LoginView:
+		return m.renderLoginView()
 	}
 
 	return ""
@@ -56,23 +66,23 @@ func (m Model) renderQuestListView() string {
 
 	switch m.currentSection {
 	case "quests":
-		headerText = "Marcel - Quests"
+		headerText = fmt.Sprintf("Quests (%d)", questCount(m.questList)) + m.views["quests"].label() + m.selectionLabel(m.questList, "quests")
 		content = m.questList.View()
 	case "habits":
-		headerText = "Marcel - Habits"
+		headerText = "Habits" + m.selectionLabel(m.habitList, "habits")
 		content = m.habitList.View()
 	case "journeys":
-		headerText = "Marcel - Journeys"
+		headerText = "Journeys"
 		content = m.journeyList.View()
 	case "calendar":
-		headerText = "Marcel - Calendar"
+		headerText = "Calendar"
 		content = m.calendar.View()
 	default:
-		headerText = "Marcel - Quests"
+		headerText = "Quests"
 		content = m.questList.View()
 	}
 
-	header := HeaderStyle.Width(m.width).Render(headerText)
+	header := HeaderStyle.Width(m.width).Render(m.headerTitle(headerText))
 
 	statusBars := []string{}
 	if m.message != "" {
@@ -123,13 +133,13 @@ func renderTabs(currentSection string, width int) string {
 
 	switch currentSection {
 	case "quests":
-		questStyle = questStyle.Foreground(colors.BrandOrange).Bold(true).Background(colors.BackgroundSecondary)
+		questStyle = questStyle.Foreground(colors.Brand).Bold(true).Background(colors.BackgroundSecondary)
 	case "habits":
-		habitStyle = habitStyle.Foreground(colors.BrandOrange).Bold(true).Background(colors.BackgroundSecondary)
+		habitStyle = habitStyle.Foreground(colors.Brand).Bold(true).Background(colors.BackgroundSecondary)
 	case "journeys":
-		journeyStyle = journeyStyle.Foreground(colors.BrandOrange).Bold(true).Background(colors.BackgroundSecondary)
+		journeyStyle = journeyStyle.Foreground(colors.Brand).Bold(true).Background(colors.BackgroundSecondary)
 	case "calendar":
-		calendarStyle = calendarStyle.Foreground(colors.BrandOrange).Bold(true).Background(colors.BackgroundSecondary)
+		calendarStyle = calendarStyle.Foreground(colors.Brand).Bold(true).Background(colors.BackgroundSecondary)
 	}
 
 	tabs := lipgloss.JoinHorizontal(
@@ -159,6 +169,32 @@ func (m Model) renderLoadingView() string {
 	)
 }
 
+func (m Model) renderLoginView() string {
+	title := TitleStyle.Render("Welcome to Marcel")
+	intro := MutedStyle.Render("Paste a CLI token to sign in, or run marcel login.")
+
+	var body string
+	if m.loggingIn {
+		body = lipgloss.JoinHorizontal(lipgloss.Left, m.spinner.View(), " Checking token...")
+	} else {
+		body = m.loginForm.View()
+	}
+
+	parts := []string{title, "", intro, "", body}
+	if m.loginError != "" {
+		parts = append(parts, "", ErrorStyle.Render(m.loginError))
+	}
+	parts = append(parts, "", HelpStyle.Render("enter - log in  •  esc - quit  •  set backend: local to use marcel without an account"))
+
+	return lipgloss.Place(
+		m.width,
+		m.height,
+		lipgloss.Center,
+		lipgloss.Center,
+		BoxStyle.Render(lipgloss.JoinVertical(lipgloss.Left, parts...)),
+	)
+}
+
 func (m Model) renderErrorView() string {
 	title := ErrorStyle.Render("⚠ Error")
 
@@ -167,7 +203,7 @@ func (m Model) renderErrorView() string {
 		Padding(1, 2).
 		Render(m.errorMessage)
 
-	help := HelpStyle.Render("r - retry  •  q - quit")
+	help := HelpStyle.Render(hints(hint("Retry", m.keys.Refresh), hint("Quit", m.keys.Quit)))
 
 	box := BoxStyle.Render(
 		lipgloss.JoinVertical(
@@ -192,38 +228,17 @@ func (m Model) renderErrorView() string {
 func (m Model) renderHelpView() string {
 	title := TitleStyle.Render("Help & Keyboard Shortcuts")
 
-	helpContent := `
-Navigation:
-  ↑/k, ↓/j     Navigate quests
-  /            Filter quests
-  gg           Jump to top
-  G            Jump to bottom
-
-Actions:
-  space/enter  Toggle quest completion
-  n            Create new quest
-  d            Delete quest
-  r            Refresh quests from server
-
-Other:
-  ?            Show/hide help
-  q, Ctrl+C    Quit
-
+	helpContent := "\n" + m.keys.HelpText() + `
 Configuration:
-  Environment variable:
-    MARCEL_TOKEN           - Your Marcel CLI token
-
-  Config file (~/.marcel.yml):
-    week_start_day: sunday
+  Config file: ~/.config/marcel/config.yml (marcel paths shows the others)
+  marcel config list shows every setting; rebind keys under keys:,
+  e.g. toggle: [x, space]
 
 Authentication:
-  1. Go to Marcel web app settings
-  2. Generate a Marcel CLI token
-  3. Copy the token
-  4. Set MARCEL_TOKEN environment variable
+  Run marcel login, or set token_command in the config file
 `
 
-	footer := HelpStyle.Render("\nPress ? or Esc to return")
+	footer := HelpStyle.Render("\n" + hints(hint("Return", m.keys.Help, m.keys.Back)))
 
 	box := BoxStyle.Width(m.width - 8).Render(
 		lipgloss.JoinVertical(
@@ -258,6 +273,20 @@ func (m Model) renderConfirmDeleteView() string {
 	} else if m.confirmEvent != nil {
 		title = "Delete Event?"
 		itemName = m.confirmEvent.Title
+	} else if len(m.confirmQuests) > 0 {
+		title = fmt.Sprintf("Delete %s?", countNoun(len(m.confirmQuests), "Quest"))
+		var names []string
+		for _, q := range m.confirmQuests {
+			names = append(names, q.Title)
+		}
+		itemName = confirmNames(names)
+	} else if len(m.confirmHabits) > 0 {
+		title = fmt.Sprintf("Delete %s?", countNoun(len(m.confirmHabits), "Habit"))
+		var names []string
+		for _, h := range m.confirmHabits {
+			names = append(names, h.Name)
+		}
+		itemName = confirmNames(names)
 	} else {
 		return ""
 	}
@@ -280,9 +309,9 @@ func (m Model) renderConfirmDeleteView() string {
 		Padding(0, 2)
 
 	if !m.confirmSelected {
-		noStyle = noStyle.Background(colors.BrandOrange).Bold(true)
+		noStyle = colors.Highlight(noStyle, colors.Brand).Bold(true)
 	} else {
-		yesStyle = yesStyle.Background(colors.Red).Bold(true)
+		yesStyle = colors.Highlight(yesStyle, colors.Red).Bold(true)
 	}
 
 	buttons := lipgloss.JoinHorizontal(
@@ -300,7 +329,7 @@ func (m Model) renderConfirmDeleteView() string {
 		"",
 		buttons,
 		"",
-		MutedStyle.Render("←/h: No  →/l: Yes  Enter: Confirm  Esc: Cancel"),
+		MutedStyle.Render(hints(hint("No", m.keys.Left), hint("Yes", m.keys.Right), hint("Confirm", m.keys.Confirm), hint("Cancel", m.keys.Back))),
 	)
 
 	box := BoxStyle.Render(content)
@@ -314,6 +343,125 @@ func (m Model) renderConfirmDeleteView() string {
 	)
 }
 
+func (m Model) renderConflictView() string {
+	if m.conflict == nil {
+		return ""
+	}
+
+	title := lipgloss.NewStyle().
+		Foreground(colors.Red).
+		Bold(true).
+		Render("Quest changed elsewhere")
+
+	subtitle := MutedStyle.Render(fmt.Sprintf("%q was updated at %s while you were editing it",
+		m.conflict.remote.Title, m.conflict.remote.UpdatedAt.Local().Format("15:04:05")))
+
+	valueWidth := m.width - 24
+	if valueWidth < 20 {
+		valueWidth = 20
+	}
+	truncate := func(v string) string {
+		v = strings.ReplaceAll(v, "\n", " ")
+		if v == "" {
+			return "(empty)"
+		}
+		if len([]rune(v)) > valueWidth {
+			return string([]rune(v)[:valueWidth-1]) + "…"
+		}
+		return v
+	}
+
+	rows := []string{}
+	for i, f := range m.conflict.fields {
+		nameStyle := lipgloss.NewStyle().Foreground(colors.PrimaryText).Bold(true)
+		if f.clashes() {
+			nameStyle = nameStyle.Foreground(colors.Red)
+		}
+
+		cursor := "  "
+		if i == m.conflict.cursor {
+			cursor = lipgloss.NewStyle().Foreground(colors.Brand).Render("> ")
+		}
+
+		mineStyle := MutedStyle
+		theirsStyle := MutedStyle
+		if f.choice == keepMine {
+			mineStyle = lipgloss.NewStyle().Foreground(colors.Brand).Bold(true)
+		} else {
+			theirsStyle = lipgloss.NewStyle().Foreground(colors.Brand).Bold(true)
+		}
+
+		rows = append(rows,
+			cursor+nameStyle.Render(f.name),
+			"    "+MutedStyle.Render("base:   "+truncate(f.base)),
+			"    "+mineStyle.Render("mine:   "+truncate(f.mine)),
+			"    "+theirsStyle.Render("theirs: "+truncate(f.theirs)),
+			"",
+		)
+	}
+
+	content := lipgloss.JoinVertical(
+		lipgloss.Left,
+		append([]string{title, subtitle, ""}, append(rows,
+			MutedStyle.Render(hints(hint("Field", m.keys.Up, m.keys.Down), hint("Mine/Theirs", m.keys.Left, m.keys.Right), hint("Swap", m.keys.Switch), hint("Apply merge", m.keys.Confirm))),
+			MutedStyle.Render(hints(hint("Keep all mine", m.keys.AllMine), hint("Keep all theirs", m.keys.AllTheirs), hint("Discard my edit", m.keys.Back))),
+		)...)...,
+	)
+
+	box := BoxStyle.Render(content)
+
+	return lipgloss.Place(
+		m.width,
+		m.height,
+		lipgloss.Center,
+		lipgloss.Center,
+		box,
+	)
+}
+
+func (m Model) renderHistoryView() string {
+	if m.history == nil {
+		return ""
+	}
+
+	header := HeaderStyle.Width(m.width).Render(m.headerTitle("What changed"))
+
+	var tabs []string
+	for i, r := range historyRanges {
+		if i == m.history.rangeIndex {
+			tabs = append(tabs, BadgeStyle.Render(r.label))
+		} else {
+			tabs = append(tabs, MutedStyle.Padding(0, 1).MarginRight(1).Render(r.label))
+		}
+	}
+
+	period := ""
+	if m.history.err == nil {
+		period = MutedStyle.Render(fmt.Sprintf("%s → %s",
+			m.history.report.From.Format("Mon Jan 2 15:04"), m.history.report.To.Format("Mon Jan 2 15:04")))
+	}
+
+	lines := m.historyLines()
+	visible := m.historyHeight()
+	start := m.history.scroll
+	if start > len(lines)-visible {
+		start = max(len(lines)-visible, 0)
+	}
+	end := min(start+visible, len(lines))
+
+	footer := HelpStyle.Render(hints(hint("Range", m.keys.Left, m.keys.Right), hint("Scroll", m.keys.Up, m.keys.Down), hint("Back", m.keys.Back), "(marcel diff prints this for notes)"))
+
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		header,
+		lipgloss.JoinHorizontal(lipgloss.Left, tabs...),
+		period,
+		"",
+		lipgloss.NewStyle().Padding(0, 2).Render(strings.Join(lines[start:end], "\n")),
+		footer,
+	)
+}
+
 func (m Model) renderFormView(form *huh.Form) string {
 	if form == nil {
 		return ""
@@ -335,8 +483,8 @@ func (m Model) renderJourneyDetailView() string {
 		return ""
 	}
 
-	headerText := fmt.Sprintf("Marcel - %s", m.selectedJourney.Name)
-	header := HeaderStyle.Width(m.width).Render(headerText)
+	headerText := fmt.Sprintf("%s (%d)", m.selectedJourney.Name, questCount(m.journeyQuestList)) + m.views["journey"].label() + m.selectionLabel(m.journeyQuestList, "journey")
+	header := HeaderStyle.Width(m.width).Render(m.headerTitle(headerText))
 
 	content := m.journeyQuestList.View()
 
@@ -353,6 +501,8 @@ func (m Model) renderJourneyDetailView() string {
 		statusBars = append(statusBars, StatusBarStyle.Width(m.width).Render(msgStyle.Render(m.message)))
 	}
 
+	statusBars = append(statusBars, m.renderSyncIndicator())
+
 	topSection := lipgloss.JoinVertical(
 		lipgloss.Left,
 		header,
@@ -375,9 +525,25 @@ func (m Model) renderJourneyDetailView() string {
 	)
 }
 
+// headerTitle names the active profile, if any: "Marcel [work] - Quests".
+func (m Model) headerTitle(title string) string {
+	if profile := m.storage.GetConfig().Profile; profile != "" {
+		return fmt.Sprintf("Marcel [%s] - %s", profile, title)
+	}
+	return "Marcel - " + title
+}
+
 func (m Model) renderSyncIndicator() string {
-	if m.currentSection != "quests" {
-		return ""
+	if m.storage.GetConfig().Backend == config.BackendLocal {
+		return StatusBarStyle.Width(m.width).Render(MutedStyle.Render("local data · no account"))
+	}
+
+	age := "never synced"
+	if !m.lastSynced.IsZero() {
+		age = "synced " + formatAge(time.Since(m.lastSynced))
+	}
+	if m.cacheOnly {
+		age = "cache only · " + age
 	}
 
 	switch m.syncStatus {
@@ -385,14 +551,27 @@ func (m Model) renderSyncIndicator() string {
 		content := lipgloss.JoinHorizontal(
 			lipgloss.Left,
 			m.syncSpinner.View(),
-			" Syncing quests...",
+			" Syncing...",
 		)
 		return StatusBarStyle.Width(m.width).Render(MutedStyle.Render(content))
 	case SyncStatusSynced:
 		return StatusBarStyle.Width(m.width).Render(SuccessStyle.Render("✓ Synced"))
 	case SyncStatusError:
-		return StatusBarStyle.Width(m.width).Render(ErrorStyle.Render("✗ Sync failed"))
+		return StatusBarStyle.Width(m.width).Render(ErrorStyle.Render("✗ Sync failed") + MutedStyle.Render(" · "+age))
 	default:
-		return ""
+		return StatusBarStyle.Width(m.width).Render(MutedStyle.Render(age))
+	}
+}
+
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
 	}
 }